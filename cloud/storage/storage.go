@@ -6,6 +6,29 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Params of params.yaml that hold the credentials of the artifact repository
+const (
+	S3AccessKeyParam           = "artifactRepository.s3.accessKey"
+	S3SecretKeyParam           = "artifactRepository.s3.secretKey"
+	GCSServiceAccountKeyParam  = "artifactRepository.gcs.serviceAccountKey"
+	GCSServiceAccountJSONParam = "artifactRepository.gcs.serviceAccountJSON"
+	ABSAccessKeyParam          = "artifactRepository.abs.accessKey"
+	ABSSecretKeyParam          = "artifactRepository.abs.secretKey"
+	ServiceAccountKeyParam     = "artifactRepositoryServiceAccountKey"
+)
+
+// SecretParams are the params of the artifact repository whose values are credentials.
+// Their values must not be shared, e.g. in support bundles.
+var SecretParams = []string{
+	S3AccessKeyParam,
+	S3SecretKeyParam,
+	GCSServiceAccountKeyParam,
+	GCSServiceAccountJSONParam,
+	ABSAccessKeyParam,
+	ABSSecretKeyParam,
+	ServiceAccountKeyParam,
+}
+
 // ArtifactRepositoryS3Provider is meant to be used
 // by the CLI. CLI will marshal this struct into the correct
 // YAML structure for k8s configmap / secret.
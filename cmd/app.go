@@ -1,10 +1,35 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
 	opConfig "github.com/onepanelio/cli/config"
 	"github.com/onepanelio/cli/util"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	outputFormatTable = "table"
+	outputFormatJSON  = "json"
+	outputFormatYAML  = "yaml"
+)
+
+var (
+	// statusOutputFormat is the format of the app status report. One of table, json or yaml
+	statusOutputFormat string
+	// statusWatch if true, app status keeps watching the deployment until it is ready
+	statusWatch bool
+	// statusTimeout is how long app status --watch waits for the deployment to be ready
+	statusTimeout time.Duration
 )
 
 var appCmd = &cobra.Command{
@@ -12,73 +37,263 @@ var appCmd = &cobra.Command{
 	Short:   "Various app functions.",
 	Long:    "Inspect and execute various app functions..",
 	Example: "app",
-	Run:     func(cmd *cobra.Command, args []string) {},
+	RunE:    func(cmd *cobra.Command, args []string) error { return nil },
 }
 
 var statusCmd = &cobra.Command{
 	Use:     "status",
 	Short:   "Check deployment status.",
-	Long:    "Check deployment status by checking pods statuses.",
-	Example: "status",
-	Run: func(cmd *cobra.Command, args []string) {
-		configFilePath := "config.yaml"
-		config, err := opConfig.FromFile(configFilePath)
-		if err != nil {
-			fmt.Printf("Unable to read configuration file: %v", err.Error())
-			return
+	Long:    "Check the health of each deployed component by checking its Deployments, StatefulSets, DaemonSets and pods. Deployments without an inventory are checked by rendering the components of config.yaml.",
+	Example: "status -o json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if statusOutputFormat != outputFormatTable && statusOutputFormat != outputFormatJSON && statusOutputFormat != outputFormatYAML {
+			return validationErrorf("'%v' is not a valid --output value. Valid values: table, json, yaml", statusOutputFormat)
 		}
-		yamlFile, err := util.LoadDynamicYamlFromFile(config.Spec.Params)
-		if err != nil {
-			fmt.Println("Error parsing configuration file.")
-			return
+
+		// The inventory in the cluster describes what was deployed. Deployments applied before the inventory
+		// existed are described by the local config.yaml instead.
+		inventory, inventoryErr := loadClusterInventory()
+
+		var err error
+		var config *opConfig.Config
+		var yamlFile *util.DynamicYaml
+		if inventory != nil {
+			yamlFile, err = util.LoadDynamicYamlFromString(inventory.Params)
+			if err != nil {
+				return fmt.Errorf("unable to parse params from the deployment inventory: %w", err)
+			}
+		} else {
+			config, err = opConfig.FromFile("config.yaml")
+			if err != nil {
+				if inventoryErr != nil {
+					return clusterError(nil, "app status", fmt.Errorf("unable to read the deployment inventory from the cluster: %w", inventoryErr))
+				}
+				return configErrorf("unable to read configuration file: %v", err.Error())
+			}
+			yamlFile, err = util.LoadParamsFromFile(config.Spec.Params)
+			if err != nil {
+				return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+			}
 		}
 
-		ready, err := util.DeploymentStatus(yamlFile)
+		client, err := newClusterClient()
 		if err != nil {
-			yamlFile, yamlErr := util.LoadDynamicYamlFromFile(config.Spec.Params)
-			if yamlErr != nil {
-				fmt.Printf("Error reading file '%v' %v", config.Spec.Params, yamlErr.Error())
-				return
-			}
+			return clusterError(yamlFile, "app status", err)
+		}
 
-			flatMap := yamlFile.FlattenToKeyValue(util.AppendDotFlatMapKeyFormatter)
-			provider, providerErr := util.GetYamlStringValue(flatMap, "application.provider")
-			if providerErr != nil {
-				fmt.Printf("Unable to read application.provider from params.yaml %v", providerErr.Error())
-				return
+		if statusWatch {
+			if err := watchDeploymentStatus(client, yamlFile); err != nil {
+				return clusterError(yamlFile, "app status", err)
 			}
-			if provider == nil {
-				fmt.Printf("application.provider is not set in params.yaml")
-				return
+			fmt.Println("Your deployment is ready.")
+			return nil
+		}
+
+		var reports []*util.ComponentHealth
+		if inventory != nil {
+			reports, err = inventoryHealth(client, inventory)
+		} else {
+			// Without an inventory it is not recorded which workloads each component has, they are rendered
+			componentResources, renderErr := generateComponentResources(config, nil)
+			if renderErr != nil {
+				return kustomizeError(renderErr)
 			}
+			reports, err = deploymentHealth(client, config, componentResources)
+		}
+		if err != nil {
+			return clusterError(yamlFile, "app status", err)
+		}
 
-			if *provider == "microk8s" {
-				fmt.Printf("Unable to connect to cluster. Make sure you are running with \nKUBECONFIG=./kubeconfig opctl app status\nError: %v", err.Error())
-				return
+		switch statusOutputFormat {
+		case outputFormatJSON:
+			data, err := json.MarshalIndent(reports, "", "  ")
+			if err != nil {
+				return err
 			}
+			fmt.Println(string(data))
+			return nil
+		case outputFormatYAML:
+			data, err := yaml.Marshal(reports)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(data))
+			return nil
+		}
 
-			fmt.Println(err.Error())
-			return
+		printHealthTable(reports)
+
+		healthy := true
+		for _, report := range reports {
+			healthy = healthy && report.Healthy
 		}
-		if ready {
-			fmt.Println("Your deployment is ready.")
+		if healthy {
+			fmt.Println("\nYour deployment is ready.")
 		} else {
-			fmt.Println("Your deployment is NOT ready; not all Pods are running. To view all Pods:")
-			fmt.Println("$ kubectl get pods -A")
+			fmt.Println("\nYour deployment is NOT ready.")
 		}
 
 		// Get cluster deployment URL
 		url, err := util.GetDeployedWebURL(yamlFile)
 		if err != nil {
-			fmt.Printf("[error] Unable to get deployed url from configuration: %v", err.Error())
-			return
+			return &ValidationError{Err: fmt.Errorf("unable to get deployed url from configuration: %w", err)}
 		}
 
-		util.GetClusterIp(url)
+		util.GetClusterIp(client, yamlFile, url)
+
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(appCmd)
 	appCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringVarP(&statusOutputFormat, "output", "o", outputFormatTable, "Output format. Valid values: table, json, yaml")
+	statusCmd.Flags().BoolVarP(&statusWatch, "watch", "w", false, "Watch the deployment until it is ready. Exits with a non-zero code if the timeout passes first")
+	statusCmd.Flags().DurationVarP(&statusTimeout, "timeout", "", 10*time.Minute, "How long --watch waits for the deployment to be ready")
+}
+
+// watchDeploymentStatus shows the workloads of the deployment as they change, until they are all ready.
+// In a terminal the view is refreshed in place, otherwise one line is printed per state change.
+func watchDeploymentStatus(client util.ClusterClient, yamlFile *util.DynamicYaml) error {
+	checker := util.NewReadinessChecker(client.Kubernetes())
+
+	interactive := terminal.IsTerminal(int(os.Stdout.Fd()))
+	width, _, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		width = 120
+	}
+
+	linesPrinted := 0
+	previous := make(map[util.Workload]util.WorkloadStatus)
+	onChange := func(statuses []util.WorkloadStatus) {
+		if !interactive {
+			for _, status := range statuses {
+				if previousStatus, ok := previous[status.Workload]; ok && previousStatus == status {
+					continue
+				}
+				previous[status.Workload] = status
+				fmt.Printf("%v %v\n", time.Now().Format(time.RFC3339), formatWorkloadStatus(status))
+			}
+			return
+		}
+
+		if linesPrinted > 0 {
+			// Move the cursor up to the first line of the last update and clear everything below it
+			fmt.Printf("\033[%vA\033[J", linesPrinted)
+		}
+
+		lines := []string{fmt.Sprintf("Waiting for deployment, last update %v", time.Now().Format("15:04:05"))}
+		for _, status := range statuses {
+			lines = append(lines, formatWorkloadStatus(status))
+		}
+		for _, line := range lines {
+			// Lines are only shortened if there is room for the ellipsis
+			if len(line) > width && width > 3 {
+				line = line[:width-3] + "..."
+			}
+			fmt.Println(line)
+		}
+		linesPrinted = len(lines)
+	}
+
+	return checker.WatchUntilReady(statusTimeout, onChange, util.DeploymentWorkloads(yamlFile)...)
+}
+
+func formatWorkloadStatus(status util.WorkloadStatus) string {
+	if status.Ready {
+		return fmt.Sprintf("[ready]     %v", status.Workload)
+	}
+
+	return fmt.Sprintf("[not ready] %v: %v", status.Workload, status.Reason)
+}
+
+// deploymentHealth reports the health of the workloads of each component of config, with its overlays.
+// Without an inventory the workloads of a component are taken from its render, componentResources, see generateComponentResources.
+// Reports are sorted by component name.
+func deploymentHealth(client util.ClusterClient, config *opConfig.Config, componentResources map[string][]*unstructured.Unstructured) ([]*util.ComponentHealth, error) {
+	components := make([]util.InventoryComponent, 0)
+	for _, component := range config.GetOverlayComponents("") {
+		components = append(components, util.InventoryComponent{
+			Name:      component.Name(),
+			Overlays:  component.Overlays(),
+			Resources: util.NewInventoryResources(componentResources[component.Name()]),
+		})
+	}
+
+	return componentsHealth(client, components)
+}
+
+// inventoryHealth reports the health of the workloads of each component recorded in the inventory.
+// Reports are sorted by component name.
+func inventoryHealth(client util.ClusterClient, inventory *util.Inventory) ([]*util.ComponentHealth, error) {
+	return componentsHealth(client, inventory.Components)
+}
+
+// componentsHealth reports the health of the workloads of each component, sorted by component name
+func componentsHealth(client util.ClusterClient, components []util.InventoryComponent) ([]*util.ComponentHealth, error) {
+	reporter := util.NewHealthReporter(client)
+
+	components = append([]util.InventoryComponent{}, components...)
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+
+	reports := make([]*util.ComponentHealth, 0)
+	for _, component := range components {
+		resources := util.InventoryResourcesToUnstructured(component.Resources)
+		report, err := reporter.ComponentHealth(component.Name, component.Overlays, resources)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func printHealthTable(reports []*util.ComponentHealth) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "COMPONENT\tWORKLOAD\tREADY\tSTATUS")
+
+	for _, report := range reports {
+		if len(report.Workloads) == 0 {
+			fmt.Fprintf(writer, "%v\t-\t-\t-\n", report.Component)
+			continue
+		}
+
+		for _, workload := range report.Workloads {
+			status := "Healthy"
+			if workload.Missing {
+				status = "Missing"
+			} else if !workload.Healthy() {
+				status = "Unhealthy"
+			}
+
+			fmt.Fprintf(writer, "%v\t%v %v/%v\t%v/%v\t%v\n", report.Component,
+				workload.Kind, workload.Namespace, workload.Name,
+				workload.ReadyReplicas, workload.DesiredReplicas, status)
+
+			for _, pod := range workload.FailingPods {
+				reason := pod.Reason
+				if pod.Message != "" {
+					reason += ": " + pod.Message
+				}
+				fmt.Fprintf(writer, "%v\t  Pod %v\t\t%v\n", report.Component, pod.Name, reason)
+			}
+		}
+	}
+	writer.Flush()
+
+	for _, report := range reports {
+		if len(report.Events) == 0 {
+			continue
+		}
+
+		fmt.Printf("\nRecent warning events for %v:\n", report.Component)
+		for _, event := range report.Events {
+			fmt.Printf("- %v %v: %v (x%v)\n", event.Object, event.Reason, strings.TrimSpace(event.Message), event.Count)
+		}
+	}
 }
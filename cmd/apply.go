@@ -2,259 +2,346 @@ package cmd
 
 import (
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/onepanelio/cli/util"
 
 	opConfig "github.com/onepanelio/cli/config"
-	"github.com/onepanelio/cli/files"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // applyCmd represents the apply command
 var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Applies application YAML to your Kubernetes cluster.",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		configFilePath := "config.yaml"
 
-		fmt.Printf("Starting deployment...\n\n")
-
 		if len(args) > 1 {
 			configFilePath = args[0]
-			return
+			return nil
 		}
 
 		config, err := opConfig.FromFile(configFilePath)
 		if err != nil {
-			fmt.Printf("Unable to read configuration file: %v", err.Error())
-			return
+			return configErrorf("unable to read configuration file: %v", err.Error())
 		}
 
-		overlayComponentFirst := filepath.Join("common", "application", "base")
-		baseOverlayComponent := config.GetOverlayComponent(overlayComponentFirst)
-		applicationBaseKustomizeTemplate := TemplateFromSimpleOverlayedComponents(baseOverlayComponent)
-		applicationResult, err := GenerateKustomizeResult(*config, applicationBaseKustomizeTemplate)
+		yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
 		if err != nil {
-			fmt.Printf("%s\n", HumanizeKustomizeError(err))
-			return
+			return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
 		}
 
-		applicationKubernetesYamlFilePath := filepath.Join(".onepanel", "application.kubernetes.yaml")
-
-		existsApp, err := files.Exists(applicationKubernetesYamlFilePath)
+		components, err := resolveConfigComponents(config, applyComponentNames)
 		if err != nil {
-			log.Printf("Unable to check if file '%v' exists", applicationKubernetesYamlFilePath)
-			return
+			return &ValidationError{Err: err}
 		}
 
-		var applicationKubernetesFile *os.File = nil
-		if !existsApp {
-			applicationKubernetesFile, err = os.Create(applicationKubernetesYamlFilePath)
-			if err != nil {
-				log.Printf("Unable to create file: error %v", err.Error())
-				return
-			}
-		} else {
-			applicationKubernetesFile, err = os.OpenFile(applicationKubernetesYamlFilePath, os.O_RDWR|os.O_TRUNC, 0)
-			if err != nil {
-				log.Printf("Unable to open file: error %v", err.Error())
-				return
-			}
+		client, err := newClusterClient()
+		if err != nil {
+			return clusterError(yamlFile, "apply", err)
 		}
 
-		if _, err := applicationKubernetesFile.WriteString(applicationResult); err != nil {
-			log.Printf("Error writing to temporary file: %v", err.Error())
-			return
-		}
+		// A dry run renders the saved generated secrets, but does not create missing ones
+		loadGeneratedSecrets(client, !applyDryRun)
 
-		resApp := ""
-		errResApp := ""
+		applicationResult, result, err := generateApplicationResults(config, components)
+		if err != nil {
+			return kustomizeError(err)
+		}
 
-		resApp, errResApp, err = applyKubernetesFile(applicationKubernetesYamlFilePath)
+		deployment, err := deploymentName(config)
 		if err != nil {
-			yamlFile, yamlErr := util.LoadDynamicYamlFromFile(config.Spec.Params)
-			if yamlErr != nil {
-				fmt.Printf("Error reading file '%v' %v", config.Spec.Params, yamlErr.Error())
-				return
-			}
+			return &ValidationError{Err: err}
+		}
 
-			flatMap := yamlFile.FlattenToKeyValue(util.AppendDotFlatMapKeyFormatter)
-			provider, providerErr := util.GetYamlStringValue(flatMap, "application.provider")
-			if providerErr != nil {
-				fmt.Printf("Unable to read application.provider from params.yaml %v", providerErr.Error())
-				return
-			}
-			if provider == nil {
-				fmt.Printf("application.provider is not set in params.yaml")
-				return
+		if applyDryRun {
+			if err := printDeploymentDiff(client, deployment, components, applicationResult, result); err != nil {
+				return clusterError(yamlFile, "apply", fmt.Errorf("unable to diff deployment: %w", err))
 			}
+			return nil
+		}
+
+		// The preflight checks and the inventory need the resources of each component, they are rendered once for both
+		componentResources, err := generateComponentResources(config, components)
+		if err != nil {
+			return kustomizeError(err)
+		}
 
-			if *provider == "microk8s" {
-				fmt.Printf("Unable to connect to cluster. Make sure you are running with \nKUBECONFIG=./kubeconfig opctl apply\nError: %v", err.Error())
-				return
+		if !applySkipPreflight {
+			fmt.Printf("Running preflight checks...\n\n")
+			if err := runPreflight(client, config, componentResources); err != nil {
+				return clusterError(yamlFile, "apply", err)
 			}
+		}
 
-			fmt.Printf("\nFailed: %v", err.Error())
-			return
+		lock, err := acquireDeploymentLock("apply")
+		if err != nil {
+			return clusterError(yamlFile, "apply", err)
 		}
+		defer releaseDeploymentLock(lock)
+		// Nothing more is changed once someone else takes the lock over
+		client = util.NewLockedClusterClient(client, lock)
 
-		log.Printf("res: %v", resApp)
-		if errResApp != "" {
-			log.Printf("err: %v", errResApp)
+		// Secrets generated while rendering are deployed now, later builds have to use the same values
+		if err := saveGeneratedSecrets(); err != nil {
+			return clusterError(yamlFile, "apply", err)
 		}
 
-		//Once applied, verify the application is running before moving on with the rest
-		//of the yaml.
-		applicationRunning := false
-		podName := "application-controller-manager-0"
-		podNamespace := "application-system"
-		podInfoRes := ""
-		podInfoErrRes := ""
-		var podInfoErr error
-		for !applicationRunning {
-			podInfoRes, podInfoErrRes, podInfoErr = getPodInfo(podName, podNamespace)
-			if podInfoErr != nil {
-				if !strings.Contains(podInfoErr.Error(), "not found") {
-					fmt.Printf("\nFailed: %v", podInfoErr.Error())
-					return
-				} else {
-					podInfoRes = podInfoErr.Error()
-				}
-			}
-			if podInfoErrRes != "" {
-				fmt.Printf("\n: %v", podInfoErrRes)
-				return
-			}
-			if podInfoRes == "" {
-				fmt.Printf("\nNo response from first pod check.")
-				return
+		var prunes []*unstructured.Unstructured
+		if applyPrune {
+			prunes, err = findPrunableResources(client, deployment, components, applicationResult, result)
+			if err != nil {
+				return fmt.Errorf("unable to find resources to prune: %w", err)
 			}
 
-			lines := strings.Split(podInfoRes, "\n")
-			if len(lines) > 1 {
-				if strings.Contains(lines[1], "Running") {
-					applicationRunning = true
+			if len(prunes) == 0 {
+				fmt.Printf("No resources to prune.\n\n")
+			} else {
+				fmt.Println("The following resources are no longer part of your deployment and will be deleted:")
+				for _, resource := range prunes {
+					fmt.Printf("- %v\n", util.ResourceDisplayName(resource))
+				}
+				if !skipConfirmApply && !confirm("Are you sure you want to continue?") {
+					return nil
 				}
+				fmt.Println()
 			}
 		}
 
-		//Apply the rest of the yaml
-		kustomizeTemplate := TemplateFromSimpleOverlayedComponents(config.GetOverlayComponents(overlayComponentFirst))
-
-		result, err := GenerateKustomizeResult(*config, kustomizeTemplate)
-		if err != nil {
-			fmt.Printf("%s\n", HumanizeKustomizeError(err))
-			return
+		if len(components) != 0 {
+			return applyConfigComponents(client, applyTimeout, config, components, componentResources, applicationResult, result, prunes)
 		}
 
-		finalKubernetesYamlFilePath := filepath.Join(".onepanel", "kubernetes.yaml")
+		fmt.Printf("Starting deployment...\n\n")
 
-		exists, err := files.Exists(finalKubernetesYamlFilePath)
-		if err != nil {
-			log.Printf("Unable to check if file %v exists", finalKubernetesYamlFilePath)
-			return
+		renderedFiles := map[string]string{
+			filepath.Join(".onepanel", "application.kubernetes.yaml"): applicationResult,
+			filepath.Join(".onepanel", "kubernetes.yaml"):             result,
 		}
-
-		var finalKubernetesFile *os.File = nil
-		if !exists {
-			finalKubernetesFile, err = os.Create(finalKubernetesYamlFilePath)
-			if err != nil {
-				log.Printf("Unable to create file: error %v", err.Error())
-				return
-			}
-		} else {
-			finalKubernetesFile, err = os.OpenFile(finalKubernetesYamlFilePath, os.O_RDWR|os.O_TRUNC, 0)
-			if err != nil {
-				log.Printf("Unable to open file: error %v", err.Error())
-				return
+		for filePath, content := range renderedFiles {
+			if err := writeRenderedFile(filePath, content); err != nil {
+				return fmt.Errorf("unable to write file '%v': %w", filePath, err)
 			}
 		}
 
-		if _, err := finalKubernetesFile.WriteString(result); err != nil {
-			log.Printf("Error writing to temporary file: %v", err.Error())
-			return
+		if err := applyRenderedPhases(client, applyTimeout, applicationResult, result); err != nil {
+			return clusterError(yamlFile, "apply", err)
 		}
 
-		res := ""
-		errRes := ""
-
-		for i := 0; i < 5; i++ {
-			res, errRes, err = applyKubernetesFile(finalKubernetesYamlFilePath)
-			if !strings.Contains(errRes, "no matches for kind") {
-				break
+		if len(prunes) != 0 {
+			fmt.Printf("\nPruning %v resources...\n", len(prunes))
+			if err := deleteResources(client, prunes); err != nil {
+				return fmt.Errorf("unable to prune: %w", err)
 			}
+		}
 
-			fmt.Printf(".")
-			fmt.Printf(".")
-
-			time.Sleep(time.Second * 3)
+		if err := recordDeployment(config, configFilePath, componentResources, applicationResult, result); err != nil {
+			// Without the inventory, delete and diff find the deployment through the rendered files
+			fmt.Printf("\nUnable to record the deployment in the cluster, keeping the rendered files in .onepanel: %v\n", err.Error())
+		} else if !keepRendered {
+			removeRenderedFiles(renderedFiles)
 		}
 
-		log.Printf("%v", res)
-		if errRes != "" {
-			log.Printf("%v", errRes)
+		if err := waitForDeployment(client, applyTimeout, util.DeploymentWorkloads(yamlFile)); err != nil {
+			return err
 		}
 
-		yamlFile, err := util.LoadDynamicYamlFromFile(config.Spec.Params)
+		url, err := util.GetDeployedWebURL(yamlFile)
 		if err != nil {
-			fmt.Println("Error parsing configuration file.")
-			return
+			return &ValidationError{Err: fmt.Errorf("unable to get deployed url from configuration: %w", err)}
 		}
-		if err != nil {
-			fmt.Printf("\nDeployment failed: %v", err.Error())
-		} else {
-			fmt.Println("\nWaiting for deployment to complete...")
-			stopChecking := false
-			attempts := 0
-			maxAttempts := 5
-			for stopChecking == false {
-				deploymentStatus, deploymentStatusErr := util.DeploymentStatus(yamlFile)
-				if deploymentStatusErr != nil &&
-					!strings.Contains(deploymentStatusErr.Error(), "No resources found") {
-					fmt.Println(deploymentStatusErr.Error())
-					stopChecking = true
-				}
-				if deploymentStatus {
-					stopChecking = true
-					fmt.Printf("\nDeployment is complete.\n\n")
-				} else {
-					if attempts >= maxAttempts {
-						stopChecking = true
-						fmt.Println("\nDeployment is still in progress. Check again with `opctl app status` in a few minutes.")
-					} else {
-						time.Sleep(20 * time.Second)
-						fmt.Println("Waiting for deployment to complete...")
-						attempts++
-					}
-				}
-			}
 
-			url, err := util.GetDeployedWebURL(yamlFile)
-			if err != nil {
-				fmt.Printf("[error] Unable to get deployed url from configuration: %v", err.Error())
-				return
-			}
+		util.GetClusterIp(client, yamlFile, url)
 
-			util.GetClusterIp(url)
-		}
+		return nil
 	},
 }
 
+// writeRenderedFile writes rendered resources, which include the data of Secrets, only readable by the current user
+func writeRenderedFile(filePath, content string) error {
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		return err
+	}
+
+	// WriteFile keeps the permissions of an existing file, e.g. one written by an older version
+	return os.Chmod(filePath, 0600)
+}
+
+// removeRenderedFiles removes the files the rendered resources were written to, see writeRenderedFile
+func removeRenderedFiles(renderedFiles map[string]string) {
+	for filePath := range renderedFiles {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Unable to remove %v, it has the data of your Secrets: %v\n", filePath, err.Error())
+		}
+	}
+}
+
+// waitForDeployment waits for the workloads of the deployment to be ready, e.g. util.DeploymentWorkloads.
+// If they are not ready within timeout, the workloads that are not ready yet are printed
+// and the *util.NotReadyError is returned.
+func waitForDeployment(client util.ClusterClient, timeout time.Duration, workloads []util.Workload) error {
+	fmt.Println("\nWaiting for deployment to complete...")
+	err := client.Wait(timeout, workloads...)
+	if notReadyErr, ok := err.(*util.NotReadyError); ok {
+		fmt.Println("\nDeployment is still in progress. Check again with `opctl app status` in a few minutes. Waiting on:")
+		for _, status := range notReadyErr.Blocking {
+			fmt.Printf("- %v: %v\n", status.Workload, status.Reason)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nDeployment is complete.\n\n")
+
+	return nil
+}
+
+// applicationControllerWorkload has to be ready before anything besides the application base is applied
+var applicationControllerWorkload = util.Workload{
+	Kind:      util.WorkloadPod,
+	Namespace: "application-system",
+	Name:      "application-controller-manager-0",
+}
+
+var (
+	// applyDryRun if true, apply only shows the changes it would make to the cluster
+	applyDryRun bool
+	// applyComponentNames limits apply to these components of config.yaml
+	applyComponentNames []string
+	// applyPrune if true, resources from the last apply that are no longer rendered are deleted
+	applyPrune bool
+	// skipConfirmApply if true, will skip the confirmation prompt of apply --prune
+	skipConfirmApply bool
+	// applySkipPreflight if true, apply does not check the cluster before applying, see runPreflight
+	applySkipPreflight bool
+	// applyTimeout is how long apply waits for the cluster, e.g. for CustomResourceDefinitions to be established
+	applyTimeout time.Duration
+)
+
 func init() {
 	rootCmd.AddCommand(applyCmd)
 	applyCmd.Flags().BoolVarP(&Dev, "latest", "", false, "Sets conditions to allow development/latest testing.")
+	applyCmd.Flags().BoolVarP(&applyDryRun, "dry-run", "", false, "Show the changes that would be made to the cluster without applying them")
+	applyCmd.Flags().StringSliceVarP(&applyComponentNames, "component", "", nil, "Only apply these components, e.g. --component modeldb. Can be repeated")
+	applyCmd.Flags().BoolVarP(&applyPrune, "prune", "", false, "Delete resources from the last apply that are no longer part of the deployment")
+	applyCmd.Flags().BoolVarP(&skipConfirmApply, "yes", "y", false, "Add this in to skip the confirmation prompt of --prune")
+	applyCmd.Flags().BoolVarP(&forceUnlock, "force-unlock", "", false, "Take the deployment lock even if someone else holds it. Only use this if they are no longer running")
+	applyCmd.Flags().BoolVarP(&keepRendered, "keep-rendered", "", false, "Keep the rendered manifests and the manifests cache in .onepanel, they have your secrets in plain text")
+	applyCmd.Flags().BoolVarP(&applySkipPreflight, "skip-preflight", "", false, "Apply without checking the cluster first, see 'opctl preflight'")
+	applyCmd.Flags().DurationVarP(&applyTimeout, "timeout", "", 5*time.Minute, "How long to wait for the cluster to be ready before failing")
 }
 
-func getPodInfo(podName string, podNamespace string) (res string, errMessage string, err error) {
-	var extraArgs []string
-	return util.KubectlGet("pod", podName, podNamespace, extraArgs, make(map[string]interface{}))
+// generateApplicationResults renders the two phases of a deployment.
+// The application base is applied first as the rest of the resources depend on the application controller.
+// If components, the paths of components in config, are given only those are rendered. A phase can be empty then.
+// Every resource is labeled as owned by the deployment, see util.SetOwnershipLabels.
+func generateApplicationResults(config *opConfig.Config, components []string) (applicationResult string, result string, err error) {
+	deployment, err := deploymentName(config)
+	if err != nil {
+		return
+	}
+
+	overlayComponentFirst := filepath.Join(applicationComponentName, "base")
+
+	if len(components) == 0 || containsString(components, overlayComponentFirst) {
+		baseOverlayComponent := config.GetOverlayComponent(overlayComponentFirst)
+		applicationBaseKustomizeTemplate := TemplateFromSimpleOverlayedComponents(baseOverlayComponent)
+		applicationResult, err = GenerateKustomizeResult(*config, applicationBaseKustomizeTemplate)
+		if err != nil {
+			return
+		}
+		applicationResult, err = util.LabelRenderedResources(applicationResult, deployment)
+		if err != nil {
+			return
+		}
+	}
+
+	overlayComponents := config.GetOverlayComponents(overlayComponentFirst)
+	if len(components) != 0 {
+		overlayComponents = selectOverlayComponents(config, removeString(components, overlayComponentFirst))
+	}
+	if len(overlayComponents) == 0 {
+		return
+	}
+
+	kustomizeTemplate := TemplateFromSimpleOverlayedComponents(overlayComponents)
+	result, err = GenerateKustomizeResult(*config, kustomizeTemplate)
+	if err != nil {
+		return
+	}
+	result, err = util.LabelRenderedResources(result, deployment)
+
+	return
 }
 
-func applyKubernetesFile(filePath string) (res string, errMessage string, err error) {
-	return util.KubectlApply(filePath)
+// generateComponentResources renders each of the components, paths of components in config, on its own, see
+// GenerateComponentResults. All components are rendered if none are given.
+func generateComponentResources(config *opConfig.Config, components []string) (map[string][]*unstructured.Unstructured, error) {
+	componentResults, err := GenerateComponentResults(*config, components...)
+	if err != nil {
+		return nil, err
+	}
+
+	componentResources := make(map[string][]*unstructured.Unstructured)
+	for component, result := range componentResults {
+		resources, err := util.ParseResources(result)
+		if err != nil {
+			return nil, err
+		}
+		componentResources[component] = resources
+	}
+
+	return componentResources, nil
+}
+
+// deploymentName returns the name that identifies the deployment in the cluster, its default namespace
+func deploymentName(config *opConfig.Config) (string, error) {
+	yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+	if err != nil {
+		return "", err
+	}
+
+	defaultNamespaceNode := yamlFile.GetValue("application.defaultNamespace")
+	if defaultNamespaceNode == nil || defaultNamespaceNode.Value == "" {
+		return "", fmt.Errorf("application.defaultNamespace is missing from your '%v' file", config.Spec.Params)
+	}
+
+	return defaultNamespaceNode.Value, nil
+}
+
+// findPrunableResources returns the resources of the last apply that are not part of the rendered phases,
+// still exist in the cluster and are owned by deployment. If components are given only their resources are considered.
+func findPrunableResources(client util.ClusterClient, deployment string, components []string, applicationResult, result string) ([]*unstructured.Unstructured, error) {
+	rendered := make([]*unstructured.Unstructured, 0)
+	for _, content := range []string{applicationResult, result} {
+		resources, err := util.ParseResources(content)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, resources...)
+	}
+
+	previous, err := previousResources(components)
+	if err != nil {
+		return nil, err
+	}
+
+	prunes, err := client.ResourceDiffer(deployment).Prunes(rendered, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*unstructured.Unstructured, 0)
+	for _, prune := range prunes {
+		resources = append(resources, prune.Resource)
+	}
+
+	return resources, nil
 }
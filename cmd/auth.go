@@ -20,7 +20,8 @@ var authCmd = &cobra.Command{
 	Short:   "Get authentication information.",
 	Long:    "Intended to be used to get authentication information.",
 	Example: "auth token",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return nil
 	},
 }
 
@@ -29,47 +30,36 @@ var tokenCmd = &cobra.Command{
 	Short:   "Get the token for a provider.",
 	Long:    "Get a token for a given provider. Google Cloud Platform is different from minikube, for example.",
 	Example: "auth token",
-	Run: func(cmd *cobra.Command, args []string) {
-		config, err := util.NewConfig()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClusterClient()
 		if err != nil {
-			fmt.Printf("Error getting kubernetes configuration: %v", err.Error())
-			return
+			return &ClusterUnreachableError{Err: fmt.Errorf("error getting kubernetes configuration: %w", err)}
 		}
 
 		if ServiceAccountName == "" {
 			ServiceAccountName = "admin"
 		}
-		token, username, err := util.GetBearerToken(config, "", ServiceAccountName)
+		token, username, err := util.GetBearerToken(client, ServiceAccountName)
 		if err != nil {
 			configFilePath := "config.yaml"
 			opConfig, opErr := opConfig.FromFile(configFilePath)
 			if opErr != nil {
-				fmt.Printf("Unable to read configuration file: %v", err.Error())
-				return
+				return configErrorf("unable to read configuration file: %v", opErr.Error())
 			}
-			yamlFile, yamlErr := util.LoadDynamicYamlFromFile(opConfig.Spec.Params)
+			yamlFile, yamlErr := util.LoadParamsFromFile(opConfig.Spec.Params)
 			if yamlErr != nil {
-				fmt.Printf("Error reading file '%v' %v", opConfig.Spec.Params, yamlErr.Error())
-				return
+				return configErrorf("error reading file '%v': %v", opConfig.Spec.Params, yamlErr.Error())
 			}
 
-			flatMap := yamlFile.FlattenToKeyValue(util.AppendDotFlatMapKeyFormatter)
-			provider, providerErr := util.GetYamlStringValue(flatMap, "application.provider")
-			if providerErr != nil {
-				fmt.Printf("Unable to read application.provider from params.yaml %v", providerErr.Error())
-				return
-			}
-			if provider == nil {
-				fmt.Printf("application.provider is not set in params.yaml")
-				return
-			}
-
-			if *provider == "microk8s" {
-				fmt.Printf("Make sure you are running with \nKUBECONFIG=./kubeconfig opctl auth token\nError: %v", err.Error())
-				return
+			// GetBearerToken does not keep the cause, so on microk8s any error is likely the missing kubeconfig
+			if provider := yamlFile.GetValue("application.provider"); provider != nil && provider.Value == "microk8s" {
+				return &ClusterUnreachableError{
+					Err:  err,
+					Hint: "Make sure you are running with \nopctl auth token --kubeconfig ./kubeconfig",
+				}
 			}
 
-			fmt.Printf("Error encountered for user %s: %s\n", username, err.Error())
+			return fmt.Errorf("error encountered for user %s: %w", username, err)
 		}
 
 		if token != "" {
@@ -79,6 +69,8 @@ var tokenCmd = &cobra.Command{
 			fmt.Println(username)
 			fmt.Println(currentTokenString)
 		}
+
+		return nil
 	},
 }
 
@@ -5,9 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/onepanelio/cli/cloud/storage"
-	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
-	"k8s.io/apimachinery/pkg/util/rand"
 	"log"
 	"os"
 	"path/filepath"
@@ -34,70 +32,122 @@ import (
 var generateCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Builds application YAML for preview.",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		configFilePath := "config.yaml"
 
 		if len(args) > 1 {
 			configFilePath = args[0]
-			return
+			return nil
 		}
 
 		config, err := opConfig.FromFile(configFilePath)
 		if err != nil {
-			fmt.Printf("Unable to read configuration file: %v", err.Error())
-			fmt.Println() // This gives us a newline as we get an extra "exiting" message
-			return
+			return configErrorf("unable to read configuration file: %v", err.Error())
 		}
 
-		kustomizeTemplate := TemplateFromSimpleOverlayedComponents(config.GetOverlayComponents(""))
+		overlayComponents := config.GetOverlayComponents("")
+		if len(buildComponentNames) != 0 {
+			components, err := resolveConfigComponents(config, buildComponentNames)
+			if err != nil {
+				return &ValidationError{Err: err}
+			}
+			overlayComponents = selectOverlayComponents(config, components)
+		}
+
+		kustomizeTemplate := TemplateFromSimpleOverlayedComponents(overlayComponents)
 
 		log.Printf("Building...")
 		result, err := GenerateKustomizeResult(*config, kustomizeTemplate)
 		if err != nil {
-			fmt.Printf("%s\n", HumanizeKustomizeError(err))
-			return
+			return kustomizeError(err)
 		}
 
 		fmt.Printf("%v", result)
+
+		return nil
 	},
 }
 
+var (
+	// buildComponentNames limits build to these components of config.yaml
+	buildComponentNames []string
+	// keepRendered if true, the manifests cache and the rendered manifests are kept in .onepanel after build and apply.
+	// They have the values of secret params in plain text.
+	keepRendered bool
+)
+
+// manifestsCachePath is where the manifests are copied to, and their variables replaced, to render them
+var manifestsCachePath = filepath.Join(".onepanel", "manifests", "cache")
+
 func init() {
 	rootCmd.AddCommand(generateCmd)
 	generateCmd.Flags().BoolVarP(&Dev, "latest", "", false, "Sets conditions to allow development testing.")
+	generateCmd.Flags().StringSliceVarP(&buildComponentNames, "component", "", nil, "Only build these components, e.g. --component modeldb. Can be repeated")
+	generateCmd.Flags().BoolVarP(&keepRendered, "keep-rendered", "", false, "Keep the manifests cache in .onepanel, it has your secret params in plain text")
 }
 
 // GenerateKustomizeResult Given the path to the manifests, and a kustomize config, creates the final kustomization file.
 // It does this by copying the manifests into a temporary directory, inserting the kustomize template
 // and running the kustomize command
 func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.Kustomize) (string, error) {
-	yamlFile, err := util.LoadDynamicYamlFromFile(config.Spec.Params)
+	localManifestsCopyPath, err := generateManifestsCache(config)
+	defer removeManifestsCache()
 	if err != nil {
 		return "", err
 	}
 
-	if err := manifest.Validate(yamlFile); err != nil {
-		return "", err
+	return buildKustomizeTemplate(localManifestsCopyPath, kustomizeTemplate)
+}
+
+// GenerateComponentResults renders each component in config, along with its overlays, on its own.
+// The result maps the component name, like common/onepanel, to its resources.
+// If components, the paths of components in config, are given only those are rendered.
+func GenerateComponentResults(config opConfig.Config, components ...string) (map[string]string, error) {
+	localManifestsCopyPath, err := generateManifestsCache(config)
+	defer removeManifestsCache()
+	if err != nil {
+		return nil, err
 	}
 
-	manifestPath := config.Spec.ManifestsRepo
-	localManifestsCopyPath := filepath.Join(".onepanel", "manifests", "cache")
+	overlayComponents := config.GetOverlayComponents("")
+	if len(components) != 0 {
+		overlayComponents = selectOverlayComponents(&config, components)
+	}
 
-	// Delete the local files if they exist
-	if err := os.RemoveAll(localManifestsCopyPath); err != nil {
-		return "", err
+	results := make(map[string]string)
+	for _, component := range overlayComponents {
+		kustomizeTemplate := TemplateFromSimpleOverlayedComponents([]*opConfig.SimpleOverlayedComponent{component})
+		result, err := buildKustomizeTemplate(localManifestsCopyPath, kustomizeTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		results[component.Name()] = result
 	}
 
-	if err := files.CopyDir(manifestPath, localManifestsCopyPath); err != nil {
-		return "", err
+	return results, nil
+}
+
+// removeManifestsCache removes the manifests cache once the manifests are rendered, unless keepRendered
+func removeManifestsCache() {
+	if keepRendered {
+		return
 	}
 
+	if err := os.RemoveAll(manifestsCachePath); err != nil {
+		log.Printf("Unable to remove the manifests cache %v: %v", manifestsCachePath, err.Error())
+	}
+}
+
+// buildKustomizeTemplate writes the kustomize template into the prepared manifests and runs kustomize
+func buildKustomizeTemplate(localManifestsCopyPath string, kustomizeTemplate template.Kustomize) (string, error) {
 	localKustomizePath := filepath.Join(localManifestsCopyPath, "kustomization.yaml")
 	// Create will truncate the file if it exists
 	newFile, err := os.Create(localKustomizePath)
 	if err != nil {
 		return "", err
 	}
+	defer newFile.Close()
 
 	kustomizeYaml, err := yaml.Marshal(kustomizeTemplate)
 	if err != nil {
@@ -110,6 +160,46 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 		return "", err
 	}
 
+	rm, err := runKustomizeBuild(localManifestsCopyPath)
+	if err != nil {
+		return "", err
+	}
+	kustYaml, err := rm.AsYaml()
+	if err != nil {
+		return "", err
+	}
+
+	return string(kustYaml), nil
+}
+
+// generateManifestsCache copies the manifests into the local cache directory and replaces
+// all of the variables in them with the values from the params file. The cache path is returned.
+func generateManifestsCache(config opConfig.Config) (string, error) {
+	yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+	if err != nil {
+		return "", &ConfigError{Err: err}
+	}
+
+	if err := manifest.Validate(yamlFile); err != nil {
+		return "", err
+	}
+
+	manifestPath := config.Spec.ManifestsRepo
+	localManifestsCopyPath := manifestsCachePath
+
+	// Delete the local files if they exist
+	if err := os.RemoveAll(localManifestsCopyPath); err != nil {
+		return "", err
+	}
+
+	if err := files.CopyDir(manifestPath, localManifestsCopyPath); err != nil {
+		return "", err
+	}
+	// The values of secret params are written into the cache, only the current user may read them
+	if err := os.Chmod(localManifestsCopyPath, 0700); err != nil {
+		return "", err
+	}
+
 	fqdn := yamlFile.GetValue("application.fqdn").Value
 	cloudSettings, err := util.LoadDynamicYamlFromFile(filepath.Join(config.Spec.ManifestsRepo, "vars", "onepanel-config-map-hidden.env"))
 	if err != nil {
@@ -164,11 +254,11 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 		metalLbAddressesConfigMapStr := generateMetalLbAddresses(yamlFile.GetValue("metalLb.addresses").Content)
 		yamlFile.PutWithSeparator("metalLbAddresses", metalLbAddressesConfigMapStr, ".")
 
-		metalLbSecretKey, err := bcrypt.GenerateFromPassword([]byte(rand.String(128)), bcrypt.DefaultCost)
+		metalLbSecretKey, err := generatedSecret(util.MetalLbSecretKey)
 		if err != nil {
 			return "", err
 		}
-		yamlFile.PutWithSeparator("metalLbSecretKey", base64.StdEncoding.EncodeToString(metalLbSecretKey), ".")
+		yamlFile.PutWithSeparator("metalLbSecretKey", metalLbSecretKey, ".")
 	}
 
 	_, artifactRepositoryNode := yamlFile.Get("artifactRepository")
@@ -191,7 +281,7 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 		defaultNamespace := yamlFile.GetValue("application.defaultNamespace").Value
 
 		accessKey := artifactRepositoryConfig.GCS.Bucket
-		randomSecret, err := util.RandASCIIString(16)
+		randomSecret, err := generatedSecret(util.ArtifactRepositoryGCSSecretKey)
 		if err != nil {
 			return "", err
 		}
@@ -216,12 +306,12 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 		}
 
 		yamlFile.Put("artifactRepositoryProvider", yamlStr)
-		yamlFile.Put("artifactRepository.s3.accessKey", accessKey)
-		yamlFile.Put("artifactRepository.s3.secretKey", randomSecret)
+		yamlFile.Put(storage.S3AccessKeyParam, accessKey)
+		yamlFile.Put(storage.S3SecretKeyParam, randomSecret)
 		yamlFile.Put("artifactRepository.s3.bucket", artifactRepositoryConfig.GCS.Bucket)
 		yamlFile.Put("artifactRepository.s3.endpoint", artifactRepositoryConfig.S3.Endpoint)
 		yamlFile.Put("artifactRepository.s3.insecure", "true")
-		yamlFile.Put("artifactRepositoryServiceAccountKey", base64.StdEncoding.EncodeToString([]byte(artifactRepositoryConfig.GCS.ServiceAccountKey)))
+		yamlFile.Put(storage.ServiceAccountKeyParam, base64.StdEncoding.EncodeToString([]byte(artifactRepositoryConfig.GCS.ServiceAccountKey)))
 	} else if artifactRepositoryConfig.ABS != nil {
 		defaultNamespace := yamlFile.GetValue("application.defaultNamespace").Value
 		artifactRepositoryConfig.S3 = &storage.ArtifactRepositoryS3Provider{
@@ -244,8 +334,8 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 		}
 
 		yamlFile.Put("artifactRepositoryProvider", yamlStr)
-		yamlFile.Put("artifactRepository.s3.accessKey", "placeholder")
-		yamlFile.Put("artifactRepository.s3.secretKey", "placeholder")
+		yamlFile.Put(storage.S3AccessKeyParam, "placeholder")
+		yamlFile.Put(storage.S3SecretKeyParam, "placeholder")
 		yamlFile.Put("artifactRepository.s3.bucket", "bucket-name")
 		yamlFile.Put("artifactRepository.s3.endpoint", "minio-gateway.onepanel.svc.cluster.local")
 		yamlFile.Put("artifactRepository.s3.insecure", "true")
@@ -256,7 +346,7 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 	// Check if workflowEngineContainerRuntimeExecutor is in the vars.
 	// If it is, leave it. If it is not, load it from the manifests and use the default
 	if !yamlFile.HasKey("workflowEngine.containerRuntimeExecutor") {
-		argoVarsYaml, err := util.LoadDynamicYamlFromFile(filepath.Join(".onepanel", "manifests", "cache", "common", "argo", "base", "vars.yaml"))
+		argoVarsYaml, err := util.LoadDynamicYamlFromFile(filepath.Join(localManifestsCopyPath, "common", "argo", "base", "vars.yaml"))
 		if err != nil {
 			return "", err
 		}
@@ -331,7 +421,7 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 			if err != nil {
 				return "", err
 			}
-			var stringToWrite = fmt.Sprintf("%v=%v\n%v=%v\n%v=%v\n%v=%v\n",
+			var stringToWrite = fmt.Sprintf("%v=%v\n%v=%v\n%v=%v\n",
 				"artifactRepositoryBucket", flatMap["artifactRepositoryS3Bucket"],
 				"artifactRepositoryEndpoint", flatMap["artifactRepositoryS3Endpoint"],
 				"artifactRepositoryInsecure", flatMap["artifactRepositoryS3Insecure"],
@@ -342,7 +432,7 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 			}
 		} else {
 			missingKeysMessage := strings.Join(missingKeys, ", ")
-			log.Fatalf("missing required values in params.yaml: %v", missingKeysMessage)
+			return "", validationErrorf("missing required values in params.yaml: %v", missingKeysMessage)
 		}
 	} else if artifactRepositoryConfig.S3 != nil && artifactRepositoryConfig.GCS == nil {
 		missingKeys := yamlFile.FindMissingKeys("artifactRepository.s3.bucket", "artifactRepository.s3.endpoint", "artifactRepository.s3.insecure", "artifactRepository.s3.region")
@@ -365,7 +455,7 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 			}
 		} else {
 			missingKeysMessage := strings.Join(missingKeys, ", ")
-			log.Fatalf("missing required values in params.yaml: %v", missingKeysMessage)
+			return "", validationErrorf("missing required values in params.yaml: %v", missingKeysMessage)
 		}
 	}
 	//logging-config-map.env, optional component
@@ -400,13 +490,13 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 			return "", err
 		}
 	} else {
-		log.Fatal("Missing required values in params.yaml, applicationDefaultNamespace")
+		return "", validationErrorf("missing required values in params.yaml: applicationDefaultNamespace")
 	}
 	//Write to secret files
 	var secretKeysValues []string
 	artifactRepoSecretPlaceholder := "$(artifactRepositoryProviderSecret)"
 	if yamlFile.HasKey("artifactRepository.s3") {
-		missingKeys := yamlFile.FindMissingKeys("artifactRepository.s3.accessKey", "artifactRepository.s3.secretKey")
+		missingKeys := yamlFile.FindMissingKeys(storage.S3AccessKeyParam, storage.S3SecretKeyParam)
 		if len(missingKeys) == 0 {
 			secretKeysValues = append(secretKeysValues, "artifactRepositoryS3AccessKey", "artifactRepositoryS3SecretKey")
 
@@ -421,7 +511,7 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 			}
 		} else {
 			missingKeysMessage := strings.Join(missingKeys, ", ")
-			log.Fatalf("Missing required values in params.yaml: %v", missingKeysMessage)
+			return "", validationErrorf("missing required values in params.yaml: %v", missingKeysMessage)
 		}
 	}
 
@@ -436,14 +526,7 @@ func GenerateKustomizeResult(config opConfig.Config, kustomizeTemplate template.
 		return "", err
 	}
 
-	//Update the values in those files
-	rm, err := runKustomizeBuild(localManifestsCopyPath)
-	if err != nil {
-		return "", err
-	}
-	kustYaml, err := rm.AsYaml()
-
-	return string(kustYaml), nil
+	return localManifestsCopyPath, nil
 }
 
 func replacePlaceholderForSecretManiFile(localManifestsCopyPath string, artifactRepoSecretPlaceholder string, artifactRepoSecretVal string) error {
@@ -457,12 +540,12 @@ func replacePlaceholderForSecretManiFile(localManifestsCopyPath string, artifact
 	secretFileContentStr := string(secretFileContent)
 	if strings.Contains(secretFileContentStr, artifactRepoSecretPlaceholder) {
 		secretFileContentStr = strings.Replace(secretFileContentStr, artifactRepoSecretPlaceholder, artifactRepoSecretVal, 1)
-		writeFileErr := ioutil.WriteFile(secretsPath, []byte(secretFileContentStr), 0644)
+		writeFileErr := ioutil.WriteFile(secretsPath, []byte(secretFileContentStr), 0600)
 		if writeFileErr != nil {
 			return writeFileErr
 		}
 	} else {
-		fmt.Printf("Key: %v not present in %v, not used.\n", artifactRepoSecretPlaceholder, secretsPath)
+		log.Printf("Key: %v not present in %v, not used.\n", artifactRepoSecretPlaceholder, secretsPath)
 	}
 	return nil
 }
@@ -651,9 +734,26 @@ func HumanizeKustomizeError(err error) string {
 	return fmt.Sprintf("Error generating result: %v", err.Error())
 }
 
+// kustomizeError returns an error from GenerateKustomizeResult with the message of HumanizeKustomizeError.
+// Invalid params are returned as a *ValidationError. Errors that already have a type are returned as is.
+func kustomizeError(err error) error {
+	var configErr *ConfigError
+	var validationErr *ValidationError
+	var clusterErr *ClusterUnreachableError
+	if errors.As(err, &configErr) || errors.As(err, &validationErr) || errors.As(err, &clusterErr) {
+		return err
+	}
+
+	if _, ok := err.(*manifest.ParamsError); ok {
+		return &ValidationError{Err: errors.New(HumanizeKustomizeError(err))}
+	}
+
+	return errors.New(HumanizeKustomizeError(err))
+}
+
 // replaceVariable will go through the variables in flatMap and replace any instances of it in fileContent
 // the resulting modified content is returned
-func replaceVariable(flatMap map[string]interface{}, fileContent []byte) []byte {
+func replaceVariable(flatMap map[string]interface{}, fileContent []byte) ([]byte, error) {
 	manifestFileContentStr := string(fileContent)
 	useStr := ""
 	rawStr := ""
@@ -671,7 +771,7 @@ func replaceVariable(flatMap map[string]interface{}, fileContent []byte) []byte
 			} else {
 				valueStr, ok := flatMap[key].(string)
 				if !ok {
-					log.Fatal("Unrecognized value in flatmap. Check type assertions.")
+					return nil, fmt.Errorf("unrecognized value in flatmap for key '%v'", key)
 				}
 				useStr = valueStr
 				rawStr = valueStr
@@ -693,7 +793,7 @@ func replaceVariable(flatMap map[string]interface{}, fileContent []byte) []byte
 		}
 	}
 
-	return []byte(manifestFileContentStr)
+	return []byte(manifestFileContentStr), nil
 }
 
 // replaceVariables will go through the variables in flatMap and replace any instances of it in any of the files in filePaths
@@ -705,8 +805,11 @@ func replaceVariables(flatMap map[string]interface{}, filePaths []string) error
 			return manifestFileOpenErr
 		}
 
-		manifestFileContentStr := replaceVariable(flatMap, manifestFileContent)
-		if err := ioutil.WriteFile(filePath, manifestFileContentStr, 0644); err != nil {
+		manifestFileContentStr, err := replaceVariable(flatMap, manifestFileContent)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filePath, manifestFileContentStr, 0600); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/onepanelio/cli/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newClusterClient creates the client every command uses for the resources of the cluster. Tests replace it with a fake.
+var newClusterClient = func() (util.ClusterClient, error) {
+	return util.NewClusterClient()
+}
+
+// applyResources applies the resources in the rendered yaml, waiting up to timeout for the cluster, see util.ClusterClient.Apply
+func applyResources(client util.ClusterClient, timeout time.Duration, content string) error {
+	resources, err := util.ParseResources(content)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+
+	return client.Apply(timeout, resources...)
+}
+
+// deleteResources deletes each group of resources in order.
+// Only the identity of each resource is needed, see util.InventoryResourcesToUnstructured.
+func deleteResources(client util.ClusterClient, groups ...[]*unstructured.Unstructured) error {
+	for _, resources := range groups {
+		if err := client.Delete(resources...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
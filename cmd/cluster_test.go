@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/util"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	testApplicationManifests = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: application-system`
+
+	testManifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: core
+  namespace: onepanel`
+)
+
+func Test_applyRenderedPhases(t *testing.T) {
+	client, err := util.NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	assert.Nil(t, applyRenderedPhases(client, time.Minute, testApplicationManifests, testManifests))
+
+	applied := make([]string, 0)
+	for _, resource := range client.Applied {
+		applied = append(applied, util.ResourceDisplayName(resource))
+	}
+	assert.Equal(t, []string{"Namespace application-system", "ConfigMap onepanel/onepanel", "Deployment onepanel/core"}, applied)
+	// The application controller is waited for between the phases
+	assert.Equal(t, []util.Workload{applicationControllerWorkload}, client.Waited)
+}
+
+func Test_applyRenderedPhases_SkipsEmptyPhases(t *testing.T) {
+	client, err := util.NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	assert.Nil(t, applyRenderedPhases(client, time.Minute, "", testManifests))
+	assert.Len(t, client.Applied, 2)
+	assert.Empty(t, client.Waited)
+
+	// The second phase is not applied if the application controller is not ready
+	client.WaitErr = &util.NotReadyError{Timeout: time.Minute}
+	err = applyRenderedPhases(client, time.Minute, testApplicationManifests, testManifests)
+	assert.IsType(t, &util.NotReadyError{}, err)
+	assert.Len(t, client.Applied, 3)
+}
+
+func Test_deleteResources(t *testing.T) {
+	resources, err := util.ParseResources(testManifests)
+	assert.Nil(t, err)
+	applicationResources, err := util.ParseResources(testApplicationManifests)
+	assert.Nil(t, err)
+
+	client, err := util.NewFakeClusterClient()
+	assert.Nil(t, err)
+	assert.Nil(t, client.Apply(time.Minute, append(applicationResources, resources...)...))
+
+	assert.Nil(t, deleteResources(client, resources, []*unstructured.Unstructured{}, applicationResources))
+
+	deleted := make([]string, 0)
+	for _, resource := range client.Deleted {
+		deleted = append(deleted, util.ResourceDisplayName(resource))
+	}
+	assert.Equal(t, []string{"ConfigMap onepanel/onepanel", "Deployment onepanel/core", "Namespace application-system"}, deleted)
+	assert.Empty(t, client.Resources)
+}
+
+func Test_waitForDeployment(t *testing.T) {
+	yamlFile, err := util.LoadDynamicYamlFromString(`application:
+  defaultNamespace: onepanel
+`)
+	assert.Nil(t, err)
+
+	client, err := util.NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	assert.Nil(t, waitForDeployment(client, time.Minute, util.DeploymentWorkloads(yamlFile)))
+	assert.Equal(t, util.DeploymentWorkloads(yamlFile), client.Waited)
+
+	client.WaitErr = &util.NotReadyError{Timeout: time.Minute}
+	assert.IsType(t, &util.NotReadyError{}, waitForDeployment(client, time.Minute, util.DeploymentWorkloads(yamlFile)))
+}
+
+func Test_deploymentHealth(t *testing.T) {
+	config := &opConfig.Config{Spec: opConfig.ConfigSpec{
+		Components: []string{"common/application/base", "common/onepanel/base"},
+		Overlays:   []string{"common/onepanel/overlays/gcp"},
+	}}
+	applicationResources, err := util.ParseResources(testApplicationManifests)
+	assert.Nil(t, err)
+	resources, err := util.ParseResources(testManifests)
+	assert.Nil(t, err)
+
+	client, err := util.NewFakeClusterClient()
+	assert.Nil(t, err)
+	assert.Nil(t, client.Apply(time.Minute, resources...))
+
+	// Without an inventory the workloads of each component are found in its render
+	reports, err := deploymentHealth(client, config, map[string][]*unstructured.Unstructured{
+		"common/application": applicationResources,
+		"common/onepanel":    resources,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "common/application", reports[0].Component)
+	assert.Empty(t, reports[0].Workloads)
+	assert.Equal(t, "common/onepanel", reports[1].Component)
+	assert.Equal(t, []string{"common/onepanel/overlays/gcp"}, reports[1].Overlays)
+	assert.Len(t, reports[1].Workloads, 1)
+	assert.Equal(t, "core", reports[1].Workloads[0].Name)
+	assert.False(t, reports[1].Healthy)
+}
+
+func Test_writeRenderedFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "rendered")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	// A file written by an older version is readable by everyone
+	filePath := filepath.Join(directory, "kubernetes.yaml")
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte(testApplicationManifests), 0644))
+
+	assert.Nil(t, writeRenderedFile(filePath, testManifests))
+	info, err := os.Stat(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, testManifests, string(content))
+
+	removeRenderedFiles(map[string]string{filePath: testManifests, filepath.Join(directory, "missing.yaml"): ""})
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+}
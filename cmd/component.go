@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applicationComponentName is the component that is applied in the first phase, see generateApplicationResults
+var applicationComponentName = filepath.Join("common", "application")
+
+// resolveConfigComponents returns the paths of the components in config that names refer to, see opConfig.MatchComponent
+func resolveConfigComponents(config *opConfig.Config, names []string) ([]string, error) {
+	return resolveComponents(config.Spec.Components, names)
+}
+
+// resolveComponents returns the components that names refer to, without duplicates
+func resolveComponents(components []string, names []string) ([]string, error) {
+	results := make([]string, 0)
+	for _, name := range names {
+		component, err := opConfig.MatchComponent(components, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !containsString(results, component) {
+			results = append(results, component)
+		}
+	}
+
+	return results, nil
+}
+
+// selectOverlayComponents returns the components, paths of components in config, along with their overlays
+func selectOverlayComponents(config *opConfig.Config, components []string) []*opConfig.SimpleOverlayedComponent {
+	overlayComponents := make([]*opConfig.SimpleOverlayedComponent, 0)
+	for _, component := range components {
+		overlayComponents = append(overlayComponents, config.GetOverlayComponent(component)...)
+	}
+
+	return overlayComponents
+}
+
+// componentNames returns the names of the components, which is how the inventory refers to them, e.g. common/onepanel
+func componentNames(components []string) []string {
+	names := make([]string, 0)
+	for _, component := range components {
+		names = append(names, strings.TrimSuffix(component, string(os.PathSeparator)+"base"))
+	}
+
+	return names
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func removeString(values []string, value string) []string {
+	results := make([]string, 0)
+	for _, item := range values {
+		if item != value {
+			results = append(results, item)
+		}
+	}
+
+	return results
+}
+
+// applyConfigComponents applies the rendered phases of some of the components in config, waiting up to timeout for the
+// cluster and for the workloads of the components, and prunes the given resources.
+// The components are updated in the inventory, but no revision is recorded as the rest of the deployment is not rendered.
+func applyConfigComponents(client util.ClusterClient, timeout time.Duration, config *opConfig.Config, components []string, componentResources map[string][]*unstructured.Unstructured, applicationResult, result string, prunes []*unstructured.Unstructured) error {
+	fmt.Printf("Applying %v...\n\n", strings.Join(componentNames(components), ", "))
+
+	yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+	if err != nil {
+		return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+	}
+
+	if err := applyRenderedPhases(client, timeout, applicationResult, result); err != nil {
+		return clusterError(yamlFile, "apply", err)
+	}
+
+	if len(prunes) != 0 {
+		fmt.Printf("\nPruning %v resources...\n", len(prunes))
+		if err := deleteResources(client, prunes); err != nil {
+			return fmt.Errorf("unable to prune: %w", err)
+		}
+	}
+
+	if err := updateInventoryComponents(config, components, componentResources); err != nil {
+		fmt.Printf("\nUnable to record the deployment in the cluster: %v\n", err.Error())
+	}
+
+	// Only the workloads of the applied components are waited for, the rest of the deployment was not changed
+	workloads := make([]util.Workload, 0)
+	for _, overlayComponent := range selectOverlayComponents(config, components) {
+		workloads = append(workloads, util.ResourceWorkloads(componentResources[overlayComponent.Name()])...)
+	}
+	if len(workloads) == 0 {
+		return nil
+	}
+
+	return waitForDeployment(client, timeout, workloads)
+}
+
+// updateInventoryComponents replaces the resources of the components, paths of components in config, in the inventory with
+// their rendered resources. Nothing is changed if there is no inventory yet, it is recorded by the first full apply.
+func updateInventoryComponents(config *opConfig.Config, components []string, componentResources map[string][]*unstructured.Unstructured) error {
+	inventory, err := loadClusterInventory()
+	if err != nil {
+		return err
+	}
+	if inventory == nil {
+		return nil
+	}
+
+	for _, overlayComponent := range selectOverlayComponents(config, components) {
+		resources := componentResources[overlayComponent.Name()]
+
+		removeInventoryComponent(inventory, overlayComponent.Name())
+		inventory.Components = append(inventory.Components, util.InventoryComponent{
+			Name:      overlayComponent.Name(),
+			Overlays:  overlayComponent.Overlays(),
+			Resources: util.NewInventoryResources(resources),
+		})
+
+		if overlayComponent.Name() == applicationComponentName {
+			existing := util.InventoryResourcesToUnstructured(inventory.ApplicationResources)
+			inventory.ApplicationResources = append(inventory.ApplicationResources,
+				util.NewInventoryResources(util.ResourcesNotIn(resources, existing))...)
+		} else {
+			existing := util.InventoryResourcesToUnstructured(inventory.Resources)
+			inventory.Resources = append(inventory.Resources,
+				util.NewInventoryResources(util.ResourcesNotIn(resources, existing))...)
+		}
+	}
+
+	inventory.User = currentUser()
+	inventory.AppliedAt = time.Now().UTC()
+
+	store, err := newInventoryStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Save(inventory)
+}
+
+// removeInventoryComponent removes the component, and the resources only it rendered, from the inventory
+func removeInventoryComponent(inventory *util.Inventory, name string) {
+	otherResources := make([]*unstructured.Unstructured, 0)
+	var removed *util.InventoryComponent
+	components := make([]util.InventoryComponent, 0)
+	for i := range inventory.Components {
+		if inventory.Components[i].Name == name {
+			removed = &inventory.Components[i]
+			continue
+		}
+
+		components = append(components, inventory.Components[i])
+		otherResources = append(otherResources, util.InventoryResourcesToUnstructured(inventory.Components[i].Resources)...)
+	}
+	inventory.Components = components
+
+	if removed == nil {
+		return
+	}
+
+	// Resources rendered by other components as well are kept
+	removedResources := util.ResourcesNotIn(util.InventoryResourcesToUnstructured(removed.Resources), otherResources)
+	inventory.ApplicationResources = util.NewInventoryResources(
+		util.ResourcesNotIn(util.InventoryResourcesToUnstructured(inventory.ApplicationResources), removedResources))
+	inventory.Resources = util.NewInventoryResources(
+		util.ResourcesNotIn(util.InventoryResourcesToUnstructured(inventory.Resources), removedResources))
+}
@@ -2,16 +2,24 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	opConfig "github.com/onepanelio/cli/config"
 	"github.com/onepanelio/cli/files"
 	"github.com/onepanelio/cli/util"
 	"github.com/spf13/cobra"
-	"path/filepath"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 var (
 	// skipConfirmDelete if true, will skip the confirmation prompt of the delete command
 	skipConfirmDelete bool
+	// deleteComponentNames limits delete to these components of the deployment
+	deleteComponentNames []string
+	// deleteDryRun if true, delete only prints the resources it would delete
+	deleteDryRun bool
 )
 
 var deleteCmd = &cobra.Command{
@@ -19,77 +27,286 @@ var deleteCmd = &cobra.Command{
 	Short:   "Deletes onepanel cluster resources",
 	Long:    "Delete all onepanel kubernetes cluster resources. Does not delete database unless it is in-cluster.",
 	Example: "delete",
-	Run: func(cmd *cobra.Command, args []string) {
-		if skipConfirmDelete == false {
-			fmt.Print("Are you sure you want to delete onepanel? ('y' or 'yes' to confirm. Anything else to cancel): ")
-			userInput := ""
-			if _, err := fmt.Scanln(&userInput); err != nil {
-				fmt.Printf("Unable to get response\n")
-				return
-			}
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(deleteComponentNames) != 0 {
+			return deleteComponents(deleteComponentNames)
+		}
 
-			if userInput != "y" && userInput != "yes" {
-				return
+		if !skipConfirmDelete && !deleteDryRun && !confirm("Are you sure you want to delete onepanel?") {
+			return nil
+		}
+
+		// A dry run changes nothing, it does not need the lock. Taking it would create the Lease.
+		var lock *util.DeploymentLock
+		if !deleteDryRun {
+			var err error
+			lock, err = acquireDeploymentLock("delete")
+			if err != nil {
+				return clusterError(nil, "delete", err)
 			}
+			defer releaseDeploymentLock(lock)
 		}
 
-		config, err := opConfig.FromFile("config.yaml")
+		inventory, err := loadClusterInventory()
 		if err != nil {
-			fmt.Printf("Unable to read configuration file: %v", err.Error())
-			return
+			return clusterError(nil, "delete", fmt.Errorf("unable to read the deployment inventory from the cluster: %w", err))
+		}
+
+		if inventory == nil {
+			return deleteFromLocalFiles(lock)
 		}
 
-		paramsYamlFile, err := util.LoadDynamicYamlFromFile(config.Spec.Params)
+		paramsYamlFile, err := util.LoadDynamicYamlFromString(inventory.Params)
 		if err != nil {
-			fmt.Println("Error parsing configuration file.")
-			return
+			return fmt.Errorf("unable to parse params from the deployment inventory: %w", err)
+		}
+		if err := validateDeleteNamespace(paramsYamlFile, "deployment inventory"); err != nil {
+			return &ValidationError{Err: err}
 		}
 
-		defaultNamespaceNode := paramsYamlFile.GetValue("application.defaultNamespace")
-		if defaultNamespaceNode == nil {
-			fmt.Printf("application.defaultNamespace is missing from your '%s' file\n", config.Spec.Params)
-			return
+		client, err := newDeleteClusterClient(lock)
+		if err != nil {
+			return clusterError(paramsYamlFile, "delete", err)
 		}
 
-		if defaultNamespaceNode.Value == "default" {
-			fmt.Println("Unable to delete onepanel in the 'default' namespace")
-			return
+		fmt.Printf("Deleting onepanel from your cluster...\n")
+		err = deleteResources(client,
+			util.InventoryResourcesToUnstructured(inventory.Resources),
+			util.InventoryResourcesToUnstructured(inventory.ApplicationResources),
+		)
+		if err != nil {
+			return clusterError(paramsYamlFile, "delete", fmt.Errorf("unable to delete: %w", err))
+		}
+		if deleteDryRun {
+			return nil
 		}
 
-		if defaultNamespaceNode.Value == "<namespace>" {
-			fmt.Println("Unable to delete onepanel. No namespace set.")
-			return
+		store, err := newInventoryStore()
+		if err != nil {
+			return fmt.Errorf("unable to delete the deployment inventory: %w", err)
+		}
+		if err := store.Delete(); err != nil {
+			return fmt.Errorf("unable to delete the deployment inventory: %w", err)
+		}
+		if err := store.DeleteRevisions(); err != nil {
+			fmt.Printf("Unable to delete the revision history: %v\n", err.Error())
 		}
 
-		filesToDelete := []string{
-			filepath.Join(".onepanel", "kubernetes.yaml"),
-			filepath.Join(".onepanel", "application.kubernetes.yaml"),
+		secretStore, err := newGeneratedSecretStore()
+		if err == nil {
+			err = secretStore.Delete()
+		}
+		if err != nil {
+			fmt.Printf("Unable to delete the generated secrets: %v\n", err.Error())
 		}
 
-		for _, filePath := range filesToDelete {
-			exists, err := files.Exists(filePath)
-			if err != nil {
-				fmt.Printf("Error checking if onepanel files exist: %v\n", err.Error())
-				return
-			}
+		return nil
+	},
+}
 
-			if !exists {
-				fmt.Printf("'%v' file does not exist. Are you in the directory where you ran 'opctl init'?\n", filePath)
-				return
-			}
+// deleteFromLocalFiles deletes a deployment that was applied before opctl recorded an inventory in the cluster, while
+// lock is held. The rendered files in .onepanel are used to find the resources.
+func deleteFromLocalFiles(lock *util.DeploymentLock) error {
+	config, err := opConfig.FromFile("config.yaml")
+	if err != nil {
+		return configErrorf("unable to read configuration file: %v", err.Error())
+	}
+
+	paramsYamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+	if err != nil {
+		return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+	}
+
+	if err := validateDeleteNamespace(paramsYamlFile, fmt.Sprintf("'%s' file", config.Spec.Params)); err != nil {
+		return &ValidationError{Err: err}
+	}
+
+	filesToDelete := []string{
+		filepath.Join(".onepanel", "kubernetes.yaml"),
+		filepath.Join(".onepanel", "application.kubernetes.yaml"),
+	}
+
+	for _, filePath := range filesToDelete {
+		exists, err := files.Exists(filePath)
+		if err != nil {
+			return fmt.Errorf("error checking if onepanel files exist: %w", err)
 		}
 
-		fmt.Printf("Deleting onepanel from your cluster...\n")
-		for _, filePath := range filesToDelete {
-			if err := util.KubectlDelete(filePath); err != nil {
-				fmt.Printf("Unable to delete: %v\n", err.Error())
-				return
-			}
+		if !exists {
+			return configErrorf("'%v' file does not exist. Are you in the directory where you ran 'opctl init'?", filePath)
 		}
-	},
+	}
+
+	groups := make([][]*unstructured.Unstructured, 0)
+	for _, filePath := range filesToDelete {
+		resources, err := util.ParseResourcesFromFile(filePath)
+		if err != nil {
+			return fmt.Errorf("unable to parse file '%v': %w", filePath, err)
+		}
+		groups = append(groups, resources)
+	}
+
+	client, err := newDeleteClusterClient(lock)
+	if err != nil {
+		return clusterError(paramsYamlFile, "delete", err)
+	}
+
+	fmt.Printf("Deleting onepanel from your cluster...\n")
+	if err := deleteResources(client, groups...); err != nil {
+		return clusterError(paramsYamlFile, "delete", fmt.Errorf("unable to delete: %w", err))
+	}
+
+	return nil
+}
+
+// newDeleteClusterClient creates the client delete uses, it stops deleting once lock is lost.
+// With --dry-run there is no lock, and it only prints what would be deleted.
+func newDeleteClusterClient(lock *util.DeploymentLock) (util.ClusterClient, error) {
+	client, err := newClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if deleteDryRun {
+		return util.NewDryRunClusterClient(client, os.Stdout), nil
+	}
+
+	return util.NewLockedClusterClient(client, lock), nil
+}
+
+// confirm asks the user a yes/no question. Only 'y' or 'yes' count as yes.
+func confirm(question string) bool {
+	fmt.Printf("%v ('y' or 'yes' to confirm. Anything else to cancel): ", question)
+	userInput := ""
+	if _, err := fmt.Scanln(&userInput); err != nil {
+		fmt.Printf("Unable to get response\n")
+		return false
+	}
+
+	return userInput == "y" || userInput == "yes"
+}
+
+// validateDeleteNamespace makes sure the params have a namespace that is safe to delete.
+// source describes where the params came from, for error messages.
+func validateDeleteNamespace(paramsYamlFile *util.DynamicYaml, source string) error {
+	defaultNamespaceNode := paramsYamlFile.GetValue("application.defaultNamespace")
+	if defaultNamespaceNode == nil {
+		return fmt.Errorf("application.defaultNamespace is missing from your %s", source)
+	}
+
+	if defaultNamespaceNode.Value == "default" {
+		return fmt.Errorf("Unable to delete onepanel in the 'default' namespace")
+	}
+
+	if defaultNamespaceNode.Value == "<namespace>" {
+		return fmt.Errorf("Unable to delete onepanel. No namespace set.")
+	}
+
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().BoolVarP(&skipConfirmDelete, "yes", "y", false, "Add this in to skip the confirmation prompt")
+	deleteCmd.Flags().BoolVarP(&forceUnlock, "force-unlock", "", false, "Take the deployment lock even if someone else holds it. Only use this if they are no longer running")
+	deleteCmd.Flags().BoolVarP(&deleteDryRun, "dry-run", "", false, "Print the resources that would be deleted without deleting them")
+	deleteCmd.Flags().StringSliceVarP(&deleteComponentNames, "component", "", nil, "Only delete these components, e.g. --component modeldb. Can be repeated")
+}
+
+// deleteComponents deletes some of the components of the deployment in the inventory.
+// Components that other components depend on are not deleted, unless those are deleted as well.
+func deleteComponents(names []string) error {
+	var lock *util.DeploymentLock
+	if !deleteDryRun {
+		var err error
+		lock, err = acquireDeploymentLock("delete --component")
+		if err != nil {
+			return clusterError(nil, "delete", err)
+		}
+		defer releaseDeploymentLock(lock)
+	}
+
+	inventory, err := loadClusterInventory()
+	if err != nil {
+		return clusterError(nil, "delete", fmt.Errorf("unable to read the deployment inventory from the cluster: %w", err))
+	}
+	if inventory == nil {
+		return fmt.Errorf("unable to delete components. The deployment was not applied with this version of opctl, run 'opctl apply' first")
+	}
+
+	deployedComponents := make([]string, 0)
+	componentResources := make(map[string][]*unstructured.Unstructured)
+	for _, component := range inventory.Components {
+		deployedComponents = append(deployedComponents, component.Name)
+		componentResources[component.Name] = util.InventoryResourcesToUnstructured(component.Resources)
+	}
+
+	components, err := resolveComponents(deployedComponents, names)
+	if err != nil {
+		return &ValidationError{Err: err}
+	}
+
+	dependencies := util.ComponentDependencies(componentResources)
+	for _, component := range components {
+		dependents := make([]string, 0)
+		for _, dependent := range util.ComponentDependents(dependencies, component) {
+			if !containsString(components, dependent) {
+				dependents = append(dependents, dependent)
+			}
+		}
+
+		if len(dependents) != 0 {
+			return validationErrorf("unable to delete %v, these components depend on it: %v. Delete them as well, or remove them first",
+				component, strings.Join(dependents, ", "))
+		}
+	}
+
+	if !skipConfirmDelete && !deleteDryRun && !confirm(fmt.Sprintf("Are you sure you want to delete %v?", strings.Join(components, ", "))) {
+		return nil
+	}
+
+	// Resources that components which are not deleted render as well are kept
+	keptResources := make([]*unstructured.Unstructured, 0)
+	for _, component := range deployedComponents {
+		if !containsString(components, component) {
+			keptResources = append(keptResources, componentResources[component]...)
+		}
+	}
+
+	resources := make([]*unstructured.Unstructured, 0)
+	applicationResources := make([]*unstructured.Unstructured, 0)
+	for _, component := range components {
+		if component == applicationComponentName {
+			applicationResources = util.ResourcesNotIn(componentResources[component], keptResources)
+			continue
+		}
+		resources = append(resources, util.ResourcesNotIn(componentResources[component], keptResources)...)
+	}
+
+	client, err := newDeleteClusterClient(lock)
+	if err != nil {
+		return clusterError(nil, "delete", err)
+	}
+
+	fmt.Printf("Deleting %v from your cluster...\n", strings.Join(components, ", "))
+	if err := deleteResources(client, resources, applicationResources); err != nil {
+		return clusterError(nil, "delete", fmt.Errorf("unable to delete: %w", err))
+	}
+	if deleteDryRun {
+		return nil
+	}
+
+	for _, component := range components {
+		removeInventoryComponent(inventory, component)
+	}
+
+	store, err := newInventoryStore()
+	if err == nil {
+		err = store.Save(inventory)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to update the deployment inventory: %w", err)
+	}
+
+	return nil
 }
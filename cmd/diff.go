@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/files"
+	"github.com/onepanelio/cli/util"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var diffCmd = &cobra.Command{
+	Use:     "diff",
+	Short:   "Shows the changes apply would make to your Kubernetes cluster.",
+	Long:    "Renders the application YAML and compares it with the live cluster. Nothing is changed in the cluster.",
+	Example: "diff",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := opConfig.FromFile("config.yaml")
+		if err != nil {
+			return configErrorf("unable to read configuration file: %v", err.Error())
+		}
+
+		client, err := newClusterClient()
+		if err != nil {
+			return clusterError(nil, "diff", err)
+		}
+		loadGeneratedSecrets(client, false)
+
+		applicationResult, result, err := generateApplicationResults(config, nil)
+		if err != nil {
+			return kustomizeError(err)
+		}
+
+		deployment, err := deploymentName(config)
+		if err != nil {
+			return &ValidationError{Err: err}
+		}
+
+		if err := printDeploymentDiff(client, deployment, nil, applicationResult, result); err != nil {
+			return clusterError(nil, "diff", fmt.Errorf("unable to diff deployment: %w", err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolVarP(&Dev, "latest", "", false, "Sets conditions to allow development/latest testing.")
+}
+
+// printDeploymentDiff compares the rendered phases of a deployment with the cluster and prints a diff per resource.
+// Resources from the last apply that are no longer rendered, and are owned by deployment, are shown as pruned.
+// If components are given, only their resources from the last apply are considered.
+func printDeploymentDiff(client util.ClusterClient, deployment string, components []string, applicationResult, result string) error {
+	rendered := make([]*unstructured.Unstructured, 0)
+	for _, content := range []string{applicationResult, result} {
+		resources, err := util.ParseResources(content)
+		if err != nil {
+			return err
+		}
+		rendered = append(rendered, resources...)
+	}
+
+	previous, err := previousResources(components)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := client.ResourceDiffer(deployment).Diff(rendered, previous)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, diff := range diffs {
+		counts[diff.Action]++
+		if diff.Action == util.DiffActionUnchanged {
+			continue
+		}
+
+		fmt.Printf("%v (%v)\n%v\n", util.ResourceDisplayName(diff.Resource), diff.Action, diff.Diff)
+	}
+
+	fmt.Printf("%v to create, %v to update, %v to prune, %v unchanged.\n",
+		counts[util.DiffActionCreate], counts[util.DiffActionUpdate], counts[util.DiffActionPrune], counts[util.DiffActionUnchanged])
+
+	return nil
+}
+
+// previousResources returns the resources of the last apply. They are read from the inventory in the cluster,
+// or from the files in .onepanel for deployments that were applied before the inventory existed.
+// If components, paths of components in config.yaml, are given only their resources are returned.
+// The files in .onepanel do not record components, so nothing is returned for components without an inventory.
+func previousResources(components []string) ([]*unstructured.Unstructured, error) {
+	inventory, err := loadClusterInventory()
+	if err != nil {
+		return nil, err
+	}
+	if inventory != nil && len(components) != 0 {
+		names := componentNames(components)
+		previous := make([]*unstructured.Unstructured, 0)
+		for _, component := range inventory.Components {
+			if containsString(names, component.Name) {
+				previous = append(previous, util.InventoryResourcesToUnstructured(component.Resources)...)
+			}
+		}
+		return previous, nil
+	}
+	if inventory != nil {
+		previous := util.InventoryResourcesToUnstructured(inventory.ApplicationResources)
+		return append(previous, util.InventoryResourcesToUnstructured(inventory.Resources)...), nil
+	}
+	if len(components) != 0 {
+		return []*unstructured.Unstructured{}, nil
+	}
+
+	previous := make([]*unstructured.Unstructured, 0)
+	for _, filePath := range []string{
+		filepath.Join(".onepanel", "application.kubernetes.yaml"),
+		filepath.Join(".onepanel", "kubernetes.yaml"),
+	} {
+		exists, err := files.Exists(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		resources, err := util.ParseResourcesFromFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, resources...)
+	}
+
+	return previous, nil
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/util"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// onepanelComponentName is the component of the onepanel API and web UI
+var onepanelComponentName = filepath.Join("common", "onepanel")
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnoses problems with your running deployment.",
+	Long: "Checks the external address of the istio ingress gateway and the DNS records that point to it, " +
+		"the cert-manager Certificates, the artifact repository secret and the onepanel API pods. " +
+		"Each failing check comes with a way to fix it.",
+	Example: "doctor",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := opConfig.FromFile("config.yaml")
+		if err != nil {
+			return configErrorf("unable to read configuration file: %v", err.Error())
+		}
+
+		yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+		if err != nil {
+			return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+		}
+
+		client, err := newClusterClient()
+		if err != nil {
+			return clusterError(yamlFile, "doctor", err)
+		}
+
+		options, err := doctorOptions(config, yamlFile)
+		if err != nil {
+			return clusterError(yamlFile, "doctor", err)
+		}
+
+		results, err := util.NewDoctor(client).Run(options)
+		if err != nil {
+			return clusterError(yamlFile, "doctor", fmt.Errorf("unable to run checks: %w", err))
+		}
+
+		printDoctorResults(results)
+
+		if util.DoctorFailed(results) {
+			return fmt.Errorf("your deployment has problems, see the remediations above")
+		}
+		fmt.Println("\nNo problems found.")
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorOptions describes the deployment of config to the doctor.
+// The onepanel resources come from the inventory in the cluster, or are rendered if there is none.
+func doctorOptions(config *opConfig.Config, yamlFile *util.DynamicYaml) (util.DoctorOptions, error) {
+	options := util.DoctorOptions{}
+
+	missing := yamlFile.FindMissingKeys("application.defaultNamespace", "application.fqdn", "application.provider")
+	if len(missing) != 0 {
+		return options, validationErrorf("missing required values in params.yaml: %v", strings.Join(missing, ", "))
+	}
+
+	url, err := util.GetDeployedWebURL(yamlFile)
+	if err != nil {
+		return options, &ValidationError{Err: err}
+	}
+	insecure, _ := strconv.ParseBool(yamlFile.GetValue("application.insecure").Value)
+	provider := yamlFile.GetValue("application.provider").Value
+
+	options.Namespace = yamlFile.GetValue("application.defaultNamespace").Value
+	options.URL = url
+	options.FQDN = yamlFile.GetValue("application.fqdn").Value
+	options.LocalProvider = provider == "minikube" || provider == "microk8s"
+	for _, component := range componentNames(config.Spec.Components) {
+		if path.Base(component) == "cert-manager" {
+			options.CertManager = !insecure
+		}
+	}
+
+	resources, err := onepanelResources(config)
+	if err != nil {
+		return options, err
+	}
+	options.OnepanelResources = resources
+
+	return options, nil
+}
+
+// onepanelResources returns the resources of the onepanel component, from the inventory if there is one
+func onepanelResources(config *opConfig.Config) ([]*unstructured.Unstructured, error) {
+	inventory, err := loadClusterInventory()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the deployment inventory from the cluster: %w", err)
+	}
+	if inventory != nil {
+		for _, component := range inventory.Components {
+			if component.Name == onepanelComponentName {
+				return util.InventoryResourcesToUnstructured(component.Resources), nil
+			}
+		}
+	}
+
+	componentResults, err := GenerateComponentResults(*config, filepath.Join(onepanelComponentName, "base"))
+	if err != nil {
+		return nil, kustomizeError(err)
+	}
+
+	return util.ParseResources(componentResults[onepanelComponentName])
+}
+
+func printDoctorResults(results []util.DoctorResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "CHECK\tSTATUS\tMESSAGE")
+	for _, result := range results {
+		fmt.Fprintf(writer, "%v\t%v\t%v\n", result.Check, strings.ToUpper(string(result.Status)), result.Message)
+	}
+	writer.Flush()
+
+	for _, result := range results {
+		if result.Remediation == "" {
+			continue
+		}
+
+		fmt.Printf("\nTo fix %v:\n  %v\n", result.Check, result.Remediation)
+	}
+}
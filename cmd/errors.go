@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/onepanelio/cli/util"
+)
+
+// Exit codes of opctl, so scripts can tell failures apart
+const (
+	// ExitCodeError is for failures that have no specific exit code
+	ExitCodeError = 1
+	// ExitCodeConfigError means config.yaml or params.yaml could not be read
+	ExitCodeConfigError = 2
+	// ExitCodeValidationError means the arguments, flags or params are not valid
+	ExitCodeValidationError = 3
+	// ExitCodeClusterUnreachable means the Kubernetes cluster could not be reached
+	ExitCodeClusterUnreachable = 4
+	// ExitCodeTimeout means the cluster did not become ready in time
+	ExitCodeTimeout = 5
+)
+
+// ConfigError is returned when config.yaml or params.yaml can not be read
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when the arguments, flags or params are not valid
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ClusterUnreachableError is returned when the Kubernetes cluster can not be reached.
+// Hint, if set, tells the user how to fix it.
+type ClusterUnreachableError struct {
+	Err  error
+	Hint string
+}
+
+func (e *ClusterUnreachableError) Error() string {
+	if e.Hint == "" {
+		return fmt.Sprintf("unable to connect to cluster: %v", e.Err.Error())
+	}
+
+	return fmt.Sprintf("unable to connect to cluster. %v\n%v", e.Hint, e.Err.Error())
+}
+
+func (e *ClusterUnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// configErrorf returns a *ConfigError with the formatted message
+func configErrorf(format string, args ...interface{}) error {
+	return &ConfigError{Err: fmt.Errorf(format, args...)}
+}
+
+// validationErrorf returns a *ValidationError with the formatted message
+func validationErrorf(format string, args ...interface{}) error {
+	return &ValidationError{Err: fmt.Errorf(format, args...)}
+}
+
+// clusterError classifies an error returned by the cluster. If the cluster could not be reached a *ClusterUnreachableError
+// is returned, with a hint for microk8s, where the kubeconfig has to be passed explicitly. command is used in the hint.
+func clusterError(yamlFile *util.DynamicYaml, command string, err error) error {
+	if err == nil || !util.IsClusterUnreachable(err) {
+		return err
+	}
+
+	result := &ClusterUnreachableError{Err: err}
+	if yamlFile != nil {
+		if provider := yamlFile.GetValue("application.provider"); provider != nil && provider.Value == "microk8s" {
+			result.Hint = fmt.Sprintf("Make sure you are running with \nopctl %v --kubeconfig ./kubeconfig", command)
+		}
+	}
+
+	return result
+}
+
+// exitCode returns the exit code for err, see the ExitCode constants.
+// Only errors classified by clusterError count as an unreachable cluster, other network errors, e.g. of GitHub, do not.
+func exitCode(err error) int {
+	var configErr *ConfigError
+	var validationErr *ValidationError
+	var clusterErr *ClusterUnreachableError
+	var notReadyErr *util.NotReadyError
+	var notEstablishedErr *util.NotEstablishedError
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &configErr):
+		return ExitCodeConfigError
+	case errors.As(err, &validationErr):
+		return ExitCodeValidationError
+	case errors.As(err, &notReadyErr), errors.As(err, &notEstablishedErr):
+		return ExitCodeTimeout
+	case errors.As(err, &clusterErr):
+		return ExitCodeClusterUnreachable
+	}
+
+	return ExitCodeError
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/onepanelio/cli/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_exitCode(t *testing.T) {
+	connectionErr := &url.Error{
+		Op:  "Get",
+		URL: "https://127.0.0.1:6443/api",
+		Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+	}
+
+	assert.Equal(t, 0, exitCode(nil))
+	assert.Equal(t, ExitCodeError, exitCode(errors.New("failed")))
+	assert.Equal(t, ExitCodeConfigError, exitCode(configErrorf("unable to read configuration file")))
+	assert.Equal(t, ExitCodeValidationError, exitCode(fmt.Errorf("invalid: %w", validationErrorf("bad value"))))
+	assert.Equal(t, ExitCodeClusterUnreachable, exitCode(&ClusterUnreachableError{Err: errors.New("no route")}))
+	assert.Equal(t, ExitCodeClusterUnreachable, exitCode(clusterError(nil, "diff", fmt.Errorf("unable to diff deployment: %w", connectionErr))))
+	// Network errors that are not classified by clusterError, e.g. of GitHub, are not about the cluster
+	githubErr := &url.Error{Op: "Get", URL: "https://api.github.com/repos/onepanelio/manifests/releases/latest", Err: &net.DNSError{Err: "no such host", Name: "api.github.com"}}
+	assert.Equal(t, ExitCodeError, exitCode(fmt.Errorf("unable to get the latest release: %w", githubErr)))
+	assert.Equal(t, ExitCodeError, exitCode(fmt.Errorf("unable to diff deployment: %w", connectionErr)))
+	assert.Equal(t, ExitCodeTimeout, exitCode(&util.NotReadyError{Timeout: time.Minute}))
+	assert.Equal(t, ExitCodeTimeout, exitCode(&util.NotEstablishedError{Name: "workflows.argoproj.io", Timeout: time.Minute}))
+}
+
+func Test_clusterError(t *testing.T) {
+	yamlFile, err := util.LoadDynamicYamlFromString("application:\n  provider: microk8s\n")
+	assert.Nil(t, err)
+
+	assert.Nil(t, clusterError(yamlFile, "apply", nil))
+
+	otherErr := errors.New("forbidden")
+	assert.Equal(t, otherErr, clusterError(yamlFile, "apply", otherErr))
+
+	result := clusterError(yamlFile, "apply", errors.New("dial tcp 127.0.0.1:16443: connection refused"))
+	clusterErr, ok := result.(*ClusterUnreachableError)
+	assert.True(t, ok)
+	assert.Contains(t, clusterErr.Hint, "opctl apply --kubeconfig ./kubeconfig")
+}
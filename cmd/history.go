@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:     "history",
+	Short:   "Lists the revisions of your deployment.",
+	Long:    "Lists every recorded apply and rollback of your deployment, oldest first. Use the revision number with 'opctl rollback'.",
+	Example: "history",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := newInventoryStore()
+		if err != nil {
+			return clusterError(nil, "history", err)
+		}
+
+		revisions, err := store.Revisions()
+		if err != nil {
+			return clusterError(nil, "history", fmt.Errorf("unable to read the revision history: %w", err))
+		}
+		if len(revisions) == 0 {
+			fmt.Println("No revisions found. Revisions are recorded by 'opctl apply'.")
+			return nil
+		}
+
+		inventory, err := store.Load()
+		if err != nil {
+			return clusterError(nil, "history", fmt.Errorf("unable to read the deployment inventory: %w", err))
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "REVISION\tAPPLIED\tUSER\tMANIFESTS\tCLI\tDESCRIPTION")
+		for _, revision := range revisions {
+			description := "Apply"
+			if revision.RollbackOf != 0 {
+				description = fmt.Sprintf("Rollback to %v", revision.RollbackOf)
+			}
+			if inventory != nil && inventory.Revision == revision.Revision {
+				description += " (current)"
+			}
+
+			fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\n", revision.Revision,
+				revision.AppliedAt.Local().Format(time.RFC822), revision.User,
+				revision.ManifestsTag, revision.CLIVersion, description)
+		}
+		writer.Flush()
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+}
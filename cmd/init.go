@@ -35,6 +35,7 @@ var (
 	EnableHTTPS                bool
 	EnableCertManager          bool
 	EnableMetalLb              bool
+	Offline                    bool
 	GPUDevicePlugins           []string
 	Services                   []string
 )
@@ -65,64 +66,66 @@ var providerProperties = map[string]ProviderProperties{
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Gets latest manifests and generates params.yaml file.",
-	Run: func(cmd *cobra.Command, args []string) {
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := validateInput(); err != nil {
-			log.Println(err.Error())
-			return
+			return &ValidationError{Err: err}
 		}
 
 		log.Printf("Initializing...")
 		configFile := filepath.Join(".onepanel", "cli_config.yaml")
 		exists, err := files.Exists(configFile)
 		if err != nil {
-			log.Printf("[error] checking for config file %v", configFile)
-			return
+			return fmt.Errorf("checking for config file %v: %v", configFile, err.Error())
 		}
 
 		if !exists {
 			if err := manifest.CreateGithubSourceConfigFile(configFile); err != nil {
-				log.Printf("[error] creating default source config: %v", err.Error())
-				return
+				return fmt.Errorf("creating default source config: %v", err.Error())
 			}
 		}
 
 		source, err := manifest.LoadManifestSourceFromFileConfig(configFile)
 		if err != nil {
-			log.Printf("[error] loading manifest source: %v", err.Error())
-			return
+			return fmt.Errorf("loading manifest source: %v", err.Error())
 		}
 
 		// When updating cli versions, the cli_config.yaml may already exist.
 		// Check if we need to generate a new cli_config.yaml, to match the cli version.
+		// Forks have their own tags, they are kept.
 		tag := config.ManifestsRepositoryTag
-		if source.GetSourceType() == manifest.SourceGithub {
+		if githubSource, ok := source.(*manifest.GithubSource); ok && !githubSource.IsDefaultRepository() {
+			fmt.Printf("cli_config.yaml is using the repository %v as source, ignoring CLI tag: %v\n", githubSource.GetRepository(), tag)
+		} else if source.GetSourceType() == manifest.SourceGithub {
 			if source.GetTag() != "" {
 				if tag != source.GetTag() {
 					if err := manifest.CreateGithubSourceConfigFile(configFile); err != nil {
-						log.Printf("[error] creating default source config: %v", err.Error())
-						return
+						return fmt.Errorf("creating default source config: %v", err.Error())
 					}
 					source, err = manifest.LoadManifestSourceFromFileConfig(configFile)
 					if err != nil {
-						log.Printf("[error] loading manifest source: %v", err.Error())
-						return
+						return fmt.Errorf("loading manifest source: %v", err.Error())
 					}
 				}
 			}
 		} else {
-			fmt.Printf("cli_config.yaml is using %v as source, ignoring CLI tag: %v", manifest.SourceDirectory, config.CLIVersion)
+			fmt.Printf("cli_config.yaml is using %v as source, ignoring CLI tag: %v\n", source.GetSourceType(), config.CLIVersion)
 		}
 
+		source.SetOffline(Offline)
 		if err := source.MoveToDirectory(filepath.Join(manifestsFilePath)); err != nil {
-			log.Printf("[error] %v", err.Error())
-			return
+			if errors.Is(err, manifest.ErrNotCached) {
+				return &ConfigError{Err: err}
+			}
+			return err
 		}
 
 		manifestsRepoPath, err := source.GetManifestPath()
 		if err != nil {
-			log.Printf("[error] %v", err.Error())
-			return
+			return err
+		}
+
+		if gitSource, ok := source.(*manifest.GitSource); ok {
+			fmt.Printf("Using the manifests of %v at commit %v\n", gitSource.GetRepository(), gitSource.GetCommit())
 		}
 
 		if err := files.CreateIfNotExist(ParametersFilePath); err != nil {
@@ -146,33 +149,28 @@ var initCmd = &cobra.Command{
 
 		bld := manifest.CreateBuilder(loadedManifest)
 		if err := bld.AddCommonComponents(); err != nil {
-			log.Printf("[error] AddCommonComponents %v", err.Error())
-			return
+			return fmt.Errorf("adding common components: %v", err.Error())
 		}
 
 		bld.AddOverlayContender(ArtifactRepositoryProvider)
 
 		if err := addCloudProviderToManifestBuilder(Provider, bld); err != nil {
-			log.Printf("[error] Adding Cloud Provider: %v", err.Error())
-			return
+			return fmt.Errorf("adding Cloud Provider: %v", err.Error())
 		}
 
 		if err := addDNSProviderToManifestBuilder(DNS, bld); err != nil {
-			log.Printf("[error] Adding Dns Provider: %v", err.Error())
-			return
+			return fmt.Errorf("adding Dns Provider: %v", err.Error())
 		}
 
 		if EnableEFKLogging {
 			if err := bld.AddComponent("logging"); err != nil {
-				log.Printf("[error] Adding logging component: %v", err.Error())
-				return
+				return fmt.Errorf("adding logging component: %v", err.Error())
 			}
 		}
 
 		if GPUDevicePlugins != nil {
 			if err := bld.AddComponent("gpu-plugins"); err != nil {
-				log.Printf("[error] Adding GPU plugins component: %v", err.Error())
-				return
+				return fmt.Errorf("adding GPU plugins component: %v", err.Error())
 			}
 
 			for i, d := range GPUDevicePlugins {
@@ -199,14 +197,12 @@ var initCmd = &cobra.Command{
 		if Provider == "eks" {
 			overlay := strings.Join([]string{"cluster-autoscaler", "overlays", "eks"}, string(os.PathSeparator))
 			if err := bld.AddOverlay(overlay); err != nil {
-				log.Printf("[error] Adding overlay %v:\n", err.Error())
-				return
+				return fmt.Errorf("adding overlay: %v", err.Error())
 			}
 		}
 
 		if err := bld.Build(); err != nil {
-			log.Printf("[error] building components and overlays: %v", err.Error())
-			return
+			return fmt.Errorf("building components and overlays: %v", err.Error())
 		}
 
 		for _, overlayComponent := range bld.GetOverlayComponents() {
@@ -218,14 +214,14 @@ var initCmd = &cobra.Command{
 
 		builder := template.NewBuilderFromConfig(setup)
 		if err := builder.Build(); err != nil {
-			log.Printf("err generating config. Error %v", err.Error())
-			return
+			return fmt.Errorf("generating config: %v", err.Error())
 		}
 
+		// Not util.LoadParamsFromFile, encrypted values and references to environment variables and files
+		// are written back as they are
 		mergedParams, err := util.LoadDynamicYamlFromFile(ParametersFilePath)
 		if err != nil {
-			log.Printf("[error] loading params file: %v", err.Error())
-			return
+			return fmt.Errorf("loading params file: %v", err.Error())
 		}
 
 		mergedParams.Merge(bld.GetYamls()...)
@@ -242,41 +238,34 @@ var initCmd = &cobra.Command{
 		inputCommand += "# Command: opctl " + strings.Join(os.Args[1:], " ") + "\n"
 		inputCommand += "# - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -"
 		if err := mergedParams.SetTopComment(inputCommand); err != nil {
-			log.Printf("[error] setting comments: %v", err.Error())
-			return
+			return fmt.Errorf("setting comments: %v", err.Error())
 		}
 		paramsString, err := mergedParams.String()
 		if err != nil {
-			log.Printf("[error] unable to write params to a string")
-			return
+			return fmt.Errorf("unable to write params to a string: %v", err.Error())
 		}
 
 		paramsFile, err := os.OpenFile(ParametersFilePath, os.O_RDWR|os.O_TRUNC, 0)
 		if err != nil {
-			log.Printf("Error opening parameters file: %v", err.Error())
-			return
+			return fmt.Errorf("error opening parameters file: %v", err.Error())
 		}
 
 		if _, err := paramsFile.WriteString(paramsString); err != nil {
-			log.Printf("Error writing merged parameters: %v", err.Error())
-			return
+			return fmt.Errorf("error writing merged parameters: %v", err.Error())
 		}
 
 		file, err := os.Create(ConfigurationFilePath)
 		if err != nil {
-			log.Printf("unable to create %v file: %v", ConfigurationFilePath, err.Error())
-			return
+			return fmt.Errorf("unable to create %v file: %v", ConfigurationFilePath, err.Error())
 		}
 
 		setupData, err := yaml.Marshal(setup)
 		if err != nil {
-			log.Printf("unable to marshal yaml data: %v", err.Error())
-			return
+			return fmt.Errorf("unable to marshal yaml data: %v", err.Error())
 		}
 
 		if _, err := file.Write(setupData); err != nil {
-			log.Printf("unable to write yaml data: %v", err.Error())
-			return
+			return fmt.Errorf("unable to write yaml data: %v", err.Error())
 		}
 
 		fmt.Printf("Configuration has been created with\n")
@@ -288,6 +277,8 @@ var initCmd = &cobra.Command{
 
 		fmt.Printf("- Configuration file: %v\n", ConfigurationFilePath)
 		fmt.Printf("- Parameters file has been created with placeholders: %v\n", ParametersFilePath)
+
+		return nil
 	},
 }
 
@@ -304,6 +295,7 @@ func init() {
 	initCmd.Flags().BoolVarP(&EnableCertManager, "enable-cert-manager", "", false, "Automatically create/renew TLS certs using Let's Encrypt")
 	initCmd.Flags().BoolVarP(&EnableMetalLb, "enable-metallb", "", false, "Automatically create a LoadBalancer for non-cloud deployments.")
 	initCmd.Flags().StringSliceVarP(&GPUDevicePlugins, "gpu-device-plugins", "", nil, "Install NVIDIA and/or AMD gpu device plugins. Valid values can be comma separated and are: amd, nvidia")
+	initCmd.Flags().BoolVarP(&Offline, "offline", "", false, "Only use the cached manifests in "+manifestsFilePath+", fail if they are not cached")
 	initCmd.Flags().StringSliceVarP(&Services, "services", "", nil, "Install additional services. Valid values can be comma separated and are: modeldb")
 }
 
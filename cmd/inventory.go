@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"time"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newInventoryStore creates the store of the inventory in the cluster of newClusterClient
+func newInventoryStore() (*util.InventoryStore, error) {
+	client, err := newClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewInventoryStore(client.Kubernetes()), nil
+}
+
+// loadClusterInventory returns the inventory of the last apply, or nil if nothing was applied with an inventory yet
+func loadClusterInventory() (*util.Inventory, error) {
+	store, err := newInventoryStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Load()
+}
+
+// recordDeployment records the rendered phases of a deployment in the cluster as a new revision, along with the
+// configuration they were rendered from and the rendered resources of each component. Secret params are redacted.
+func recordDeployment(config *opConfig.Config, configFilePath string, componentResources map[string][]*unstructured.Unstructured, applicationResult, result string) error {
+	configContent, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	paramsYamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+	if err != nil {
+		return err
+	}
+	redactedParams, err := util.RedactSecretParams(paramsYamlFile)
+	if err != nil {
+		return err
+	}
+	params, err := redactedParams.String()
+	if err != nil {
+		return err
+	}
+
+	applicationResources, err := util.ParseResources(applicationResult)
+	if err != nil {
+		return err
+	}
+	resources, err := util.ParseResources(result)
+	if err != nil {
+		return err
+	}
+
+	components := make([]util.InventoryComponent, 0)
+	for _, component := range config.GetOverlayComponents("") {
+		components = append(components, util.InventoryComponent{
+			Name:      component.Name(),
+			Overlays:  component.Overlays(),
+			Resources: util.NewInventoryResources(componentResources[component.Name()]),
+		})
+	}
+
+	store, err := newInventoryStore()
+	if err != nil {
+		return err
+	}
+
+	inventory := &util.Inventory{
+		User:                 currentUser(),
+		CLIVersion:           opConfig.CLIVersion,
+		ManifestsTag:         opConfig.ManifestsRepositoryTag,
+		AppliedAt:            time.Now().UTC(),
+		Config:               string(configContent),
+		Params:               params,
+		ApplicationResources: util.NewInventoryResources(applicationResources),
+		Resources:            util.NewInventoryResources(resources),
+		Components:           components,
+	}
+
+	return store.Record(inventory, applicationResult, result)
+}
+
+// currentUser returns the name of the user running opctl, for the revision history
+func currentUser() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+
+	return "unknown"
+}
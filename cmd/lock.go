@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/onepanelio/cli/util"
+)
+
+var (
+	// forceUnlock if true, the deployment lock is taken even if someone else holds it
+	forceUnlock bool
+)
+
+// acquireDeploymentLock takes the cluster-wide lock for command, so no one else changes the deployment at the same time.
+// The lock names this user, host and command so others know who holds it. Release it with releaseDeploymentLock.
+func acquireDeploymentLock(command string) (*util.DeploymentLock, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	identity := fmt.Sprintf("%v@%v running 'opctl %v' (pid %v)", currentUser(), hostname, command, os.Getpid())
+
+	client, err := newClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	lock := util.NewDeploymentLock(client.Kubernetes(), identity)
+
+	if forceUnlock {
+		fmt.Println("Taking the deployment lock, even if someone else holds it.")
+	}
+	if err := lock.Acquire(forceUnlock); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+func releaseDeploymentLock(lock *util.DeploymentLock) {
+	if err := lock.Release(); err != nil {
+		fmt.Printf("Unable to release the deployment lock, it expires on its own: %v\n", err.Error())
+	}
+}
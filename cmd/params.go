@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// paramsDecryptInPlace if true, params decrypt writes the decrypted params back to params.yaml
+	paramsDecryptInPlace bool
+)
+
+var paramsCmd = &cobra.Command{
+	Use:   "params",
+	Short: "Encrypt and decrypt the values of params.yaml.",
+	Long: "Encrypted values can be committed to git along with params.yaml. They are decrypted in memory by build, apply " +
+		"and the other commands, with the passphrase in " + util.ParamsPassphraseEnv + " or the key file in " +
+		util.ParamsKeyFileEnv + ", " + util.DefaultParamsKeyFile + " by default.",
+	Example: "params encrypt",
+	RunE:    func(cmd *cobra.Command, args []string) error { return cmd.Help() },
+}
+
+var paramsEncryptCmd = &cobra.Command{
+	Use:   "encrypt [key...]",
+	Short: "Encrypts values of params.yaml in place.",
+	Long: "Encrypts the given keys of params.yaml, e.g. database.password, or every secret param if none are given. " +
+		"If " + util.ParamsPassphraseEnv + " is not set and there is no key file, a new key file is created.",
+	Example: "params encrypt artifactRepository.s3.accessKey artifactRepository.s3.secretKey",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := opConfig.FromFile("config.yaml")
+		if err != nil {
+			return configErrorf("unable to read configuration file: %v", err.Error())
+		}
+
+		yamlFile, err := util.LoadDynamicYamlFromFile(config.Spec.Params)
+		if err != nil {
+			return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+		}
+
+		key, err := util.LoadParamsKey()
+		if errors.Is(err, util.ErrNoParamsKey) {
+			keyFilePath := util.ParamsKeyFilePath()
+			if err := util.GenerateParamsKeyFile(keyFilePath); err != nil {
+				return fmt.Errorf("unable to create the key file '%v': %w", keyFilePath, err)
+			}
+			fmt.Printf("Created the key file %v. Keep it safe and out of git, the values can not be decrypted without it.\n", keyFilePath)
+			key, err = util.LoadParamsKey()
+		}
+		if err != nil {
+			return &ConfigError{Err: err}
+		}
+
+		encrypted, err := util.EncryptParams(yamlFile, key, args...)
+		if err != nil {
+			return &ValidationError{Err: err}
+		}
+		if len(encrypted) == 0 {
+			fmt.Println("There are no values to encrypt.")
+			return nil
+		}
+
+		if err := writeParamsFile(config.Spec.Params, yamlFile); err != nil {
+			return err
+		}
+		for _, name := range encrypted {
+			fmt.Printf("Encrypted %v\n", name)
+		}
+
+		return nil
+	},
+}
+
+var paramsDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Prints params.yaml with its values decrypted.",
+	Long: "Prints params.yaml with every encrypted value decrypted. " +
+		"With --in-place the decrypted values are written to params.yaml instead, in plain text.",
+	Example: "params decrypt",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := opConfig.FromFile("config.yaml")
+		if err != nil {
+			return configErrorf("unable to read configuration file: %v", err.Error())
+		}
+
+		// References to environment variables and files are kept, only encrypted values are decrypted
+		yamlFile, err := util.LoadDynamicYamlFromFile(config.Spec.Params)
+		if err != nil {
+			return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+		}
+
+		if util.HasEncryptedParams(yamlFile) {
+			key, err := util.LoadParamsKey()
+			if err != nil {
+				return &ConfigError{Err: err}
+			}
+			if _, err := util.DecryptParams(yamlFile, key); err != nil {
+				return &ConfigError{Err: err}
+			}
+		}
+
+		if paramsDecryptInPlace {
+			return writeParamsFile(config.Spec.Params, yamlFile)
+		}
+
+		content, err := yamlFile.String()
+		if err != nil {
+			return err
+		}
+		fmt.Print(content)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(paramsCmd)
+	paramsCmd.AddCommand(paramsEncryptCmd)
+	paramsCmd.AddCommand(paramsDecryptCmd)
+	paramsDecryptCmd.Flags().BoolVarP(&paramsDecryptInPlace, "in-place", "", false, "Write the decrypted values to params.yaml")
+}
+
+// writeParamsFile replaces the params file, keeping its permissions
+func writeParamsFile(filePath string, yamlFile *util.DynamicYaml) error {
+	content, err := yamlFile.String()
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(filePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := ioutil.WriteFile(filePath, []byte(content), mode); err != nil {
+		return fmt.Errorf("unable to write file '%v': %w", filePath, err)
+	}
+
+	return nil
+}
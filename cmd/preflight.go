@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/util"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Checks if your cluster can run your deployment.",
+	Long: "Checks the Kubernetes version, the default StorageClass, allocatable CPU and memory, GPU node labels, " +
+		"LoadBalancer support and existing installs of Istio, cert-manager and Argo. 'opctl apply' runs these checks as well.",
+	Example: "preflight",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := opConfig.FromFile("config.yaml")
+		if err != nil {
+			return configErrorf("unable to read configuration file: %v", err.Error())
+		}
+
+		yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+		if err != nil {
+			return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+		}
+
+		client, err := newClusterClient()
+		if err != nil {
+			return clusterError(yamlFile, "preflight", err)
+		}
+
+		componentResources, err := generateComponentResources(config, nil)
+		if err != nil {
+			return kustomizeError(err)
+		}
+
+		return clusterError(yamlFile, "preflight", runPreflight(client, config, componentResources))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(preflightCmd)
+}
+
+// runPreflight checks the cluster for the rendered resources of the components, by component name, and prints the results.
+// A *ValidationError is returned if a check failed.
+func runPreflight(client util.ClusterClient, config *opConfig.Config, componentResources map[string][]*unstructured.Unstructured) error {
+	options, err := preflightOptions(config, componentResources)
+	if err != nil {
+		return err
+	}
+
+	results, err := util.NewPreflightChecker(client).Run(options)
+	if err != nil {
+		return fmt.Errorf("unable to run preflight checks: %w", err)
+	}
+
+	printPreflightResults(results)
+
+	if util.PreflightFailed(results) {
+		return validationErrorf("preflight checks failed. Fix them before applying, or skip them with 'opctl apply --skip-preflight'")
+	}
+
+	return nil
+}
+
+// preflightOptions describes the deployment, with the rendered resources of its components, to the preflight checks
+func preflightOptions(config *opConfig.Config, componentResources map[string][]*unstructured.Unstructured) (util.PreflightOptions, error) {
+	options := util.PreflightOptions{
+		Components: componentResources,
+	}
+
+	deployment, err := deploymentName(config)
+	if err != nil {
+		return options, &ValidationError{Err: err}
+	}
+	options.Deployment = deployment
+
+	yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+	if err != nil {
+		return options, configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+	}
+	if provider := yamlFile.GetValue("application.provider"); provider != nil {
+		options.CloudProvider = providerProperties[provider.Value].IsCloud
+	}
+
+	return options, nil
+}
+
+func printPreflightResults(results []util.PreflightResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "CHECK\tSTATUS\tMESSAGE")
+	for _, result := range results {
+		fmt.Fprintf(writer, "%v\t%v\t%v\n", result.Check, strings.ToUpper(string(result.Status)), result.Message)
+	}
+	writer.Flush()
+	fmt.Println()
+}
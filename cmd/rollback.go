@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/onepanelio/cli/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// skipConfirmRollback if true, will skip the confirmation prompt of the rollback command
+	skipConfirmRollback bool
+	// rollbackTimeout is how long rollback waits for the cluster, like applyTimeout for apply
+	rollbackTimeout time.Duration
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <revision>",
+	Short: "Re-applies an earlier revision of your deployment.",
+	Long: "Re-applies the manifests recorded in an earlier revision, see 'opctl history'. " +
+		"Resources that were added after that revision are deleted. The rollback is recorded as a new revision.",
+	Example: "rollback 3",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(1)(cmd, args); err != nil {
+			return &ValidationError{Err: err}
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		revisionNumber, err := strconv.Atoi(args[0])
+		if err != nil || revisionNumber < 1 {
+			return validationErrorf("'%v' is not a valid revision. See 'opctl history' for the revisions", args[0])
+		}
+
+		store, err := newInventoryStore()
+		if err != nil {
+			return clusterError(nil, "rollback", err)
+		}
+
+		lock, err := acquireDeploymentLock("rollback")
+		if err != nil {
+			return clusterError(nil, "rollback", err)
+		}
+		defer releaseDeploymentLock(lock)
+
+		current, err := store.Load()
+		if err != nil {
+			return fmt.Errorf("unable to read the deployment inventory: %w", err)
+		}
+		if current == nil {
+			return fmt.Errorf("nothing has been applied to this cluster yet")
+		}
+
+		revision, err := store.LoadRevision(revisionNumber)
+		if err != nil {
+			return fmt.Errorf("unable to read revision %v: %w", revisionNumber, err)
+		}
+		if revision == nil {
+			return validationErrorf("revision %v does not exist. See 'opctl history' for the revisions", revisionNumber)
+		}
+
+		// Resources that are part of the current deployment, but not of the revision, were added later
+		revisionResources := append(
+			util.InventoryResourcesToUnstructured(revision.Inventory.ApplicationResources),
+			util.InventoryResourcesToUnstructured(revision.Inventory.Resources)...,
+		)
+		pruneResources := util.ResourcesNotIn(util.InventoryResourcesToUnstructured(current.Resources), revisionResources)
+		pruneApplicationResources := util.ResourcesNotIn(util.InventoryResourcesToUnstructured(current.ApplicationResources), revisionResources)
+
+		fmt.Printf("Rolling back from revision %v (manifests %v) to revision %v (manifests %v).\n",
+			current.Revision, current.ManifestsTag, revision.Inventory.Revision, revision.Inventory.ManifestsTag)
+		if len(pruneResources)+len(pruneApplicationResources) != 0 {
+			fmt.Println("The following resources were added after that revision and will be deleted:")
+			for _, resource := range append(pruneResources, pruneApplicationResources...) {
+				fmt.Printf("- %v\n", util.ResourceDisplayName(resource))
+			}
+		}
+		if !skipConfirmRollback && !confirm("Are you sure you want to roll back?") {
+			return nil
+		}
+
+		yamlFile, err := util.LoadDynamicYamlFromString(revision.Inventory.Params)
+		if err != nil {
+			return fmt.Errorf("unable to parse params of revision %v: %w", revisionNumber, err)
+		}
+
+		client, err := newClusterClient()
+		if err != nil {
+			return clusterError(yamlFile, "rollback", err)
+		}
+		// Nothing more is changed once someone else takes the lock over
+		client = util.NewLockedClusterClient(client, lock)
+
+		if err := applyRenderedPhases(client, rollbackTimeout, revision.ApplicationManifests, revision.Manifests); err != nil {
+			return clusterError(yamlFile, "rollback", fmt.Errorf("rollback failed: %w", err))
+		}
+
+		if err := deleteResources(client, pruneResources, pruneApplicationResources); err != nil {
+			return clusterError(yamlFile, "rollback", fmt.Errorf("unable to delete resources that were added after revision %v: %w", revisionNumber, err))
+		}
+
+		inventory := *revision.Inventory
+		inventory.RollbackOf = revisionNumber
+		inventory.User = currentUser()
+		inventory.AppliedAt = time.Now().UTC()
+		if err := store.Record(&inventory, revision.ApplicationManifests, revision.Manifests); err != nil {
+			return fmt.Errorf("unable to record the rollback in the cluster: %w", err)
+		}
+
+		fmt.Printf("\nRolled back to revision %v. This is now revision %v.\n", revisionNumber, inventory.Revision)
+
+		return waitForDeployment(client, rollbackTimeout, util.DeploymentWorkloads(yamlFile))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().BoolVarP(&skipConfirmRollback, "yes", "y", false, "Add this in to skip the confirmation prompt")
+	rollbackCmd.Flags().BoolVarP(&forceUnlock, "force-unlock", "", false, "Take the deployment lock even if someone else holds it. Only use this if they are no longer running")
+	rollbackCmd.Flags().DurationVarP(&rollbackTimeout, "timeout", "", 5*time.Minute, "How long to wait for the cluster to be ready before failing")
+}
+
+// applyRenderedPhases applies the rendered manifests in the same two phases as apply, waiting up to timeout for the
+// cluster in each. Empty phases are skipped.
+func applyRenderedPhases(client util.ClusterClient, timeout time.Duration, applicationManifests, manifests string) error {
+	if applicationManifests != "" {
+		if err := applyResources(client, timeout, applicationManifests); err != nil {
+			return err
+		}
+
+		if err := client.Wait(timeout, applicationControllerWorkload); err != nil {
+			return err
+		}
+	}
+
+	return applyResources(client, timeout, manifests)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/onepanelio/cli/util"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -29,21 +30,39 @@ to quickly create a Cobra application.`,
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// If a command fails, the process exits with the code for its error, see exitCode.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
-	cobra.OnInitialize(initConfig, createHiddenFolder)
+	cobra.OnInitialize(initConfig, createHiddenFolder, initKubeConfig)
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
+	// Errors are printed by Execute. Usage is only shown for invalid flags and arguments, see the FlagErrorFunc
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		cmd.Println(cmd.UsageString())
+		return &ValidationError{Err: err}
+	})
+
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cli.yaml)")
+
+	// The cluster flags can also be set in the config file, under cluster, e.g. cluster.kubeconfig
+	rootCmd.PersistentFlags().String("kubeconfig", "", "Path to the kubeconfig file to use for cluster requests")
+	rootCmd.PersistentFlags().String("context", "", "The name of the kubeconfig context to use")
+	rootCmd.PersistentFlags().StringP("namespace", "n", "", "The namespace of cluster requests that do not name one, e.g. of 'auth token'")
+	rootCmd.PersistentFlags().String("as", "", "Username to impersonate for cluster requests")
+	for _, name := range []string{"kubeconfig", "context", "namespace", "as"} {
+		viper.BindPFlag("cluster."+name, rootCmd.PersistentFlags().Lookup(name))
+	}
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -56,7 +75,7 @@ func initConfig() {
 		home, err := homedir.Dir()
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			os.Exit(ExitCodeConfigError)
 		}
 
 		// Search config in home directory with name ".cli" (without extension).
@@ -72,6 +91,16 @@ func initConfig() {
 	}
 }
 
+// initKubeConfig selects the cluster for every cluster call, from the flags or the config file
+func initKubeConfig() {
+	util.SetKubeConfigOptions(util.KubeConfigOptions{
+		Kubeconfig:  viper.GetString("cluster.kubeconfig"),
+		Context:     viper.GetString("cluster.context"),
+		Namespace:   viper.GetString("cluster.namespace"),
+		Impersonate: viper.GetString("cluster.as"),
+	})
+}
+
 func createHiddenFolder() {
 	os.MkdirAll(".onepanel", os.ModePerm)
 }
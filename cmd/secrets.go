@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onepanelio/cli/util"
+	"github.com/spf13/cobra"
+)
+
+// generatedSecrets are the generated secrets of the cluster, for the commands that loaded them with loadGeneratedSecrets.
+// See generatedSecret.
+var generatedSecrets *util.GeneratedSecrets
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the secrets opctl generates for your deployment.",
+	Long: "opctl generates some secrets, like the MetalLB memberlist key, the first time they are needed. " +
+		"They are kept in the " + util.GeneratedSecretsSecretName + " Secret in the " + util.InventoryNamespace + " namespace, " +
+		"so every apply uses the same values. build renders placeholders instead, it does not need the cluster.",
+	Example: "secrets rotate " + util.MetalLbSecretKey,
+	RunE:    func(cmd *cobra.Command, args []string) error { return cmd.Help() },
+}
+
+var secretsRotateCmd = &cobra.Command{
+	Use:   "rotate <name>",
+	Short: "Replaces a generated secret with a new value.",
+	Long: "Replaces a generated secret with a new value. Run 'opctl apply' afterwards to deploy it. " +
+		"Generated secrets: " + strings.Join(util.GeneratedSecretNames(), ", "),
+	Example:   "secrets rotate " + util.MetalLbSecretKey,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: util.GeneratedSecretNames(),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if !containsString(util.GeneratedSecretNames(), name) {
+			return validationErrorf("'%v' is not a generated secret. Generated secrets: %v", name, strings.Join(util.GeneratedSecretNames(), ", "))
+		}
+
+		lock, err := acquireDeploymentLock("secrets rotate")
+		if err != nil {
+			return clusterError(nil, "secrets rotate", err)
+		}
+		defer releaseDeploymentLock(lock)
+
+		client, err := newClusterClient()
+		if err != nil {
+			return clusterError(nil, "secrets rotate", err)
+		}
+		if err := loadGeneratedSecrets(client, true).Rotate(name); err != nil {
+			return clusterError(nil, "secrets rotate", fmt.Errorf("unable to rotate %v: %w", name, err))
+		}
+
+		fmt.Printf("%v was rotated. Run 'opctl apply' to deploy the new value.\n", name)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsRotateCmd)
+}
+
+// newGeneratedSecretStore creates the store of the generated secrets in the cluster of newClusterClient
+func newGeneratedSecretStore() (*util.GeneratedSecretStore, error) {
+	client, err := newClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewGeneratedSecretStore(client.Kubernetes()), nil
+}
+
+// loadGeneratedSecrets loads the generated secrets of the cluster of client, every later render of the command uses them.
+// With generate, missing secrets are generated and kept until saveGeneratedSecrets, as apply does. Otherwise they are
+// rendered as placeholders and nothing is created, as with diff.
+func loadGeneratedSecrets(client util.ClusterClient, generate bool) *util.GeneratedSecrets {
+	store := util.NewGeneratedSecretStore(client.Kubernetes())
+	if generate {
+		generatedSecrets = util.NewGeneratedSecrets(store)
+	} else {
+		generatedSecrets = util.NewReadOnlyGeneratedSecrets(store)
+	}
+
+	return generatedSecrets
+}
+
+// generatedSecret returns the value of the generated secret. Unless the command loaded the generated secrets of the
+// cluster with loadGeneratedSecrets, like build, a placeholder is rendered and the cluster is not needed.
+func generatedSecret(name string) (string, error) {
+	if generatedSecrets == nil {
+		return util.GeneratedSecretPlaceholder(name), nil
+	}
+
+	value, err := generatedSecrets.Get(name)
+	if err != nil {
+		return "", clusterError(nil, "build", fmt.Errorf("unable to load the generated secret %v from the cluster: %w", name, err))
+	}
+
+	return value, nil
+}
+
+// saveGeneratedSecrets saves the secrets that were generated while rendering, so later builds use them as well
+func saveGeneratedSecrets() error {
+	if generatedSecrets == nil {
+		return nil
+	}
+
+	if err := generatedSecrets.Save(); err != nil {
+		return fmt.Errorf("unable to save the generated secrets: %w", err)
+	}
+
+	return nil
+}
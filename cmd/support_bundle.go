@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	opConfig "github.com/onepanelio/cli/config"
+	"github.com/onepanelio/cli/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// supportBundleOutput is the path the support bundle tarball is written to
+	supportBundleOutput string
+	// supportBundleLogLines is how many of the most recent log lines of each container are collected
+	supportBundleLogLines int64
+)
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collects information about your deployment into a tarball you can attach to an issue.",
+	Long: "Writes config.yaml, params.yaml with secrets redacted, .onepanel/cli_config.yaml, the rendered manifests, " +
+		"the versions of the CLI, manifests and images and, for every Onepanel namespace, the pods, events, " +
+		"describe output and recent logs into a tarball. Sensitive environment variables are redacted in the describe output, " +
+		"but the logs are included as they are, so check them before you share the bundle.",
+	Example: "support-bundle -o bundle.tar.gz",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := opConfig.FromFile("config.yaml")
+		if err != nil {
+			return configErrorf("unable to read configuration file: %v", err.Error())
+		}
+
+		yamlFile, err := util.LoadParamsFromFile(config.Spec.Params)
+		if err != nil {
+			return configErrorf("unable to read file '%v': %v", config.Spec.Params, err.Error())
+		}
+
+		output := supportBundleOutput
+		if output == "" {
+			output = fmt.Sprintf("opctl-support-bundle-%v.tar.gz", time.Now().UTC().Format("20060102-150405"))
+		}
+
+		bundle := util.NewSupportBundle()
+		if err := collectLocalFiles(bundle, config, yamlFile); err != nil {
+			return err
+		}
+		namespaces := collectManifests(bundle, config, yamlFile)
+
+		client, err := newClusterClient()
+		if err != nil {
+			bundle.AddError("cluster", err)
+		} else {
+			collectCluster(bundle, client, namespaces)
+		}
+
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := bundle.WriteTarball(file); err != nil {
+			return fmt.Errorf("unable to write '%v': %w", output, err)
+		}
+
+		for _, name := range bundle.Errors() {
+			fmt.Printf("Unable to collect %v, see %v.error in the bundle\n", name, name)
+		}
+		fmt.Printf("Support bundle written to %v\n", output)
+		fmt.Println("Secret params and the data of Secrets are redacted. Please review the bundle before sharing it.")
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+	supportBundleCmd.Flags().StringVarP(&supportBundleOutput, "output", "o", "", "Path of the tarball. Defaults to opctl-support-bundle-<time>.tar.gz")
+	supportBundleCmd.Flags().Int64VarP(&supportBundleLogLines, "log-lines", "", 200, "How many of the most recent log lines of each container to collect")
+}
+
+// collectLocalFiles adds the versions, the configuration files and the params, with secret params redacted
+func collectLocalFiles(bundle *util.SupportBundle, config *opConfig.Config, yamlFile *util.DynamicYaml) error {
+	bundle.Add("versions.txt", versionInfo())
+
+	for name, filePath := range map[string]string{
+		"config.yaml":     "config.yaml",
+		"cli_config.yaml": filepath.Join(".onepanel", "cli_config.yaml"),
+	} {
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			bundle.AddError(name, err)
+			continue
+		}
+		bundle.Add(name, sanitizePaths(string(content)))
+	}
+
+	redactedParams, err := util.RedactSecretParamsForSharing(yamlFile)
+	if err != nil {
+		return fmt.Errorf("unable to redact '%v': %w", config.Spec.Params, err)
+	}
+	params, err := redactedParams.String()
+	if err != nil {
+		return err
+	}
+	bundle.Add("params.yaml", params)
+
+	return nil
+}
+
+// collectManifests adds the rendered manifests, with the data of Secrets redacted.
+// The namespaces of the deployment are returned, they are known even if the manifests could not be rendered.
+func collectManifests(bundle *util.SupportBundle, config *opConfig.Config, yamlFile *util.DynamicYaml) []string {
+	namespaces := make(map[string]bool)
+	if defaultNamespace := yamlFile.GetValue("application.defaultNamespace"); defaultNamespace != nil && defaultNamespace.Value != "" {
+		namespaces[defaultNamespace.Value] = true
+	}
+
+	applicationResult, result, err := generateApplicationResults(config, nil)
+	if err != nil {
+		bundle.AddError("manifests", kustomizeError(err))
+	} else {
+		for name, content := range map[string]string{
+			"manifests/application.yaml": applicationResult,
+			"manifests/components.yaml":  result,
+		} {
+			resources, err := util.ParseResources(content)
+			if err != nil {
+				bundle.AddError(name, err)
+				continue
+			}
+			for _, resource := range resources {
+				addResourceNamespace(namespaces, resource.GetKind(), resource.GetNamespace(), resource.GetName())
+			}
+
+			redacted, err := util.RedactSecretResources(content)
+			if err != nil {
+				bundle.AddError(name, err)
+				continue
+			}
+			bundle.Add(name, redacted)
+		}
+	}
+
+	inventory, err := loadClusterInventory()
+	if err != nil {
+		bundle.AddError("inventory", err)
+	}
+	if inventory != nil {
+		for _, resource := range append(inventory.ApplicationResources, inventory.Resources...) {
+			addResourceNamespace(namespaces, resource.Kind, resource.Namespace, resource.Name)
+		}
+	}
+
+	names := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// addResourceNamespace adds the namespace of a resource, or the resource itself if it is a Namespace
+func addResourceNamespace(namespaces map[string]bool, kind, namespace, name string) {
+	if kind == "Namespace" {
+		namespaces[name] = true
+	} else if namespace != "" {
+		namespaces[namespace] = true
+	}
+}
+
+// collectCluster adds the version of the cluster and the state of each namespace
+func collectCluster(bundle *util.SupportBundle, client util.ClusterClient, namespaces []string) {
+	serverVersion, err := client.ServerVersion()
+	if err != nil {
+		bundle.AddError("cluster", err)
+		return
+	}
+	versions, _ := bundle.Content("versions.txt")
+	bundle.Add("versions.txt", versions+fmt.Sprintf("Kubernetes version: %v\n", serverVersion.GitVersion))
+
+	for _, namespace := range namespaces {
+		bundle.CollectNamespace(client, namespace, supportBundleLogLines)
+	}
+}
+
+// sanitizePaths replaces the home directory in content with ~, so the bundle does not reveal user names
+func sanitizePaths(content string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || home == string(os.PathSeparator) {
+		return content
+	}
+
+	return strings.ReplaceAll(content, home, "~")
+}
@@ -12,14 +12,21 @@ var versionCmd = &cobra.Command{
 	Short:   "Returns the current version of the CLI",
 	Long:    "Returns the current version of the CLI",
 	Example: "version",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("CLI version: %v\n", config.CLIVersion)
-		fmt.Printf("Manifest version: %v\n", config.ManifestsRepositoryTag)
-		fmt.Printf("API version: %v\n", config.CoreImageTag)
-		fmt.Printf("Web UI version: %v\n", config.CoreUIImageTag)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Print(versionInfo())
+
+		return nil
 	},
 }
 
+// versionInfo returns the versions of the CLI, the manifests and the images it deploys, one per line
+func versionInfo() string {
+	return fmt.Sprintf("CLI version: %v\n", config.CLIVersion) +
+		fmt.Sprintf("Manifest version: %v\n", config.ManifestsRepositoryTag) +
+		fmt.Sprintf("API version: %v\n", config.CoreImageTag) +
+		fmt.Sprintf("Web UI version: %v\n", config.CoreUIImageTag)
+}
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
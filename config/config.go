@@ -46,6 +46,25 @@ func (s *SimpleOverlayedComponent) PartsSkipFirst() []*string {
 	return s.parts[1:]
 }
 
+// Name returns the path of the component without the trailing base, e.g. common/onepanel
+func (s *SimpleOverlayedComponent) Name() string {
+	if len(s.parts) == 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(*s.parts[0], string(os.PathSeparator)+"base")
+}
+
+// Overlays returns the overlay paths of the component
+func (s *SimpleOverlayedComponent) Overlays() []string {
+	overlays := make([]string, 0)
+	for _, part := range s.parts[1:] {
+		overlays = append(overlays, *part)
+	}
+
+	return overlays
+}
+
 type Config struct {
 	ApiVersion string     `yaml:"apiVersion"`
 	Kind       string     `yaml:"kind"`
@@ -166,3 +185,31 @@ func (c *Config) GetOverlayComponent(overlayComponentGet string) []*SimpleOverla
 
 	return overlayedComponents
 }
+
+// MatchComponent returns the component in components that name refers to.
+// name can be the full path of the component, e.g. common/modeldb/base, the path without base, e.g. common/modeldb,
+// or the last part of that, e.g. modeldb.
+func MatchComponent(components []string, name string) (string, error) {
+	name = strings.Trim(name, string(os.PathSeparator))
+	matches := make([]string, 0)
+
+	for _, component := range components {
+		componentName := strings.TrimSuffix(component, string(os.PathSeparator)+"base")
+		if component == name || componentName == name {
+			return component, nil
+		}
+
+		if componentName[strings.LastIndex(componentName, string(os.PathSeparator))+1:] == name {
+			matches = append(matches, component)
+		}
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("component '%v' is not part of the deployment", name)
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("component '%v' is ambiguous, use one of: %v", name, strings.Join(matches, ", "))
+	}
+
+	return matches[0], nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchComponent(t *testing.T) {
+	components := []string{"common/application/base", "common/modeldb/base", "common/logging/base", "extras/logging/base"}
+
+	component, err := MatchComponent(components, "common/modeldb/base")
+	assert.Nil(t, err)
+	assert.Equal(t, "common/modeldb/base", component)
+
+	component, err = MatchComponent(components, "common/application")
+	assert.Nil(t, err)
+	assert.Equal(t, "common/application/base", component)
+
+	component, err = MatchComponent(components, "modeldb")
+	assert.Nil(t, err)
+	assert.Equal(t, "common/modeldb/base", component)
+
+	_, err = MatchComponent(components, "logging")
+	assert.NotNil(t, err)
+
+	_, err = MatchComponent(components, "istio")
+	assert.NotNil(t, err)
+}
@@ -1,7 +1,9 @@
 package files
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -270,3 +272,87 @@ func Unzip(src string, dest string) ([]string, error) {
 	}
 	return filenames, nil
 }
+
+// Untar will decompress a gzipped tar archive, moving all files and folders
+// within the archive (parameter 1) to an output directory (parameter 2), like Unzip.
+// Entries other than files and folders, e.g. symlinks, are skipped.
+func Untar(src string, dest string) ([]string, error) {
+	var filenames []string
+
+	file, err := os.Open(src)
+	if err != nil {
+		return filenames, err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return filenames, err
+	}
+	defer gzipReader.Close()
+
+	return ExtractTar(gzipReader, dest)
+}
+
+// ExtractTar extracts the tar archive read from reader to an output directory, like Untar.
+func ExtractTar(reader io.Reader, dest string) ([]string, error) {
+	var filenames []string
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return filenames, err
+		}
+
+		if header.Typeflag != tar.TypeDir && header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		fpath := filepath.Join(dest, header.Name)
+
+		// Archives created from a directory, e.g. with tar -C dir -czf bundle.tar.gz ., have the entry ./ for dest itself
+		if fpath == filepath.Clean(dest) && header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
+				return filenames, err
+			}
+			continue
+		}
+
+		// Check for path traversal, like the ZipSlip check of Unzip
+		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return filenames, fmt.Errorf("%s: illegal file path", fpath)
+		}
+
+		filenames = append(filenames, fpath)
+
+		if header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
+				return filenames, err
+			}
+			continue
+		}
+
+		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+			return filenames, err
+		}
+
+		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode())
+		if err != nil {
+			return filenames, err
+		}
+
+		_, err = io.Copy(outFile, tarReader)
+
+		// Close the file without defer to close before next iteration of loop
+		outFile.Close()
+
+		if err != nil {
+			return filenames, err
+		}
+	}
+	return filenames, nil
+}
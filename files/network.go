@@ -5,39 +5,203 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 )
 
+// partialDownloadSuffix is appended to the path of a download until it is complete, so an interrupted download can be resumed
+const partialDownloadSuffix = ".partial"
+
+// DownloadOptions configures DownloadFileWithOptions
+type DownloadOptions struct {
+	// Client sends the requests
+	Client *http.Client
+	// Retries is how many times the download is resumed after an error
+	Retries int
+	// Backoff is the wait before the first retry, it doubles on every retry
+	Backoff time.Duration
+	// Progress receives the progress of the download, if it is not nil
+	Progress io.Writer
+	// ProgressInterval is the least time between two progress updates
+	ProgressInterval time.Duration
+}
+
+// DefaultDownloadOptions returns the options of DownloadFile, retrying 3 times and writing the progress to stderr
+func DefaultDownloadOptions() DownloadOptions {
+	return DownloadOptions{
+		Client:           &http.Client{},
+		Retries:          3,
+		Backoff:          time.Second,
+		Progress:         os.Stderr,
+		ProgressInterval: time.Second,
+	}
+}
+
 // DownloadFile will download a url to a local file.
 // The network request attaches the "onepanelio" user-agent to the request headers
 // This is important for certain sites like Github, otherwise you get a 403.
+// See DownloadFileWithOptions for retries and resuming, the progress is written to stderr.
 func DownloadFile(filepath string, url string) error {
-	client := &http.Client{}
+	return DownloadFileWithOptions(filepath, url, DefaultDownloadOptions())
+}
+
+// DownloadFileWithOptions downloads a url to a local file like DownloadFile.
+// The file is written to filepath with partialDownloadSuffix until it is complete. If the download fails, it is resumed
+// with a range request, also by a later call for the same filepath. Server errors are retried, other error statuses are not.
+func DownloadFileWithOptions(filepath string, url string, options DownloadOptions) error {
+	partialPath := filepath + partialDownloadSuffix
+	progress := &downloadProgress{url: url, writer: options.Progress, interval: options.ProgressInterval}
+
+	backoff := options.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := downloadPart(partialPath, url, options.Client, progress)
+		if err == nil {
+			progress.done()
+			return os.Rename(partialPath, filepath)
+		}
+		if !retry || attempt >= options.Retries {
+			progress.done()
+			return err
+		}
+
+		progress.done()
+		progress.printf("Downloading %v failed, retrying in %v: %v\n", url, backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// downloadPart downloads url to partialPath, resuming after the bytes that are already in it.
+// It returns if the download should be retried on error.
+func downloadPart(partialPath string, url string, client *http.Client, progress *downloadProgress) (bool, error) {
+	var offset int64
+	if info, err := os.Stat(partialPath); err == nil {
+		offset = info.Size()
+	}
+
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	req.Header.Add("User-Agent", "onepanelio")
+	// The file is written as it is sent, e.g. a .tar.gz is not decompressed by the client
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	}
 
 	// Get the data
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return true, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode > 399 {
-		return fmt.Errorf("[error] getting manifests. Response code %v", resp.StatusCode)
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file does not match the file on the server anymore, start over
+		if err := os.Remove(partialPath); err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("unable to resume the download of %v", url)
+	case resp.StatusCode > 499:
+		return true, fmt.Errorf("[error] getting %v. Response code %v", url, resp.StatusCode)
+	case resp.StatusCode > 399:
+		return false, fmt.Errorf("[error] getting %v. Response code %v", url, resp.StatusCode)
+	default:
+		// The server sends the whole file, it does not support ranges or this is the first request
+		flags |= os.O_TRUNC
+		offset = 0
 	}
 
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	progress.start(offset, total)
+
 	// Create the file
-	out, err := os.Create(filepath)
+	out, err := os.OpenFile(partialPath, flags, 0644)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer out.Close()
 
 	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return err
+	if _, err := io.Copy(out, io.TeeReader(resp.Body, progress)); err != nil {
+		return true, err
+	}
+	if total >= 0 && progress.downloaded != total {
+		return true, fmt.Errorf("the download of %v ended after %v of %v bytes", url, progress.downloaded, total)
+	}
+
+	return false, nil
+}
+
+// downloadProgress writes the progress of a download at most every interval
+type downloadProgress struct {
+	url        string
+	writer     io.Writer
+	interval   time.Duration
+	downloaded int64
+	total      int64 // -1 if the size is unknown
+	printed    time.Time
+}
+
+func (p *downloadProgress) start(offset, total int64) {
+	p.downloaded = offset
+	p.total = total
+}
+
+func (p *downloadProgress) Write(data []byte) (int, error) {
+	p.downloaded += int64(len(data))
+	if time.Since(p.printed) >= p.interval {
+		p.print()
+	}
+
+	return len(data), nil
+}
+
+func (p *downloadProgress) print() {
+	p.printed = time.Now()
+	if p.total > 0 {
+		p.printf("\rDownloading %v: %v of %v (%v%%)", p.url, formatBytes(p.downloaded), formatBytes(p.total), p.downloaded*100/p.total)
+		return
+	}
+	p.printf("\rDownloading %v: %v", p.url, formatBytes(p.downloaded))
+}
+
+// done prints the final progress on its own line
+func (p *downloadProgress) done() {
+	if p.printed.IsZero() {
+		return
+	}
+	p.print()
+	p.printf("\n")
+}
+
+func (p *downloadProgress) printf(format string, args ...interface{}) {
+	if p.writer != nil {
+		fmt.Fprintf(p.writer, format, args...)
+	}
+}
+
+// formatBytes formats a size in bytes for humans, e.g. 1.5 MB
+func formatBytes(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "kMGTPE"[exp])
 }
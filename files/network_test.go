@@ -0,0 +1,95 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDownloadOptions(progress *bytes.Buffer) DownloadOptions {
+	options := DefaultDownloadOptions()
+	options.Backoff = time.Millisecond
+	options.Progress = progress
+	options.ProgressInterval = 0
+
+	return options
+}
+
+func TestDownloadFileWithOptions_Resume(t *testing.T) {
+	content := strings.Repeat("manifests", 1000)
+	half := len(content) / 2
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch len(ranges) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			// The connection breaks after half of the content
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write([]byte(content[:half]))
+		default:
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", half, len(content)-1, len(content)))
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)-half))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[half:]))
+		}
+	}))
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "download")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	filePath := filepath.Join(directory, "manifests.zip")
+
+	progress := &bytes.Buffer{}
+	assert.Nil(t, DownloadFileWithOptions(filePath, server.URL, testDownloadOptions(progress)))
+	downloaded, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(downloaded))
+	assert.Equal(t, []string{"", "", fmt.Sprintf("bytes=%v-", half)}, ranges)
+	assert.Contains(t, progress.String(), "9.0 kB of 9.0 kB (100%)")
+	assert.Contains(t, progress.String(), "retrying")
+
+	_, err = os.Stat(filePath + partialDownloadSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadFileWithOptions_Errors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "download")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	filePath := filepath.Join(directory, "manifests.zip")
+
+	// Client errors are not retried
+	assert.NotNil(t, DownloadFileWithOptions(filePath, server.URL+"/missing", testDownloadOptions(&bytes.Buffer{})))
+	assert.Equal(t, 1, requests)
+
+	requests = 0
+	err = DownloadFileWithOptions(filePath, server.URL, testDownloadOptions(&bytes.Buffer{}))
+	assert.Contains(t, err.Error(), "503")
+	assert.Equal(t, 4, requests)
+
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,9 +1,35 @@
 package github
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultApiUrl is the url of the GitHub API
+	DefaultApiUrl = "https://api.github.com"
+	// ApiUrlEnv is the environment variable with the url of the API of a GitHub Enterprise server, e.g. https://github.example.com/api/v3
+	ApiUrlEnv = "GITHUB_API_URL"
+	// TokenEnv is the environment variable with the token requests are authenticated with.
+	// Authenticated requests have a higher rate limit, and can read private repositories.
+	TokenEnv = "GITHUB_TOKEN"
+
+	// AssetZipball is the zip archive of the source of a release or ref
+	AssetZipball = "zipball"
+	// AssetTarball is the gzipped tar archive of the source of a release or ref
+	AssetTarball = "tarball"
+
+	userAgent = "onepanelio"
 )
 
 type Release struct {
@@ -15,35 +41,350 @@ type Release struct {
 	ZipBallUrl string `json:"zipball_url"`
 }
 
+// ArchiveUrl returns the url of the source archive of the release, AssetZipball or AssetTarball
+func (r *Release) ArchiveUrl(asset string) string {
+	if asset == AssetTarball {
+		return r.TarBallUrl
+	}
+
+	return r.ZipBallUrl
+}
+
+// Error is returned when the GitHub API responds with an error status
+type Error struct {
+	StatusCode int
+	// Message is the message of the response, e.g. Not Found
+	Message string
+	// Subject is what was requested, e.g. release v0.1.0 of onepanelio/manifests
+	Subject string
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("unable to get %v: %v %v", e.Subject, e.StatusCode, e.Message)
+	if e.StatusCode == http.StatusNotFound {
+		message += ". Check that it exists"
+		if os.Getenv(TokenEnv) == "" {
+			message += ", or set " + TokenEnv + " if the repository is private"
+		}
+	}
+	if isRateLimited(e.StatusCode, e.Message) && os.Getenv(TokenEnv) == "" {
+		message += ". Set " + TokenEnv + " to raise the rate limit"
+	}
+
+	return message
+}
+
 type Github struct {
-	repoUrl string
+	repoUrl    string
+	repository string // owner/name of the repository, for messages
+	client     *http.Client
+	// token authenticates the requests, if set
+	token string
+	// cacheDirectory keeps the release metadata with its ETag, if set
+	cacheDirectory string
+	// retries is how many times a request is retried on server errors and rate limits
+	retries int
+	// backoff is the wait before the first retry, it doubles on every retry
+	backoff time.Duration
+	// maxWait is the longest wait for a rate limit to reset. If it resets later, the request fails right away.
+	maxWait time.Duration
+}
+
+// ApiUrl returns the url of the GitHub API, ApiUrlEnv or DefaultApiUrl
+func ApiUrl() string {
+	if url := os.Getenv(ApiUrlEnv); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+
+	return DefaultApiUrl
+}
+
+// RepositoryUrl returns the API url of the repository owner/name, e.g. https://api.github.com/repos/onepanelio/manifests
+func RepositoryUrl(apiUrl, owner, name string) string {
+	return strings.TrimSuffix(apiUrl, "/") + "/repos/" + owner + "/" + name
 }
 
 func New(url string) (*Github, error) {
-	return &Github{repoUrl: url}, nil
+	return NewWithClient(url, http.DefaultClient)
+}
+
+// NewWithClient creates a Github for the repository API url, e.g. https://api.github.com/repos/onepanelio/manifests,
+// that sends its requests with client. Tests use it to point the API at an httptest.Server.
+// Requests are authenticated with TokenEnv, if it is set.
+func NewWithClient(url string, client *http.Client) (*Github, error) {
+	url = strings.TrimSuffix(url, "/")
+	repository := url
+	if index := strings.LastIndex(url, "/repos/"); index >= 0 {
+		repository = url[index+len("/repos/"):]
+	}
+
+	return &Github{
+		repoUrl:    url,
+		repository: repository,
+		client:     client,
+		token:      os.Getenv(TokenEnv),
+		retries:    3,
+		backoff:    time.Second,
+		maxWait:    time.Minute,
+	}, nil
+}
+
+// SetToken replaces the token requests are authenticated with. An empty token sends anonymous requests.
+func (g *Github) SetToken(token string) {
+	g.token = token
 }
 
+// SetCacheDirectory makes the Github keep release metadata in directory. Cached releases are requested with their ETag,
+// responses that they did not change do not count against the rate limit.
+func (g *Github) SetCacheDirectory(directory string) {
+	g.cacheDirectory = directory
+}
+
+// SetRetries sets how many times requests are retried on server errors and rate limits, and the wait before the first retry
+func (g *Github) SetRetries(retries int, backoff time.Duration) {
+	g.retries = retries
+	g.backoff = backoff
+}
+
+// GetRelease gets the release at the API url
 func (g *Github) GetRelease(url string) (release *Release, err error) {
-	response, err := http.Get(url)
+	return g.getRelease(url, fmt.Sprintf("release %v", url))
+}
+
+func (g *Github) GetLatestRelease() (release *Release, err error) {
+	return g.getRelease(g.repoUrl+"/releases/latest", fmt.Sprintf("the latest release of %v", g.repository))
+}
+
+func (g *Github) GetReleaseByTag(tag string) (release *Release, err error) {
+	return g.getRelease(g.repoUrl+"/releases/tags/"+tag, fmt.Sprintf("release %v of %v", tag, g.repository))
+}
+
+// ArchiveUrl returns the url of the source archive of ref, a branch, tag or commit SHA, as AssetZipball or AssetTarball
+func (g *Github) ArchiveUrl(asset, ref string) string {
+	return g.repoUrl + "/" + asset + "/" + ref
+}
+
+// Download writes the content at url, e.g. the ZipBallUrl of a release, to filePath.
+// The request is authenticated and retried like the API requests. If the download fails, filePath is not changed.
+func (g *Github) Download(url, filePath string) error {
+	subject := fmt.Sprintf("%v of %v", url, g.repository)
+	response, err := g.get(url, nil, subject)
 	if err != nil {
-		return
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return responseError(response, subject)
 	}
 
-	data, err := ioutil.ReadAll(response.Body)
+	// The content is written to a temporary file next to filePath, so filePath is never left with a partial download
+	file, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".*.download")
 	if err != nil {
-		return
+		return err
 	}
 
-	release = &Release{}
-	err = json.Unmarshal(data, release)
+	_, err = io.Copy(file, response.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("unable to download %v: %w", subject, err)
+	}
+
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
 
-	return
+	return nil
 }
 
-func (g *Github) GetLatestRelease() (release *Release, err error) {
-	return g.GetRelease(g.repoUrl + "/releases/latest")
+// cachedRelease is the release metadata kept in the cache directory
+type cachedRelease struct {
+	ETag string          `json:"etag"`
+	Body json.RawMessage `json:"body"`
 }
 
-func (g *Github) GetReleaseByTag(tag string) (release *Release, err error) {
-	return g.GetRelease(g.repoUrl + "/releases/tags/" + tag)
+func (g *Github) getRelease(url, subject string) (*Release, error) {
+	cached := g.loadCachedRelease(url)
+	header := http.Header{}
+	if cached != nil {
+		header.Set("If-None-Match", cached.ETag)
+	}
+
+	response, err := g.get(url, header, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var data []byte
+	switch {
+	case response.StatusCode == http.StatusNotModified && cached != nil:
+		data = cached.Body
+	case response.StatusCode == http.StatusOK:
+		data, err = ioutil.ReadAll(response.Body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %v: %w", subject, err)
+		}
+	default:
+		return nil, responseError(response, subject)
+	}
+
+	release := &Release{}
+	if err := json.Unmarshal(data, release); err != nil {
+		return nil, fmt.Errorf("unable to get %v, the response is not a release: %w", subject, err)
+	}
+	if release.TagName == "" {
+		return nil, fmt.Errorf("unable to get %v, the response has no tag name", subject)
+	}
+
+	if etag := response.Header.Get("ETag"); response.StatusCode == http.StatusOK && etag != "" {
+		g.saveCachedRelease(url, &cachedRelease{ETag: etag, Body: data})
+	}
+
+	return release, nil
+}
+
+// get sends a GET request, retrying it on server errors and rate limits. The response is returned with any status,
+// the caller closes its body.
+func (g *Github) get(url string, header http.Header, subject string) (*http.Response, error) {
+	backoff := g.backoff
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		// GitHub rejects requests without a User-Agent
+		request.Header.Set("User-Agent", userAgent)
+		request.Header.Set("Accept", "application/vnd.github.v3+json")
+		if g.token != "" {
+			request.Header.Set("Authorization", "token "+g.token)
+		}
+
+		response, err := g.client.Do(request)
+		if err != nil {
+			if attempt >= g.retries {
+				return nil, fmt.Errorf("unable to get %v: %w", subject, err)
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+
+		wait, retry := g.retryAfter(response, backoff)
+		if !retry || attempt >= g.retries {
+			return response, nil
+		}
+
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		if wait > g.maxWait {
+			return nil, &Error{
+				StatusCode: response.StatusCode,
+				Message:    fmt.Sprintf("rate limit exceeded, it resets in %v", wait.Round(time.Second)),
+				Subject:    subject,
+			}
+		}
+
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// retryAfter returns if the request of response should be retried, and how long to wait before.
+// Server errors are retried after backoff, rate limits once they reset.
+func (g *Github) retryAfter(response *http.Response, backoff time.Duration) (time.Duration, bool) {
+	if response.StatusCode >= 500 {
+		return backoff, true
+	}
+	if response.StatusCode != http.StatusForbidden && response.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if response.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			wait := time.Until(time.Unix(reset, 0))
+			if wait < 0 {
+				wait = 0
+			}
+			return wait, true
+		}
+		return backoff, true
+	}
+	if response.StatusCode == http.StatusTooManyRequests {
+		return backoff, true
+	}
+
+	return 0, false
+}
+
+// responseError returns an *Error with the message of the error response, e.g. {"message": "Not Found"}
+func responseError(response *http.Response, subject string) error {
+	message := http.StatusText(response.StatusCode)
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err == nil {
+		errorResponse := struct {
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(data, &errorResponse) == nil && errorResponse.Message != "" {
+			message = errorResponse.Message
+		}
+	}
+
+	return &Error{StatusCode: response.StatusCode, Message: message, Subject: subject}
+}
+
+// isRateLimited returns true if an error response is about the rate limit
+func isRateLimited(statusCode int, message string) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		(statusCode == http.StatusForbidden && strings.Contains(strings.ToLower(message), "rate limit"))
+}
+
+func (g *Github) cachedReleasePath(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(g.cacheDirectory, hex.EncodeToString(hash[:])+".json")
+}
+
+// loadCachedRelease returns the cached release at url, or nil if there is none
+func (g *Github) loadCachedRelease(url string) *cachedRelease {
+	if g.cacheDirectory == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(g.cachedReleasePath(url))
+	if err != nil {
+		return nil
+	}
+	cached := &cachedRelease{}
+	if err := json.Unmarshal(data, cached); err != nil || cached.ETag == "" {
+		return nil
+	}
+
+	return cached
+}
+
+// saveCachedRelease keeps the release at url in the cache directory. The cache is an optimization, errors are ignored.
+func (g *Github) saveCachedRelease(url string, cached *cachedRelease) {
+	if g.cacheDirectory == "" {
+		return
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	// The cache can have releases of private repositories, so only the user may read it
+	if err := os.MkdirAll(g.cacheDirectory, 0700); err != nil {
+		return
+	}
+	ioutil.WriteFile(g.cachedReleasePath(url), data, 0600)
 }
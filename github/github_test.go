@@ -0,0 +1,222 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGithub(t *testing.T, handler http.HandlerFunc) (*Github, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	api, err := NewWithClient(RepositoryUrl(server.URL, "onepanelio", "manifests"), server.Client())
+	assert.Nil(t, err)
+	api.SetToken("")
+	api.SetRetries(2, time.Millisecond)
+
+	return api, server
+}
+
+func TestGithub_GetReleaseByTag(t *testing.T) {
+	api, server := testGithub(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+		assert.Equal(t, userAgent, r.Header.Get("User-Agent"))
+		if r.URL.Path != "/repos/onepanelio/manifests/releases/tags/v0.1.0" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"tag_name": "v0.1.0", "zipball_url": "https://example.com/v0.1.0.zip"}`)
+	})
+	defer server.Close()
+	api.SetToken("secret")
+
+	release, err := api.GetReleaseByTag("v0.1.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "v0.1.0", release.TagName)
+	assert.Equal(t, "https://example.com/v0.1.0.zip", release.ZipBallUrl)
+
+	_, err = api.GetReleaseByTag("v9.9.9")
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, http.StatusNotFound, err.(*Error).StatusCode)
+	assert.Contains(t, err.Error(), "release v9.9.9 of onepanelio/manifests: 404 Not Found")
+}
+
+func TestGithub_GetRelease_NoTag(t *testing.T) {
+	api, server := testGithub(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message": "Moved Permanently"}`)
+	})
+	defer server.Close()
+
+	_, err := api.GetLatestRelease()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the latest release of onepanelio/manifests")
+}
+
+func TestGithub_GetRelease_Retries(t *testing.T) {
+	attempts := 0
+	api, server := testGithub(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Unix()))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+		default:
+			fmt.Fprint(w, `{"tag_name": "v0.1.0"}`)
+		}
+	})
+	defer server.Close()
+
+	release, err := api.GetReleaseByTag("v0.1.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "v0.1.0", release.TagName)
+	assert.Equal(t, 3, attempts)
+
+	// Server errors fail once the retries are used up
+	attempts = 0
+	api.SetRetries(0, time.Millisecond)
+	_, err = api.GetReleaseByTag("v0.1.0")
+	assert.Contains(t, err.Error(), "release v0.1.0 of onepanelio/manifests: 502")
+	assert.Equal(t, 1, attempts)
+}
+
+// closeCountingTransport counts the response bodies that are closed
+type closeCountingTransport struct {
+	transport http.RoundTripper
+	closed    int
+}
+
+func (c *closeCountingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := c.transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = &closeCountingBody{ReadCloser: response.Body, transport: c}
+
+	return response, nil
+}
+
+type closeCountingBody struct {
+	io.ReadCloser
+	transport *closeCountingTransport
+}
+
+func (c *closeCountingBody) Close() error {
+	c.transport.closed++
+	return c.ReadCloser.Close()
+}
+
+func TestGithub_GetRelease_RateLimited(t *testing.T) {
+	attempts := 0
+	api, server := testGithub(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+	})
+	defer server.Close()
+
+	// The rate limit resets too late to wait for it
+	os.Unsetenv(TokenEnv)
+	_, err := api.GetReleaseByTag("v0.1.0")
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, 1, attempts)
+	assert.True(t, strings.HasSuffix(err.Error(), "Set "+TokenEnv+" to raise the rate limit"), err.Error())
+
+	// The response is not returned, so its body is closed
+	transport := &closeCountingTransport{transport: server.Client().Transport}
+	api.client.Transport = transport
+	_, err = api.GetReleaseByTag("v0.1.0")
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, 1, transport.closed)
+}
+
+func TestGithub_GetRelease_ETag(t *testing.T) {
+	directory, err := ioutil.TempDir("", "releases")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	requests := 0
+	api, server := testGithub(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"tag_name": "v0.1.0"}`)
+	})
+	defer server.Close()
+	cacheDirectory := filepath.Join(directory, "cache")
+	api.SetCacheDirectory(cacheDirectory)
+
+	for i := 0; i < 2; i++ {
+		release, err := api.GetLatestRelease()
+		assert.Nil(t, err)
+		assert.Equal(t, "v0.1.0", release.TagName)
+	}
+	assert.Equal(t, 2, requests)
+	cached, err := filepath.Glob(filepath.Join(cacheDirectory, "*.json"))
+	assert.Nil(t, err)
+	assert.Len(t, cached, 1)
+
+	// Only the user can read the cache
+	info, err := os.Stat(cacheDirectory)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	info, err = os.Stat(cached[0])
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestGithub_Download(t *testing.T) {
+	api, server := testGithub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/zipball/truncated" {
+			// The connection is closed before the announced length is sent
+			w.Header().Set("Content-Length", "100")
+			fmt.Fprint(w, "arch")
+			return
+		}
+		if r.URL.Path != "/zipball/v0.1.0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "archive")
+	})
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "download")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	filePath := filepath.Join(directory, "manifests.zip")
+
+	assert.Nil(t, api.Download(server.URL+"/zipball/v0.1.0", filePath))
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "archive", string(content))
+
+	err = api.Download(server.URL+"/zipball/v9.9.9", filePath)
+	assert.Contains(t, err.Error(), "404 Not Found")
+
+	// A failed download leaves the file as it was, and no temporary file
+	assert.NotNil(t, api.Download(server.URL+"/zipball/truncated", filePath))
+	content, err = ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "archive", string(content))
+	leftovers, err := ioutil.ReadDir(directory)
+	assert.Nil(t, err)
+	assert.Len(t, leftovers, 1)
+}
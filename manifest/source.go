@@ -1,11 +1,14 @@
 package manifest
 
 import (
+	"errors"
 	"fmt"
 	"github.com/onepanelio/cli/files"
 	"github.com/onepanelio/cli/github"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -20,27 +23,51 @@ const (
 	//  directory:
 	// This indicates manifests should be retrieved from some local directory.
 	SourceDirectory = "directory"
+
+	defaultGithubOwner = "onepanelio"
+	defaultGithubRepo  = "manifests"
+
+	// releasesCacheDirectory is the directory in the manifests directory with the cached metadata of GitHub releases
+	releasesCacheDirectory = ".releases"
 )
 
+// ErrNotCached is returned in offline mode when the manifests are not in the cache, see Source.SetOffline
+var ErrNotCached = errors.New("the manifests are not cached")
+
+// commitShaRegex matches full commit SHAs, refs that can not change
+var commitShaRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
 type Source interface {
 	MoveToDirectory(destinationPath string) error
 	// Get the resulting manifest path. Should only be called after MoveToDirectory
 	GetManifestPath() (string, error)
 	GetTag() string
 	GetSourceType() string
+	// SetOffline, if true, makes MoveToDirectory use the cached manifests only. If they are not cached, ErrNotCached is returned.
+	SetOffline(offline bool)
 }
 
 type GithubSource struct {
 	tag           string // The tag of the release. latest is also accepted.
+	ref           string // a branch or commit SHA, used instead of tag if set
+	owner         string // the owner of the manifests repository, onepanelio by default
+	repo          string // the name of the manifests repository, manifests by default
+	apiUrl        string // the url of the GitHub API, github.ApiUrl() by default
+	asset         string // the source archive that is downloaded, github.AssetZipball or github.AssetTarball
 	overrideCache bool   // if true, will override the local cached files.
 	release       *github.Release
-	moved         bool   // true if MoveToDirectory has been called
-	destination   string // the directory to move the manifest files to
+	moved         bool           // true if MoveToDirectory has been called
+	destination   string         // the directory to move the manifest files to
+	offline       bool           // if true, the manifests are only taken from the cache
+	api           *github.Github // the GitHub API, created on first use if not set with SetGithub
 }
 
 func CreateGithubSource(tag string, overrideCache bool) (*GithubSource, error) {
 	source := &GithubSource{
 		tag:           tag,
+		owner:         defaultGithubOwner,
+		repo:          defaultGithubRepo,
+		asset:         github.AssetZipball,
 		overrideCache: overrideCache,
 		moved:         false,
 	}
@@ -54,17 +81,105 @@ func (g *GithubSource) GetSourceType() string {
 }
 
 // GetTag returns the ManifestsRepositoryTag set in the CLI via build flag.
+// In case of a ref, an empty string because the manifests are not a release.
 func (g *GithubSource) GetTag() string {
+	if g.ref != "" {
+		return ""
+	}
+
 	return g.tag
 }
 
-func (g *GithubSource) getTagDownloadUrl() (string, error) {
-	if g.release == nil {
-		githubApi, err := github.New("https://api.github.com/repos/onepanelio/manifests")
+// SetOffline, if true, makes MoveToDirectory use the cached manifests without querying GitHub.
+// latest can not be used offline, it has to be resolved by GitHub.
+func (g *GithubSource) SetOffline(offline bool) {
+	g.offline = offline
+}
+
+// SetGithub replaces the GitHub API the releases are queried from
+func (g *GithubSource) SetGithub(api *github.Github) {
+	g.api = api
+}
+
+// SetRepository sets the repository the manifests are downloaded from, e.g. a fork.
+// Empty values keep the defaults, onepanelio/manifests at github.ApiUrl().
+func (g *GithubSource) SetRepository(apiUrl, owner, repo string) {
+	if apiUrl != "" {
+		g.apiUrl = apiUrl
+	}
+	if owner != "" {
+		g.owner = owner
+	}
+	if repo != "" {
+		g.repo = repo
+	}
+}
+
+// IsDefaultRepository returns true if the manifests come from onepanelio/manifests, whose tags match the CLI versions
+func (g *GithubSource) IsDefaultRepository() bool {
+	return g.owner == defaultGithubOwner && g.repo == defaultGithubRepo
+}
+
+// GetRepository returns the repository the manifests are downloaded from, owner/repo
+func (g *GithubSource) GetRepository() string {
+	return g.owner + "/" + g.repo
+}
+
+// SetAsset sets the source archive that is downloaded, github.AssetZipball or github.AssetTarball
+func (g *GithubSource) SetAsset(asset string) error {
+	if asset != github.AssetZipball && asset != github.AssetTarball {
+		return fmt.Errorf("'%v' is not a valid asset. Valid values: %v, %v", asset, github.AssetZipball, github.AssetTarball)
+	}
+
+	g.asset = asset
+
+	return nil
+}
+
+// SetRef makes the source download ref, a branch or commit SHA, instead of a release.
+// Branches are downloaded every time, commit SHAs are cached like tags.
+func (g *GithubSource) SetRef(ref string) {
+	g.ref = ref
+}
+
+// isPinned returns true if the tag or ref can not change, so the cached manifests can be used without querying GitHub
+func (g *GithubSource) isPinned() bool {
+	if g.ref != "" {
+		return commitShaRegex.MatchString(g.ref)
+	}
+
+	return g.tag != "" && g.tag != "latest"
+}
+
+// githubApi returns the GitHub API of the manifests repository
+func (g *GithubSource) githubApi() (*github.Github, error) {
+	if g.api == nil {
+		apiUrl := g.apiUrl
+		if apiUrl == "" {
+			apiUrl = github.ApiUrl()
+		}
+		api, err := github.New(github.RepositoryUrl(apiUrl, g.owner, g.repo))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		g.api = api
+	}
+
+	return g.api, nil
+}
+
+func (g *GithubSource) getTagDownloadUrl() (string, error) {
+	githubApi, err := g.githubApi()
+	if err != nil {
+		return "", err
+	}
+
+	// Refs are downloaded with the archive endpoints, they have no release
+	if g.ref != "" {
+		return githubApi.ArchiveUrl(g.asset, g.ref), nil
+	}
 
+	if g.release == nil {
 		release := &github.Release{}
 
 		if g.tag == "latest" {
@@ -82,11 +197,24 @@ func (g *GithubSource) getTagDownloadUrl() (string, error) {
 		g.release = release
 	}
 
-	return g.release.ZipBallUrl, nil
+	return g.release.ArchiveUrl(g.asset), nil
 }
 
+// getManifestPath returns the directory of the manifests in directoryPath, named after the tag or ref.
+// The manifests of other repositories are kept in owner/repo, so they do not mix with the default repository.
 func (g *GithubSource) getManifestPath(directoryPath string) string {
-	return directoryPath + string(os.PathSeparator) + g.release.TagName
+	name := g.tag
+	if g.ref != "" {
+		name = strings.ReplaceAll(g.ref, "/", "-")
+	} else if g.release != nil {
+		name = g.release.TagName
+	}
+
+	if !g.IsDefaultRepository() {
+		directoryPath = filepath.Join(directoryPath, g.owner, g.repo)
+	}
+
+	return directoryPath + string(os.PathSeparator) + name
 }
 
 func (g *GithubSource) GetManifestPath() (string, error) {
@@ -109,6 +237,44 @@ func (g *GithubSource) MoveToDirectory(directoryPath string) error {
 		}
 	}()
 
+	if g.offline {
+		if g.overrideCache {
+			return fmt.Errorf("%w, overrideCache can not be used offline", ErrNotCached)
+		}
+		if g.ref == "" && !g.isPinned() {
+			return fmt.Errorf("%w, the latest release can not be resolved offline. Set a tag in cli_config.yaml", ErrNotCached)
+		}
+
+		// Branches are served from the cache as well, as they were last downloaded
+		cacheExists, err := files.Exists(g.getManifestPath(directoryPath))
+		if err != nil {
+			return err
+		}
+		if !cacheExists {
+			return fmt.Errorf("%w, %v does not exist. Run init without --offline to download them", ErrNotCached, g.getManifestPath(directoryPath))
+		}
+		g.moved = true
+		return nil
+	}
+
+	// Pinned tags and commits are served from the cache, GitHub is only queried to resolve latest or to download
+	if g.isPinned() && !g.overrideCache {
+		cacheExists, err := files.Exists(g.getManifestPath(directoryPath))
+		if err != nil {
+			return err
+		}
+		if cacheExists {
+			g.moved = true
+			return nil
+		}
+	}
+
+	githubApi, err := g.githubApi()
+	if err != nil {
+		return err
+	}
+	githubApi.SetCacheDirectory(filepath.Join(directoryPath, releasesCacheDirectory))
+
 	sourceUrl, err := g.getTagDownloadUrl()
 	if err != nil {
 		return err
@@ -121,7 +287,8 @@ func (g *GithubSource) MoveToDirectory(directoryPath string) error {
 		return err
 	}
 
-	if !g.overrideCache && cacheExists {
+	// Branches can move, they are downloaded again
+	if !g.overrideCache && cacheExists && (g.ref == "" || g.isPinned()) {
 		g.moved = true
 		return nil
 	}
@@ -130,21 +297,35 @@ func (g *GithubSource) MoveToDirectory(directoryPath string) error {
 		return err
 	}
 
-	if err := files.DownloadFile(tempManifestsPath, sourceUrl); err != nil {
+	if err := githubApi.Download(sourceUrl, tempManifestsPath); err != nil {
 		log.Printf("[error] Downloading %v: error %v", sourceUrl, err.Error())
 		return err
 	}
 
-	unzippedFiles, err := files.Unzip(tempManifestsPath, directoryPath)
+	extract := files.Unzip
+	if g.asset == github.AssetTarball {
+		extract = files.Untar
+	}
+	extractedFiles, err := extract(tempManifestsPath, directoryPath)
 	if err != nil {
 		return err
 	}
 
-	if len(unzippedFiles) == 0 {
+	if len(extractedFiles) == 0 {
 		return nil
 	}
 
-	if err := os.Rename(unzippedFiles[0], directoryPath+string(os.PathSeparator)+g.release.TagName); err != nil {
+	// The archive has a single top directory, e.g. onepanelio-manifests-<sha>
+	relativePath, err := filepath.Rel(directoryPath, extractedFiles[0])
+	if err != nil {
+		return err
+	}
+	topDirectory := filepath.Join(directoryPath, strings.Split(filepath.ToSlash(relativePath), "/")[0])
+
+	if err := os.MkdirAll(filepath.Dir(finalManifestPath), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(topDirectory, finalManifestPath); err != nil {
 		return err
 	}
 
@@ -181,6 +362,10 @@ func (d *DirectorySource) GetTag() string {
 	return ""
 }
 
+// SetOffline does nothing, DirectorySource never uses the network.
+func (d *DirectorySource) SetOffline(offline bool) {
+}
+
 func (d *DirectorySource) getManifestPath(directoryPath string) string {
 	lastPathSeparatorIndex := strings.LastIndex(d.sourceDirectory, string(os.PathSeparator))
 	if lastPathSeparatorIndex < 0 {
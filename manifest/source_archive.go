@@ -0,0 +1,226 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/onepanelio/cli/files"
+)
+
+const (
+	// SourceArchive refers to cli_config.yaml value,
+	// manifestSource:
+	//  archive:
+	// This indicates manifests should be retrieved from a .zip or .tar.gz archive.
+	SourceArchive = "archive"
+
+	// archiveCacheDirectory is the directory in the manifests directory with the extracted archives, by sha256
+	archiveCacheDirectory = "archive"
+)
+
+// sha256Regex matches a hex encoded sha256 digest
+var sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ArchiveSource gets the manifests from a .zip or .tar.gz archive at a url or local path.
+// The archive is only extracted if its sha256 digest matches, into a directory named after the digest.
+type ArchiveSource struct {
+	location      string // the url or local path of the archive
+	sha256        string // the expected sha256 digest of the archive, hex encoded
+	overrideCache bool   // if true, will override the local cached files.
+	offline       bool   // if true, the archive is not downloaded
+	moved         bool   // true if MoveToDirectory has been called
+	destination   string // the directory to move the manifest files to
+}
+
+func CreateArchiveSource(location, digest string, overrideCache bool) (*ArchiveSource, error) {
+	if location == "" {
+		return nil, fmt.Errorf("the archive source has no url")
+	}
+
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if !sha256Regex.MatchString(digest) {
+		return nil, fmt.Errorf("the archive source needs the sha256 digest of %v, as 64 hex characters", location)
+	}
+
+	source := &ArchiveSource{
+		location:      location,
+		sha256:        digest,
+		overrideCache: overrideCache,
+		moved:         false,
+	}
+	if _, err := source.getExtract(); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// GetSourceType returns the string name of ArchiveSource.
+func (a *ArchiveSource) GetSourceType() string {
+	return SourceArchive
+}
+
+// GetTag returns an empty string, the archive is identified by its sha256 digest.
+func (a *ArchiveSource) GetTag() string {
+	return ""
+}
+
+// SetOffline, if true, makes MoveToDirectory use the extracted archive or a local archive only.
+func (a *ArchiveSource) SetOffline(offline bool) {
+	a.offline = offline
+}
+
+// isRemote returns true if the archive has to be downloaded
+func (a *ArchiveSource) isRemote() bool {
+	return strings.HasPrefix(a.location, "http://") || strings.HasPrefix(a.location, "https://")
+}
+
+// getLocalPath returns the path of a local archive, which may be a file:// url
+func (a *ArchiveSource) getLocalPath() string {
+	if strings.HasPrefix(a.location, "file://") {
+		if fileUrl, err := url.Parse(a.location); err == nil {
+			return filepath.FromSlash(fileUrl.Path)
+		}
+	}
+
+	return a.location
+}
+
+// getExtract returns the function that extracts the archive, picked by its extension
+func (a *ArchiveSource) getExtract() (func(src string, dest string) ([]string, error), error) {
+	name := strings.ToLower(a.location)
+	if archiveUrl, err := url.Parse(a.location); err == nil && archiveUrl.Path != "" {
+		name = strings.ToLower(archiveUrl.Path)
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return files.Unzip, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return files.Untar, nil
+	}
+
+	return nil, fmt.Errorf("%v is not a .zip or .tar.gz archive", a.location)
+}
+
+func (a *ArchiveSource) getManifestPath(directoryPath string) string {
+	return filepath.Join(directoryPath, archiveCacheDirectory, a.sha256)
+}
+
+func (a *ArchiveSource) GetManifestPath() (string, error) {
+	if !a.moved {
+		return "", fmt.Errorf("files not yet moved. Unable to get manifest path")
+	}
+
+	return a.getManifestPath(a.destination), nil
+}
+
+func (a *ArchiveSource) MoveToDirectory(directoryPath string) error {
+	a.destination = directoryPath
+
+	finalManifestPath := a.getManifestPath(directoryPath)
+	cacheExists, err := files.Exists(finalManifestPath)
+	if err != nil {
+		return err
+	}
+
+	// The directory is named after the digest, so it has the content of the archive
+	if !a.overrideCache && cacheExists {
+		a.moved = true
+		return nil
+	}
+
+	archivePath := a.getLocalPath()
+	if a.isRemote() {
+		if a.offline {
+			return fmt.Errorf("%w, %v does not exist. Run init without --offline to download %v", ErrNotCached, finalManifestPath, a.location)
+		}
+
+		archivePath = finalManifestPath + ".download"
+		defer func() {
+			if _, err := files.DeleteIfExists(archivePath); err != nil {
+				log.Printf("[error] Deleting %v: %v", archivePath, err.Error())
+			}
+		}()
+		if err := os.MkdirAll(filepath.Dir(archivePath), os.ModePerm); err != nil {
+			return err
+		}
+		if err := files.DownloadFile(archivePath, a.location); err != nil {
+			return fmt.Errorf("unable to download %v: %w", a.location, err)
+		}
+	}
+
+	digest, err := fileSha256(archivePath)
+	if err != nil {
+		return err
+	}
+	if digest != a.sha256 {
+		return fmt.Errorf("the sha256 digest of %v is %v instead of %v, refusing to use it", a.location, digest, a.sha256)
+	}
+
+	if err := os.RemoveAll(finalManifestPath); err != nil {
+		return err
+	}
+	if err := a.extract(archivePath, finalManifestPath); err != nil {
+		os.RemoveAll(finalManifestPath)
+		return err
+	}
+
+	a.moved = true
+
+	return nil
+}
+
+// extract extracts the archive to finalManifestPath. If the archive has a single top directory, like the archives of
+// GitHub, its content is moved to finalManifestPath.
+func (a *ArchiveSource) extract(archivePath, finalManifestPath string) error {
+	extractArchive, err := a.getExtract()
+	if err != nil {
+		return err
+	}
+
+	extractPath := finalManifestPath + ".extract"
+	if err := os.RemoveAll(extractPath); err != nil {
+		return err
+	}
+	defer os.RemoveAll(extractPath)
+
+	if _, err := extractArchive(archivePath, extractPath); err != nil {
+		return fmt.Errorf("unable to extract %v: %w", a.location, err)
+	}
+
+	entries, err := ioutil.ReadDir(extractPath)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return os.Rename(filepath.Join(extractPath, entries[0].Name()), finalManifestPath)
+	}
+
+	return os.Rename(extractPath, finalManifestPath)
+}
+
+// fileSha256 returns the hex encoded sha256 digest of the file at filePath
+func fileSha256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,193 @@
+package manifest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testZip returns a zip archive with files, by name
+func testZip(t *testing.T, files map[string]string) []byte {
+	archive := &bytes.Buffer{}
+	writer := zip.NewWriter(archive)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		assert.Nil(t, err)
+		_, err = file.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, writer.Close())
+
+	return archive.Bytes()
+}
+
+// testDirectoryTarball returns a .tar.gz archive like tar -C dir -czf bundle.tar.gz . creates it, every name starts with ./
+func testDirectoryTarball(t *testing.T, content string) []byte {
+	archive := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(archive)
+	writer := tar.NewWriter(gzipWriter)
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0755}))
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./storage/", Mode: 0755}))
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "./manifest.yaml", Mode: 0644, Size: int64(len(content))}))
+	_, err := writer.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, gzipWriter.Close())
+
+	return archive.Bytes()
+}
+
+func testSha256(content []byte) string {
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:])
+}
+
+func testArchiveSourceManifest(t *testing.T, source Source) string {
+	manifestPath, err := source.GetManifestPath()
+	assert.Nil(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(manifestPath, "manifest.yaml"))
+	assert.Nil(t, err)
+
+	return string(content)
+}
+
+func TestArchiveSource_MoveToDirectory(t *testing.T) {
+	archive := testZip(t, map[string]string{"bundle-v1/manifest.yaml": "components: [v1]\n"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "archive")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	source, err := CreateArchiveSource(server.URL+"/bundle-v1.zip", strings.ToUpper(testSha256(archive)), false)
+	assert.Nil(t, err)
+	assert.Nil(t, source.MoveToDirectory(directory))
+	manifestPath, err := source.GetManifestPath()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(directory, "archive", testSha256(archive)), manifestPath)
+	assert.Equal(t, "components: [v1]\n", testArchiveSourceManifest(t, source))
+
+	// The extracted archive is used without downloading it again, also offline
+	server.Close()
+	source, err = CreateArchiveSource(server.URL+"/bundle-v1.zip", testSha256(archive), false)
+	assert.Nil(t, err)
+	source.SetOffline(true)
+	assert.Nil(t, source.MoveToDirectory(directory))
+	assert.Equal(t, "components: [v1]\n", testArchiveSourceManifest(t, source))
+
+	entries, err := ioutil.ReadDir(filepath.Join(directory, "archive"))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestArchiveSource_MoveToDirectory_Mismatch(t *testing.T) {
+	archive := testZip(t, map[string]string{"manifest.yaml": "components: [v1]\n"})
+	tampered := testZip(t, map[string]string{"manifest.yaml": "components: [evil]\n"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tampered)
+	}))
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "archive")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	source, err := CreateArchiveSource(server.URL+"/bundle.zip?token=abc", testSha256(archive), false)
+	assert.Nil(t, err)
+	err = source.MoveToDirectory(directory)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "refusing to use it")
+	_, err = source.GetManifestPath()
+	assert.NotNil(t, err)
+
+	// Nothing is kept, neither the archive nor its content
+	entries, err := ioutil.ReadDir(filepath.Join(directory, "archive"))
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	// Offline, archives that are not extracted yet can not be downloaded
+	source.SetOffline(true)
+	assert.True(t, errors.Is(source.MoveToDirectory(directory), ErrNotCached))
+}
+
+func TestArchiveSource_MoveToDirectory_Local(t *testing.T) {
+	directory, err := ioutil.TempDir("", "archive")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	destination := filepath.Join(directory, "manifests")
+
+	// The top directory of the tarball is removed, the zip has none
+	tarball := testTarball(t, "components: [tar]\n")
+	tarballPath := filepath.Join(directory, "bundle.tar.gz")
+	assert.Nil(t, ioutil.WriteFile(tarballPath, tarball, 0644))
+	archive := testZip(t, map[string]string{"manifest.yaml": "components: [zip]\n", "storage/kustomization.yaml": "resources: []\n"})
+	zipPath := filepath.Join(directory, "bundle.zip")
+	assert.Nil(t, ioutil.WriteFile(zipPath, archive, 0644))
+	directoryTarball := testDirectoryTarball(t, "components: [directory]\n")
+	directoryTarballPath := filepath.Join(directory, "directory.tgz")
+	assert.Nil(t, ioutil.WriteFile(directoryTarballPath, directoryTarball, 0644))
+
+	for _, testCase := range []struct {
+		location string
+		digest   string
+		expected string
+	}{
+		{location: tarballPath, digest: testSha256(tarball), expected: "components: [tar]\n"},
+		{location: "file://" + zipPath, digest: testSha256(archive), expected: "components: [zip]\n"},
+		{location: directoryTarballPath, digest: testSha256(directoryTarball), expected: "components: [directory]\n"},
+	} {
+		config := "manifestSource:\n  archive:\n    url: " + testCase.location + "\n    sha256: " + testCase.digest + "\n"
+		configPath := filepath.Join(directory, "cli_config.yaml")
+		assert.Nil(t, ioutil.WriteFile(configPath, []byte(config), 0644))
+		source, err := LoadManifestSourceFromFileConfig(configPath)
+		assert.Nil(t, err)
+		assert.Equal(t, SourceArchive, source.GetSourceType())
+
+		// Local archives do not need the network
+		source.SetOffline(true)
+		assert.Nil(t, source.MoveToDirectory(destination), testCase.location)
+		assert.Equal(t, testCase.expected, testArchiveSourceManifest(t, source))
+	}
+
+	// The zip slip protection of files.Unzip applies to verified archives as well
+	evilPath := filepath.Join(directory, "evil.zip")
+	evil := testZip(t, map[string]string{"../../evil.yaml": "components: [evil]\n"})
+	assert.Nil(t, ioutil.WriteFile(evilPath, evil, 0644))
+	source, err := CreateArchiveSource(evilPath, testSha256(evil), false)
+	assert.Nil(t, err)
+	assert.NotNil(t, source.MoveToDirectory(destination))
+	_, err = os.Stat(filepath.Join(directory, "evil.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCreateArchiveSource(t *testing.T) {
+	digest := strings.Repeat("a", 64)
+	for location, sha := range map[string]string{
+		"":                                   digest,
+		"https://example.com/bundle.zip":     "",
+		"https://example.com/bundle.tar.gz?": "abc",
+		"https://example.com/bundle.rar":     digest,
+	} {
+		_, err := CreateArchiveSource(location, sha, false)
+		assert.NotNil(t, err, location)
+	}
+
+	_, err := CreateArchiveSource("https://example.com/bundle.tgz?token=abc", digest, false)
+	assert.Nil(t, err)
+}
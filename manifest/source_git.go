@@ -0,0 +1,294 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/onepanelio/cli/files"
+)
+
+const (
+	// SourceGit refers to cli_config.yaml value,
+	// manifestSource:
+	//  git:
+	// This indicates manifests should be retrieved from a git repository.
+	SourceGit = "git"
+
+	// gitCacheDirectory is the directory in the manifests directory with the git sources, one directory per repository
+	gitCacheDirectory = "git"
+	// gitRepositoryDirectory is the mirror of the repository in the directory of a git source
+	gitRepositoryDirectory = ".repository"
+)
+
+// gitScpUrlRegex matches the scp-like urls of git, e.g. git@github.com:onepanelio/manifests.git
+var gitScpUrlRegex = regexp.MustCompile(`^[^/]+@[^/]+:`)
+
+// GitSource gets the manifests from a git repository, remote or local. The repository is mirrored into the manifests
+// directory, and every commit is checked out into a directory named after its SHA.
+type GitSource struct {
+	repository    string // the url or local path of the repository
+	ref           string // the branch, tag or commit SHA. HEAD if empty.
+	path          string // the directory of the manifests in the repository, if not at its root
+	overrideCache bool   // if true, will override the local cached files.
+	offline       bool   // if true, the repository is not fetched
+	commit        string // the SHA ref resolved to, set by MoveToDirectory
+	moved         bool   // true if MoveToDirectory has been called
+	destination   string // the directory to move the manifest files to
+}
+
+func CreateGitSource(repository, ref, path string, overrideCache bool) (*GitSource, error) {
+	if repository == "" {
+		return nil, fmt.Errorf("the git source has no repository")
+	}
+
+	source := &GitSource{
+		repository:    repository,
+		ref:           ref,
+		path:          path,
+		overrideCache: overrideCache,
+		moved:         false,
+	}
+
+	return source, nil
+}
+
+// GetSourceType returns the string name of GitSource.
+func (g *GitSource) GetSourceType() string {
+	return SourceGit
+}
+
+// GetTag returns an empty string, the manifests of a GitSource are not a release.
+// See GetCommit for the commit they are checked out at.
+func (g *GitSource) GetTag() string {
+	return ""
+}
+
+// GetCommit returns the SHA of the commit ref resolved to. Should only be called after MoveToDirectory
+func (g *GitSource) GetCommit() string {
+	return g.commit
+}
+
+// GetRepository returns the url or local path of the repository
+func (g *GitSource) GetRepository() string {
+	return g.repository
+}
+
+// SetOffline, if true, makes MoveToDirectory resolve the ref in the mirror of the repository, without fetching it.
+func (g *GitSource) SetOffline(offline bool) {
+	g.offline = offline
+}
+
+// getRemoteUrl returns the url the repository is cloned from. Local paths are made absolute,
+// git records them that way and the current directory may change.
+func (g *GitSource) getRemoteUrl() string {
+	if strings.Contains(g.repository, "://") || gitScpUrlRegex.MatchString(g.repository) {
+		return g.repository
+	}
+
+	if absolutePath, err := filepath.Abs(g.repository); err == nil {
+		return absolutePath
+	}
+
+	return g.repository
+}
+
+// getRepositoryName returns the name of the repository, e.g. manifests for https://github.com/onepanelio/manifests.git
+func (g *GitSource) getRepositoryName() string {
+	name := strings.TrimSuffix(strings.TrimRight(filepath.ToSlash(g.repository), "/"), ".git")
+	if index := strings.LastIndexAny(name, "/:"); index >= 0 {
+		name = name[index+1:]
+	}
+	if name == "" {
+		return "repository"
+	}
+
+	return name
+}
+
+func (g *GitSource) getSourceDirectory(directoryPath string) string {
+	return filepath.Join(directoryPath, gitCacheDirectory, g.getRepositoryName())
+}
+
+func (g *GitSource) getManifestPath(directoryPath string) string {
+	return filepath.Join(g.getSourceDirectory(directoryPath), g.commit, g.path)
+}
+
+func (g *GitSource) GetManifestPath() (string, error) {
+	if !g.moved {
+		return "", fmt.Errorf("files not yet moved. Unable to get manifest path")
+	}
+
+	return g.getManifestPath(g.destination), nil
+}
+
+func (g *GitSource) MoveToDirectory(directoryPath string) error {
+	g.destination = directoryPath
+
+	repositoryPath := filepath.Join(g.getSourceDirectory(directoryPath), gitRepositoryDirectory)
+	if err := g.updateRepository(repositoryPath); err != nil {
+		return err
+	}
+
+	ref := g.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commit, err := runGit(repositoryPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		if g.offline {
+			return fmt.Errorf("%w, %v is not in the mirror of %v. Run init without --offline to fetch it", ErrNotCached, ref, g.repository)
+		}
+		return fmt.Errorf("%v is not a branch, tag or commit of %v", ref, g.repository)
+	}
+	g.commit = commit
+
+	checkoutPath := filepath.Join(g.getSourceDirectory(directoryPath), commit)
+	cacheExists, err := files.Exists(checkoutPath)
+	if err != nil {
+		return err
+	}
+	if cacheExists && !g.overrideCache {
+		return g.checkManifestPath(directoryPath)
+	}
+
+	if err := os.RemoveAll(checkoutPath); err != nil {
+		return err
+	}
+	if err := g.checkout(repositoryPath, commit, checkoutPath); err != nil {
+		os.RemoveAll(checkoutPath)
+		return err
+	}
+
+	return g.checkManifestPath(directoryPath)
+}
+
+// updateRepository mirrors the repository to repositoryPath, or fetches it if it is already mirrored.
+// A commit SHA that is already mirrored is not fetched again, it can not change.
+func (g *GitSource) updateRepository(repositoryPath string) error {
+	exists, err := files.Exists(repositoryPath)
+	if err != nil {
+		return err
+	}
+
+	// The mirror of a repository that was replaced in cli_config.yaml, but has the same name
+	if exists {
+		url, err := runGit(repositoryPath, "config", "--get", "remote.origin.url")
+		if err != nil || url != g.getRemoteUrl() {
+			if err := os.RemoveAll(repositoryPath); err != nil {
+				return err
+			}
+			exists = false
+		}
+	}
+
+	if g.offline {
+		if !exists {
+			return fmt.Errorf("%w, %v is not mirrored. Run init without --offline to clone it", ErrNotCached, g.repository)
+		}
+		return nil
+	}
+
+	if !exists {
+		if err := os.MkdirAll(filepath.Dir(repositoryPath), os.ModePerm); err != nil {
+			return err
+		}
+		if _, err := runGit("", "clone", "--mirror", "--quiet", g.getRemoteUrl(), repositoryPath); err != nil {
+			return fmt.Errorf("unable to clone %v: %w", g.repository, err)
+		}
+		return nil
+	}
+
+	if commitShaRegex.MatchString(g.ref) {
+		if _, err := runGit(repositoryPath, "rev-parse", "--verify", "--quiet", g.ref+"^{commit}"); err == nil {
+			return nil
+		}
+	}
+
+	if _, err := runGit(repositoryPath, "fetch", "--prune", "--quiet", "origin"); err != nil {
+		return fmt.Errorf("unable to fetch %v: %w", g.repository, err)
+	}
+
+	return nil
+}
+
+// checkout writes the files of commit to checkoutPath, without the git metadata
+func (g *GitSource) checkout(repositoryPath, commit, checkoutPath string) error {
+	if err := os.MkdirAll(checkoutPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	stderr := &bytes.Buffer{}
+	command := exec.Command("git", "-C", repositoryPath, "archive", "--format=tar", commit)
+	command.Stderr = stderr
+	archive, err := command.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := command.Start(); err != nil {
+		return fmt.Errorf("unable to run git: %w", err)
+	}
+
+	_, err = files.ExtractTar(archive, checkoutPath)
+	if err == nil {
+		// The archive may be padded after the end of the tar stream, git only exits once it is written
+		_, err = io.Copy(ioutil.Discard, archive)
+	}
+	if err != nil {
+		// Nothing reads the rest of the archive anymore, git would block writing it to the pipe
+		command.Process.Kill()
+		command.Wait()
+		return fmt.Errorf("unable to check out %v of %v: %w", commit, g.repository, err)
+	}
+	if err := command.Wait(); err != nil {
+		return fmt.Errorf("unable to check out %v of %v: %v", commit, g.repository, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// checkManifestPath returns an error if the path of the manifests does not exist in the checked out commit
+func (g *GitSource) checkManifestPath(directoryPath string) error {
+	manifestPath := g.getManifestPath(directoryPath)
+	exists, err := files.Exists(manifestPath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%v does not exist in %v at %v", g.path, g.repository, g.commit)
+	}
+
+	g.moved = true
+
+	return nil
+}
+
+// runGit runs git with args in directory, or the current directory if it is empty, and returns its trimmed output.
+// Prompts for credentials are disabled, so git fails instead of waiting for input.
+func runGit(directory string, args ...string) (string, error) {
+	if directory != "" {
+		args = append([]string{"-C", directory}, args...)
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	command := exec.Command("git", args...)
+	command.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	command.Stdout = stdout
+	command.Stderr = stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", errors.New(message)
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
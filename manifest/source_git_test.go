@@ -0,0 +1,150 @@
+package manifest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testGitRepository creates a repository with the manifests in the manifests directory on the branch main, and returns its path
+func testGitRepository(t *testing.T, directory string) string {
+	for key, value := range map[string]string{
+		"GIT_AUTHOR_NAME":     "opctl",
+		"GIT_AUTHOR_EMAIL":    "opctl@example.com",
+		"GIT_COMMITTER_NAME":  "opctl",
+		"GIT_COMMITTER_EMAIL": "opctl@example.com",
+	} {
+		assert.Nil(t, os.Setenv(key, value))
+	}
+
+	repositoryPath := filepath.Join(directory, "manifests")
+	assert.Nil(t, os.MkdirAll(filepath.Join(repositoryPath, "manifests"), os.ModePerm))
+	_, err := runGit(repositoryPath, "init", "--quiet")
+	assert.Nil(t, err)
+	_, err = runGit(repositoryPath, "symbolic-ref", "HEAD", "refs/heads/main")
+	assert.Nil(t, err)
+	testGitCommit(t, repositoryPath, "components: [v1]\n")
+
+	return repositoryPath
+}
+
+// testGitCommit commits content as manifests/manifest.yaml and returns the SHA of the commit
+func testGitCommit(t *testing.T, repositoryPath, content string) string {
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(repositoryPath, "manifests", "manifest.yaml"), []byte(content), 0644))
+	_, err := runGit(repositoryPath, "add", "--all")
+	assert.Nil(t, err)
+	_, err = runGit(repositoryPath, "commit", "--quiet", "--message", content)
+	assert.Nil(t, err)
+	commit, err := runGit(repositoryPath, "rev-parse", "HEAD")
+	assert.Nil(t, err)
+
+	return commit
+}
+
+func testGitSourceManifest(t *testing.T, source *GitSource) string {
+	manifestPath, err := source.GetManifestPath()
+	assert.Nil(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(manifestPath, "manifest.yaml"))
+	assert.Nil(t, err)
+
+	return string(content)
+}
+
+func TestGitSource_MoveToDirectory(t *testing.T) {
+	directory, err := ioutil.TempDir("", "git")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	repositoryPath := testGitRepository(t, directory)
+	firstCommit, err := runGit(repositoryPath, "rev-parse", "HEAD")
+	assert.Nil(t, err)
+	destination := filepath.Join(directory, ".onepanel", "manifests")
+
+	source, err := CreateGitSource("file://"+repositoryPath, "main", "manifests", false)
+	assert.Nil(t, err)
+	assert.Nil(t, source.MoveToDirectory(destination))
+	assert.Equal(t, firstCommit, source.GetCommit())
+	manifestPath, err := source.GetManifestPath()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(destination, "git", "manifests", firstCommit, "manifests"), manifestPath)
+	assert.Equal(t, "components: [v1]\n", testGitSourceManifest(t, source))
+	_, err = os.Stat(filepath.Join(destination, "git", "manifests", firstCommit, ".git"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Branches are fetched again
+	secondCommit := testGitCommit(t, repositoryPath, "components: [v2]\n")
+	source, err = CreateGitSource("file://"+repositoryPath, "main", "manifests", false)
+	assert.Nil(t, err)
+	assert.Nil(t, source.MoveToDirectory(destination))
+	assert.Equal(t, secondCommit, source.GetCommit())
+	assert.Equal(t, "components: [v2]\n", testGitSourceManifest(t, source))
+
+	// Commits are checked out as they were
+	source, err = CreateGitSource("file://"+repositoryPath, firstCommit, "manifests", false)
+	assert.Nil(t, err)
+	assert.Nil(t, source.MoveToDirectory(destination))
+	assert.Equal(t, "components: [v1]\n", testGitSourceManifest(t, source))
+
+	// Offline, the ref is resolved in the mirror
+	thirdCommit := testGitCommit(t, repositoryPath, "components: [v3]\n")
+	source, err = CreateGitSource("file://"+repositoryPath, "main", "manifests", false)
+	assert.Nil(t, err)
+	source.SetOffline(true)
+	assert.Nil(t, source.MoveToDirectory(destination))
+	assert.Equal(t, secondCommit, source.GetCommit())
+
+	source, err = CreateGitSource("file://"+repositoryPath, thirdCommit, "manifests", false)
+	assert.Nil(t, err)
+	source.SetOffline(true)
+	assert.True(t, errors.Is(source.MoveToDirectory(destination), ErrNotCached))
+
+	source.SetOffline(false)
+	assert.Nil(t, source.MoveToDirectory(destination))
+	assert.Equal(t, "components: [v3]\n", testGitSourceManifest(t, source))
+}
+
+func TestGitSource_MoveToDirectory_Errors(t *testing.T) {
+	directory, err := ioutil.TempDir("", "git")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	repositoryPath := testGitRepository(t, directory)
+	destination := filepath.Join(directory, ".onepanel", "manifests")
+
+	source, err := CreateGitSource(repositoryPath, "main", "manifests", false)
+	assert.Nil(t, err)
+	source.SetOffline(true)
+	assert.True(t, errors.Is(source.MoveToDirectory(destination), ErrNotCached))
+
+	// Local paths work like file:// urls
+	for ref, path := range map[string]string{"feature": "manifests", "main": "missing"} {
+		source, err = CreateGitSource(repositoryPath, ref, path, false)
+		assert.Nil(t, err)
+		assert.NotNil(t, source.MoveToDirectory(destination), ref)
+		_, err = source.GetManifestPath()
+		assert.NotNil(t, err)
+	}
+
+	_, err = CreateGitSource("", "main", "", false)
+	assert.NotNil(t, err)
+}
+
+func TestLoadManifestSourceFromFileConfig_Git(t *testing.T) {
+	directory, err := ioutil.TempDir("", "git")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	configPath := filepath.Join(directory, "cli_config.yaml")
+
+	config := "manifestSource:\n  git:\n    repository: git@github.com:onepanelio/manifests.git\n    ref: feature/gpu\n    path: manifests\n"
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte(config), 0644))
+	source, err := LoadManifestSourceFromFileConfig(configPath)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceGit, source.GetSourceType())
+	gitSource := source.(*GitSource)
+	assert.Equal(t, "feature/gpu", gitSource.ref)
+	assert.Equal(t, "manifests", gitSource.path)
+	assert.Equal(t, "manifests", gitSource.getRepositoryName())
+	assert.Equal(t, "git@github.com:onepanelio/manifests.git", gitSource.getRemoteUrl())
+}
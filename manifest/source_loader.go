@@ -17,11 +17,40 @@ type SourceConfig struct {
 type ManifestSourceConfig struct {
 	Github    *GithubSourceConfig    `yaml:"github,omitempty"`
 	Directory *DirectorySourceConfig `yaml:"directory,omitempty"`
+	Git       *GitSourceConfig       `yaml:"git,omitempty"`
+	Archive   *ArchiveSourceConfig   `yaml:"archive,omitempty"`
 }
 
 type GithubSourceConfig struct {
 	Tag           *string
 	OverrideCache *bool `yaml:"overrideCache,omitempty"` // default is false
+	// Ref is a branch or commit SHA to download instead of the release of Tag
+	Ref string `yaml:"ref,omitempty"`
+	// Owner and Repo name the repository of the manifests, e.g. a fork. Default is onepanelio/manifests
+	Owner string `yaml:"owner,omitempty"`
+	Repo  string `yaml:"repo,omitempty"`
+	// ApiUrl is the url of the GitHub API, e.g. https://github.example.com/api/v3 for GitHub Enterprise
+	ApiUrl string `yaml:"apiUrl,omitempty"`
+	// Asset is the source archive to download, zipball or tarball. Default is zipball
+	Asset string `yaml:"asset,omitempty"`
+}
+
+type GitSourceConfig struct {
+	// Repository is the url or local path of the repository, e.g. https://github.com/onepanelio/manifests.git
+	Repository string `yaml:"repository"`
+	// Ref is the branch, tag or commit SHA to check out. Default is the HEAD of the repository
+	Ref string `yaml:"ref,omitempty"`
+	// Path is the directory of the manifests in the repository, if they are not at its root
+	Path          string `yaml:"path,omitempty"`
+	OverrideCache *bool  `yaml:"overrideCache,omitempty"` // default is false
+}
+
+type ArchiveSourceConfig struct {
+	// Url is the url or local path of a .zip or .tar.gz archive with the manifests
+	Url string `yaml:"url"`
+	// Sha256 is the hex encoded sha256 digest of the archive. It is required, archives that do not match are not used
+	Sha256        string `yaml:"sha256"`
+	OverrideCache *bool  `yaml:"overrideCache,omitempty"` // default is false
 }
 
 type DirectorySourceConfig struct {
@@ -29,21 +58,31 @@ type DirectorySourceConfig struct {
 	OverrideCache *bool  `yaml:"overrideCache,omitempty"` // default is false
 }
 
-// This will override the file that already exists at path
+// This will override the file that already exists at path.
+// The repository, API url and asset of an existing github source are kept, only the tag is replaced.
 func CreateGithubSourceConfigFile(path string) error {
+	githubConfig := &GithubSourceConfig{}
+	if fileData, err := ioutil.ReadFile(path); err == nil {
+		existing := &SourceConfig{}
+		if err := yaml.Unmarshal(fileData, existing); err == nil && existing.ManifestSourceConfig.Github != nil {
+			githubConfig.Owner = existing.ManifestSourceConfig.Github.Owner
+			githubConfig.Repo = existing.ManifestSourceConfig.Github.Repo
+			githubConfig.ApiUrl = existing.ManifestSourceConfig.Github.ApiUrl
+			githubConfig.Asset = existing.ManifestSourceConfig.Github.Asset
+		}
+	}
+
 	_, err := files.DeleteIfExists(path)
 	if err != nil {
 		return err
 	}
 
 	tag := config.ManifestsRepositoryTag
+	githubConfig.Tag = &tag
 
 	sourceConfig := SourceConfig{
 		ManifestSourceConfig: ManifestSourceConfig{
-			Github: &GithubSourceConfig{
-				Tag:           &tag,
-				OverrideCache: nil,
-			},
+			Github: githubConfig,
 		},
 	}
 
@@ -88,10 +127,22 @@ func LoadManifestSourceFromFileConfig(configFilePath string) (source Source, err
 		return loadDirectorySource(config.ManifestSourceConfig.Directory)
 	}
 
+	if config.ManifestSourceConfig.Git != nil {
+		return loadGitSource(config.ManifestSourceConfig.Git)
+	}
+
+	if config.ManifestSourceConfig.Archive != nil {
+		return loadArchiveSource(config.ManifestSourceConfig.Archive)
+	}
+
 	return nil, fmt.Errorf("%v is badly formatted. No Source Config found", configFilePath)
 }
 
 func loadGithubSource(config *GithubSourceConfig) (source Source, err error) {
+	if config.Tag != nil && config.Ref != "" {
+		return nil, fmt.Errorf("the github source has a tag and a ref, only one can be set")
+	}
+
 	if config.Tag == nil {
 		latest := "latest"
 		config.Tag = &latest
@@ -102,7 +153,21 @@ func loadGithubSource(config *GithubSourceConfig) (source Source, err error) {
 		config.OverrideCache = &overrideCache
 	}
 
-	return CreateGithubSource(*config.Tag, *config.OverrideCache)
+	githubSource, err := CreateGithubSource(*config.Tag, *config.OverrideCache)
+	if err != nil {
+		return nil, err
+	}
+	githubSource.SetRepository(config.ApiUrl, config.Owner, config.Repo)
+	if config.Asset != "" {
+		if err := githubSource.SetAsset(config.Asset); err != nil {
+			return nil, err
+		}
+	}
+	if config.Ref != "" {
+		githubSource.SetRef(config.Ref)
+	}
+
+	return githubSource, nil
 }
 
 func loadDirectorySource(config *DirectorySourceConfig) (source Source, err error) {
@@ -113,3 +178,21 @@ func loadDirectorySource(config *DirectorySourceConfig) (source Source, err erro
 
 	return CreateDirectorySource(config.From, *config.OverrideCache)
 }
+
+func loadGitSource(config *GitSourceConfig) (source Source, err error) {
+	if config.OverrideCache == nil {
+		overrideCache := false
+		config.OverrideCache = &overrideCache
+	}
+
+	return CreateGitSource(config.Repository, config.Ref, config.Path, *config.OverrideCache)
+}
+
+func loadArchiveSource(config *ArchiveSourceConfig) (source Source, err error) {
+	if config.OverrideCache == nil {
+		overrideCache := false
+		config.OverrideCache = &overrideCache
+	}
+
+	return CreateArchiveSource(config.Url, config.Sha256, *config.OverrideCache)
+}
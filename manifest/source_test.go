@@ -0,0 +1,225 @@
+package manifest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/onepanelio/cli/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// testGithubServer serves the release v0.1.0 of a manifests repository and counts the requests it gets
+func testGithubServer(t *testing.T, requests *int32) *httptest.Server {
+	archive := &bytes.Buffer{}
+	writer := zip.NewWriter(archive)
+	// Like GitHub, the top directory comes first
+	_, err := writer.Create("onepanelio-manifests-abc123/")
+	assert.Nil(t, err)
+	file, err := writer.Create("onepanelio-manifests-abc123/manifest.yaml")
+	assert.Nil(t, err)
+	_, err = file.Write([]byte("components: []\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		switch r.URL.Path {
+		case "/releases/latest", "/releases/tags/v0.1.0":
+			json.NewEncoder(w).Encode(&github.Release{TagName: "v0.1.0", ZipBallUrl: server.URL + "/zipball/v0.1.0"})
+		case "/zipball/v0.1.0":
+			w.Write(archive.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return server
+}
+
+func testGithubSource(t *testing.T, server *httptest.Server, tag string, offline bool) *GithubSource {
+	source, err := CreateGithubSource(tag, false)
+	assert.Nil(t, err)
+	api, err := github.NewWithClient(server.URL, server.Client())
+	assert.Nil(t, err)
+	source.SetGithub(api)
+	source.SetOffline(offline)
+
+	return source
+}
+
+func TestGithubSource_MoveToDirectory(t *testing.T) {
+	var requests int32
+	server := testGithubServer(t, &requests)
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "manifests")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	source := testGithubSource(t, server, "v0.1.0", false)
+	assert.Nil(t, source.MoveToDirectory(directory))
+	manifestPath, err := source.GetManifestPath()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(directory, "v0.1.0"), manifestPath)
+	content, err := ioutil.ReadFile(filepath.Join(manifestPath, "manifest.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, "components: []\n", string(content))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// A pinned tag is served from the cache without querying GitHub, also offline
+	for _, offline := range []bool{false, true} {
+		source = testGithubSource(t, server, "v0.1.0", offline)
+		assert.Nil(t, source.MoveToDirectory(directory))
+		manifestPath, err = source.GetManifestPath()
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(directory, "v0.1.0"), manifestPath)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// latest has to be resolved by GitHub, the release is then found in the cache
+	source = testGithubSource(t, server, "latest", false)
+	assert.Nil(t, source.MoveToDirectory(directory))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestGithubSource_MoveToDirectory_Offline(t *testing.T) {
+	var requests int32
+	server := testGithubServer(t, &requests)
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "manifests")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	for _, tag := range []string{"v0.1.0", "latest"} {
+		source := testGithubSource(t, server, tag, true)
+		err := source.MoveToDirectory(directory)
+		assert.True(t, errors.Is(err, ErrNotCached), tag)
+		_, err = source.GetManifestPath()
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
+
+// testTarball returns a tarball like the archives of GitHub, with a pax header and a single top directory
+func testTarball(t *testing.T, content string) []byte {
+	archive := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(archive)
+	writer := tar.NewWriter(gzipWriter)
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "abc123"}}))
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "acme-manifests-abc123/", Mode: 0755}))
+	assert.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "acme-manifests-abc123/manifest.yaml", Mode: 0644, Size: int64(len(content))}))
+	_, err := writer.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, gzipWriter.Close())
+
+	return archive.Bytes()
+}
+
+func TestGithubSource_MoveToDirectory_Ref(t *testing.T) {
+	sha := strings.Repeat("a", 40)
+	branchContent := "components: [main]\n"
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/repos/acme/manifests/tarball/feature/gpu":
+			w.Write(testTarball(t, branchContent))
+		case "/repos/acme/manifests/tarball/" + sha:
+			w.Write(testTarball(t, "components: [sha]\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "manifests")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	configPath := filepath.Join(directory, "cli_config.yaml")
+	newSource := func(ref string) Source {
+		config := "manifestSource:\n  github:\n    owner: acme\n    repo: manifests\n    apiUrl: " + server.URL + "\n    asset: tarball\n    ref: " + ref + "\n"
+		assert.Nil(t, ioutil.WriteFile(configPath, []byte(config), 0644))
+		source, err := LoadManifestSourceFromFileConfig(configPath)
+		assert.Nil(t, err)
+		assert.Equal(t, "", source.GetTag())
+		return source
+	}
+	readManifest := func(source Source) string {
+		manifestPath, err := source.GetManifestPath()
+		assert.Nil(t, err)
+		content, err := ioutil.ReadFile(filepath.Join(manifestPath, "manifest.yaml"))
+		assert.Nil(t, err)
+		return string(content)
+	}
+
+	// Branches are downloaded every time, into the directory of the repository
+	source := newSource("feature/gpu")
+	assert.Nil(t, source.MoveToDirectory(directory))
+	manifestPath, err := source.GetManifestPath()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(directory, "acme", "manifests", "feature-gpu"), manifestPath)
+	assert.Equal(t, "components: [main]\n", readManifest(source))
+
+	branchContent = "components: [main, gpu]\n"
+	source = newSource("feature/gpu")
+	assert.Nil(t, source.MoveToDirectory(directory))
+	assert.Equal(t, "components: [main, gpu]\n", readManifest(source))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Commits can not change, they are cached
+	for i := 0; i < 2; i++ {
+		source = newSource(sha)
+		assert.Nil(t, source.MoveToDirectory(directory))
+		assert.Equal(t, "components: [sha]\n", readManifest(source))
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// Offline, the branch is served as it was last downloaded
+	source = newSource("feature/gpu")
+	source.SetOffline(true)
+	assert.Nil(t, source.MoveToDirectory(directory))
+	assert.Equal(t, "components: [main, gpu]\n", readManifest(source))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestLoadManifestSourceFromFileConfig_Github(t *testing.T) {
+	directory, err := ioutil.TempDir("", "manifests")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	configPath := filepath.Join(directory, "cli_config.yaml")
+
+	for _, config := range []string{
+		"manifestSource:\n  github:\n    tag: v0.1.0\n    ref: main\n",
+		"manifestSource:\n  github:\n    asset: tarball.gz\n",
+	} {
+		assert.Nil(t, ioutil.WriteFile(configPath, []byte(config), 0644))
+		_, err := LoadManifestSourceFromFileConfig(configPath)
+		assert.NotNil(t, err, config)
+	}
+
+	// Updating the tag keeps the repository of a fork
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte("manifestSource:\n  github:\n    tag: v0.0.1\n    owner: acme\n    asset: tarball\n"), 0644))
+	assert.Nil(t, CreateGithubSourceConfigFile(configPath))
+	source, err := LoadManifestSourceFromFileConfig(configPath)
+	assert.Nil(t, err)
+	githubSource := source.(*GithubSource)
+	assert.Equal(t, "acme/manifests", githubSource.GetRepository())
+	assert.False(t, githubSource.IsDefaultRepository())
+	assert.Equal(t, "tarball", githubSource.asset)
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClusterClient is every operation opctl performs on the resources of a cluster.
+// See DynamicClusterClient, FakeClusterClient, DryRunClusterClient and LockedClusterClient.
+type ClusterClient interface {
+	// Apply creates or updates each resource, in order, like kubectl apply.
+	// CustomResourceDefinitions are applied first and waited for, up to timeout, so custom resources can be part of resources.
+	Apply(timeout time.Duration, resources ...*unstructured.Unstructured) error
+	// Get returns the live resource, or nil if it does not exist
+	Get(apiVersion, kind, namespace, name string) (*unstructured.Unstructured, error)
+	// List returns the live resources of a kind in namespace that match labelSelector. An empty namespace lists all namespaces.
+	List(apiVersion, kind, namespace, labelSelector string) ([]*unstructured.Unstructured, error)
+	// Delete deletes each resource, in order. Resources that do not exist are skipped.
+	Delete(resources ...*unstructured.Unstructured) error
+	// Wait blocks until every workload is ready. If the timeout passes first, a *NotReadyError is returned.
+	Wait(timeout time.Duration, workloads ...Workload) error
+	// ListEvents returns the events in namespace
+	ListEvents(namespace string) ([]corev1.Event, error)
+	// ServerVersion returns the version of the kubernetes API server
+	ServerVersion() (*version.Info, error)
+	// Describe returns a description of the live resource and its events, like kubectl describe
+	Describe(apiVersion, kind, namespace, name string) (string, error)
+	// Logs returns the last tailLines lines of the logs of a container of a pod
+	Logs(namespace, pod, container string, tailLines int64) (string, error)
+	// Kubernetes returns the typed client of the cluster, e.g. for the stores of opctl and a ReadinessChecker
+	Kubernetes() kubernetes.Interface
+	// ResourceDiffer creates a ResourceDiffer that compares rendered resources of deployment with the live resources
+	ResourceDiffer(deployment string) *ResourceDiffer
+}
+
+// IsClusterUnreachable returns true if err means the cluster could not be reached,
+// e.g. there is no kubeconfig or the API server does not respond.
+// Only use it for errors of requests to the cluster, any transport error counts whatever the host was.
+func IsClusterUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if aggregate, ok := err.(utilerrors.Aggregate); ok {
+		for _, item := range aggregate.Errors() {
+			if IsClusterUnreachable(item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if clientcmd.IsEmptyConfig(err) || utilnet.IsConnectionRefused(err) {
+		return true
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// kubectl only keeps the message of some errors
+	message := err.Error()
+	return strings.Contains(message, "connection refused") || strings.Contains(message, "no such host")
+}
@@ -0,0 +1,100 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DryRunClusterClient reads the live resources from another ClusterClient, but only prints the changes it would make
+type DryRunClusterClient struct {
+	client ClusterClient
+	out    io.Writer
+}
+
+// NewDryRunClusterClient creates a DryRunClusterClient that reads from client and prints to out
+func NewDryRunClusterClient(client ClusterClient, out io.Writer) *DryRunClusterClient {
+	return &DryRunClusterClient{
+		client: client,
+		out:    out,
+	}
+}
+
+// Apply prints whether each resource would be created or configured
+func (c *DryRunClusterClient) Apply(timeout time.Duration, resources ...*unstructured.Unstructured) error {
+	for _, resource := range resources {
+		live, err := c.client.Get(resource.GetAPIVersion(), resource.GetKind(), resource.GetNamespace(), resource.GetName())
+		if err != nil {
+			return resourceError(resource, err)
+		}
+
+		action := "configured"
+		if live == nil {
+			action = "created"
+		}
+		fmt.Fprintf(c.out, "%v %v (dry run)\n", ResourceDisplayName(resource), action)
+	}
+
+	return nil
+}
+
+func (c *DryRunClusterClient) Get(apiVersion, kind, namespace, name string) (*unstructured.Unstructured, error) {
+	return c.client.Get(apiVersion, kind, namespace, name)
+}
+
+func (c *DryRunClusterClient) List(apiVersion, kind, namespace, labelSelector string) ([]*unstructured.Unstructured, error) {
+	return c.client.List(apiVersion, kind, namespace, labelSelector)
+}
+
+// Kubernetes returns the typed client of the other ClusterClient, changes made with it are not dry runs
+func (c *DryRunClusterClient) Kubernetes() kubernetes.Interface {
+	return c.client.Kubernetes()
+}
+
+// ResourceDiffer returns the ResourceDiffer of the other ClusterClient, it only sends dry runs
+func (c *DryRunClusterClient) ResourceDiffer(deployment string) *ResourceDiffer {
+	return c.client.ResourceDiffer(deployment)
+}
+
+// Delete prints each resource that exists and would be deleted
+func (c *DryRunClusterClient) Delete(resources ...*unstructured.Unstructured) error {
+	for _, resource := range resources {
+		live, err := c.client.Get(resource.GetAPIVersion(), resource.GetKind(), resource.GetNamespace(), resource.GetName())
+		if err != nil {
+			return resourceError(resource, err)
+		}
+		if live == nil {
+			continue
+		}
+
+		fmt.Fprintf(c.out, "%v deleted (dry run)\n", ResourceDisplayName(resource))
+	}
+
+	return nil
+}
+
+// Wait returns right away, nothing was changed to wait for
+func (c *DryRunClusterClient) Wait(timeout time.Duration, workloads ...Workload) error {
+	return nil
+}
+
+func (c *DryRunClusterClient) ListEvents(namespace string) ([]corev1.Event, error) {
+	return c.client.ListEvents(namespace)
+}
+
+func (c *DryRunClusterClient) ServerVersion() (*version.Info, error) {
+	return c.client.ServerVersion()
+}
+
+func (c *DryRunClusterClient) Describe(apiVersion, kind, namespace, name string) (string, error) {
+	return c.client.Describe(apiVersion, kind, namespace, name)
+}
+
+func (c *DryRunClusterClient) Logs(namespace, pod, container string, tailLines int64) (string, error) {
+	return c.client.Logs(namespace, pod, container, tailLines)
+}
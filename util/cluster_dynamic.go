@@ -0,0 +1,368 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/kubectl/pkg/describe"
+	"k8s.io/kubectl/pkg/describe/versioned"
+)
+
+// resettableRESTMapper is a RESTMapper whose cached discovery can be reset, e.g. after new kinds were added
+type resettableRESTMapper interface {
+	meta.RESTMapper
+	Reset()
+}
+
+// DynamicClusterClient is a ClusterClient that uses the dynamic client, so it works with any kind of resource
+type DynamicClusterClient struct {
+	client    dynamic.Interface
+	kube      kubernetes.Interface
+	mapper    resettableRESTMapper
+	namespace string // used for namespaced resources that do not specify one
+	// getter is used by Describe, kubectl describers create their own clients
+	getter genericclioptions.RESTClientGetter
+}
+
+// NewDynamicClusterClient creates a DynamicClusterClient that uses the clients and mapper to access resources
+func NewDynamicClusterClient(client dynamic.Interface, kube kubernetes.Interface, mapper resettableRESTMapper, namespace string) *DynamicClusterClient {
+	return &DynamicClusterClient{
+		client:    client,
+		kube:      kube,
+		mapper:    mapper,
+		namespace: namespace,
+	}
+}
+
+// NewClusterClient creates a DynamicClusterClient for the cluster selected by the options, see SetKubeConfigOptions
+func NewClusterClient() (*DynamicClusterClient, error) {
+	f := newFactory()
+
+	client, err := f.DynamicClient()
+	if err != nil {
+		return nil, err
+	}
+
+	kube, err := f.KubernetesClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryClient, err := f.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, _, err := f.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterClient := NewDynamicClusterClient(client, kube, restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient), namespace)
+	clusterClient.getter = f
+
+	return clusterClient, nil
+}
+
+// Apply creates or updates each resource like kubectl apply. The last applied configuration is kept in an annotation,
+// so fields that are removed from a resource are removed from the live resource as well.
+func (c *DynamicClusterClient) Apply(timeout time.Duration, resources ...*unstructured.Unstructured) error {
+	crds, rest := SplitCustomResourceDefinitions(resources)
+	if len(crds) != 0 {
+		for _, crd := range crds {
+			if err := c.applyResource(crd); err != nil {
+				return err
+			}
+		}
+
+		if err := WaitForCustomResourceDefinitionsWithClient(c.client, crds, timeout); err != nil {
+			return err
+		}
+		// The kinds of the custom resource definitions are not known to the mapper yet
+		c.mapper.Reset()
+	}
+
+	for _, resource := range rest {
+		if err := c.applyResource(resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *DynamicClusterClient) applyResource(resource *unstructured.Unstructured) error {
+	resourceClient, resource, err := c.resourceClient(resource)
+	if err != nil {
+		return resourceError(resource, err)
+	}
+
+	modified, err := setLastAppliedConfiguration(resource)
+	if err != nil {
+		return resourceError(resource, err)
+	}
+
+	live, err := resourceClient.Get(resource.GetName(), v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = resourceClient.Create(resource, v1.CreateOptions{})
+		return resourceError(resource, err)
+	}
+	if err != nil {
+		return resourceError(resource, err)
+	}
+
+	original := []byte(live.GetAnnotations()[corev1.LastAppliedConfigAnnotation])
+	current, err := json.Marshal(live.Object)
+	if err != nil {
+		return resourceError(resource, err)
+	}
+
+	patchType, patch, err := applyPatch(resource.GroupVersionKind(), original, modified, current)
+	if err != nil {
+		return resourceError(resource, err)
+	}
+	if string(patch) == "{}" {
+		return nil
+	}
+
+	_, err = resourceClient.Patch(resource.GetName(), patchType, patch, v1.PatchOptions{})
+
+	return resourceError(resource, err)
+}
+
+// Get returns nil, with no error, if the kind is not known to the cluster
+func (c *DynamicClusterClient) Get(apiVersion, kind, namespace, name string) (*unstructured.Unstructured, error) {
+	resource := &unstructured.Unstructured{}
+	resource.SetAPIVersion(apiVersion)
+	resource.SetKind(kind)
+	resource.SetNamespace(namespace)
+	resource.SetName(name)
+
+	resourceClient, resource, err := c.resourceClient(resource)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := resourceClient.Get(name, v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return live, nil
+}
+
+// List returns no resources, and no error, if the kind is not known to the cluster
+func (c *DynamicClusterClient) List(apiVersion, kind, namespace, labelSelector string) ([]*unstructured.Unstructured, error) {
+	gvk := schema.FromAPIVersionAndKind(apiVersion, kind)
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return []*unstructured.Unstructured{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resourceClient dynamic.ResourceInterface = c.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && namespace != "" {
+		resourceClient = c.client.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	list, err := resourceClient.List(v1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*unstructured.Unstructured, 0)
+	for i := range list.Items {
+		results = append(results, &list.Items[i])
+	}
+
+	return results, nil
+}
+
+// Delete deletes the resources in the background, it does not wait for them to be gone.
+// Resources whose kind is not known to the cluster are skipped, they can not exist.
+func (c *DynamicClusterClient) Delete(resources ...*unstructured.Unstructured) error {
+	propagation := v1.DeletePropagationBackground
+	for _, resource := range resources {
+		resourceClient, resource, err := c.resourceClient(resource)
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return resourceError(resource, err)
+		}
+
+		err = resourceClient.Delete(resource.GetName(), &v1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return resourceError(resource, err)
+		}
+	}
+
+	return nil
+}
+
+// Wait uses a ReadinessChecker, see ReadinessChecker.WaitForReady
+func (c *DynamicClusterClient) Wait(timeout time.Duration, workloads ...Workload) error {
+	return NewReadinessChecker(c.kube).WaitForReady(timeout, workloads...)
+}
+
+func (c *DynamicClusterClient) ListEvents(namespace string) ([]corev1.Event, error) {
+	events, err := c.kube.CoreV1().Events(namespace).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return events.Items, nil
+}
+
+func (c *DynamicClusterClient) ServerVersion() (*version.Info, error) {
+	return c.kube.Discovery().ServerVersion()
+}
+
+// Describe uses the describers of kubectl, it is only supported by clients created with NewClusterClient
+func (c *DynamicClusterClient) Describe(apiVersion, kind, namespace, name string) (string, error) {
+	if c.getter == nil {
+		return "", fmt.Errorf("describe is not supported by this client")
+	}
+
+	gvk := schema.FromAPIVersionAndKind(apiVersion, kind)
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return "", err
+	}
+
+	describer, err := versioned.Describer(c.getter, mapping)
+	if err != nil {
+		return "", err
+	}
+
+	return describer.Describe(namespace, name, describe.DescriberSettings{ShowEvents: true})
+}
+
+func (c *DynamicClusterClient) Logs(namespace, pod, container string, tailLines int64) (string, error) {
+	options := &corev1.PodLogOptions{Container: container, TailLines: &tailLines}
+	content, err := c.kube.CoreV1().Pods(namespace).GetLogs(pod, options).DoRaw()
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+func (c *DynamicClusterClient) Kubernetes() kubernetes.Interface {
+	return c.kube
+}
+
+func (c *DynamicClusterClient) ResourceDiffer(deployment string) *ResourceDiffer {
+	return NewResourceDiffer(c.client, c.mapper, c.namespace, deployment)
+}
+
+// resourceClient returns a client for the resource, along with a copy of the resource that has its namespace set
+func (c *DynamicClusterClient) resourceClient(resource *unstructured.Unstructured) (dynamic.ResourceInterface, *unstructured.Unstructured, error) {
+	gvk := resource.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, resource, err
+	}
+
+	resource = resource.DeepCopy()
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		resource.SetNamespace("")
+		return c.client.Resource(mapping.Resource), resource, nil
+	}
+
+	if resource.GetNamespace() == "" {
+		resource.SetNamespace(c.namespace)
+	}
+
+	return c.client.Resource(mapping.Resource).Namespace(resource.GetNamespace()), resource, nil
+}
+
+// setLastAppliedConfiguration records the resource in its last applied configuration annotation, like kubectl apply.
+// The resulting resource is returned as json.
+func setLastAppliedConfiguration(resource *unstructured.Unstructured) ([]byte, error) {
+	unstructured.RemoveNestedField(resource.Object, "metadata", "annotations", corev1.LastAppliedConfigAnnotation)
+	configuration, err := json.Marshal(resource.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := resource.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[corev1.LastAppliedConfigAnnotation] = string(configuration)
+	resource.SetAnnotations(annotations)
+
+	return json.Marshal(resource.Object)
+}
+
+// applyPatch creates the patch from the current resource to the modified one, like kubectl apply.
+// Kinds that are built into kubernetes get a strategic merge patch, so lists like containers are merged by name.
+// Other kinds, e.g. custom resources, get a json merge patch.
+func applyPatch(gvk schema.GroupVersionKind, original, modified, current []byte) (types.PatchType, []byte, error) {
+	versionedObject, err := scheme.Scheme.New(gvk)
+	if runtime.IsNotRegisteredError(err) {
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+		return types.MergePatchType, patch, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	patchMeta, err := strategicpatch.NewPatchMetaFromStruct(versionedObject)
+	if err != nil {
+		return "", nil, err
+	}
+
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, patchMeta, true)
+
+	return types.StrategicMergePatchType, patch, err
+}
+
+// resourceError adds the resource to err, so it is clear which resource failed. nil is returned if err is nil.
+func resourceError(resource *unstructured.Unstructured, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &ResourceError{Resource: ResourceDisplayName(resource), Err: err}
+}
+
+// ResourceError is returned when an operation on a single resource fails
+type ResourceError struct {
+	Resource string
+	Err      error
+}
+
+func (e *ResourceError) Error() string {
+	return e.Resource + ": " + e.Err.Error()
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,230 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// FakeClusterClient is a ClusterClient that keeps the live resources in memory and records every change, for tests
+type FakeClusterClient struct {
+	// Resources are the live resources
+	Resources []*unstructured.Unstructured
+	// Events are returned by ListEvents, for their namespace
+	Events []corev1.Event
+	// WaitErr is returned by Wait
+	WaitErr error
+	// Version is returned by ServerVersion
+	Version *version.Info
+	// PodLogs are returned by Logs, by namespace/pod/container
+	PodLogs map[string]string
+	// Kube is returned by Kubernetes. It does not share the live resources with Resources.
+	Kube kubernetes.Interface
+
+	// Applied has every resource passed to Apply, in order
+	Applied []*unstructured.Unstructured
+	// Deleted has every resource passed to Delete, in order
+	Deleted []*unstructured.Unstructured
+	// Waited has every workload passed to Wait, in order
+	Waited []Workload
+}
+
+// NewFakeClusterClient creates a FakeClusterClient with the objects as its live resources.
+// Objects can be typed, like *appsv1.Deployment, or *unstructured.Unstructured. Events are added to Events.
+func NewFakeClusterClient(objects ...runtime.Object) (*FakeClusterClient, error) {
+	client := &FakeClusterClient{
+		Resources: make([]*unstructured.Unstructured, 0),
+		Events:    make([]corev1.Event, 0),
+		Kube:      kubefake.NewSimpleClientset(),
+	}
+
+	for _, object := range objects {
+		if event, ok := object.(*corev1.Event); ok {
+			client.Events = append(client.Events, *event)
+			continue
+		}
+
+		resource, err := toUnstructured(object)
+		if err != nil {
+			return nil, err
+		}
+		client.Resources = append(client.Resources, resource)
+	}
+
+	return client, nil
+}
+
+// toUnstructured converts a typed object, which does not have to set its kind, into an unstructured resource
+func toUnstructured(object runtime.Object) (*unstructured.Unstructured, error) {
+	if resource, ok := object.(*unstructured.Unstructured); ok {
+		return resource.DeepCopy(), nil
+	}
+
+	kinds, _, err := scheme.Scheme.ObjectKinds(object)
+	if err != nil {
+		return nil, err
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("unknown kind of %T", object)
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := &unstructured.Unstructured{Object: content}
+	resource.SetGroupVersionKind(kinds[0])
+
+	return resource, nil
+}
+
+// Apply records the resources and replaces, or adds, them in Resources. The timeout is ignored.
+func (c *FakeClusterClient) Apply(timeout time.Duration, resources ...*unstructured.Unstructured) error {
+	for _, resource := range resources {
+		c.Applied = append(c.Applied, resource.DeepCopy())
+		c.remove(resource)
+		c.Resources = append(c.Resources, resource.DeepCopy())
+	}
+
+	return nil
+}
+
+func (c *FakeClusterClient) Get(apiVersion, kind, namespace, name string) (*unstructured.Unstructured, error) {
+	groupKind := schema.FromAPIVersionAndKind(apiVersion, kind).GroupKind()
+	for _, resource := range c.Resources {
+		if resource.GroupVersionKind().GroupKind() == groupKind && resource.GetNamespace() == namespace && resource.GetName() == name {
+			return resource.DeepCopy(), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *FakeClusterClient) List(apiVersion, kind, namespace, labelSelector string) ([]*unstructured.Unstructured, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	groupKind := schema.FromAPIVersionAndKind(apiVersion, kind).GroupKind()
+	results := make([]*unstructured.Unstructured, 0)
+	for _, resource := range c.Resources {
+		if resource.GroupVersionKind().GroupKind() != groupKind {
+			continue
+		}
+		if namespace != "" && resource.GetNamespace() != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(resource.GetLabels())) {
+			continue
+		}
+
+		results = append(results, resource.DeepCopy())
+	}
+
+	return results, nil
+}
+
+// Delete records the resources and removes them from Resources
+func (c *FakeClusterClient) Delete(resources ...*unstructured.Unstructured) error {
+	for _, resource := range resources {
+		c.Deleted = append(c.Deleted, resource.DeepCopy())
+		c.remove(resource)
+	}
+
+	return nil
+}
+
+// Wait records the workloads and returns WaitErr
+func (c *FakeClusterClient) Wait(timeout time.Duration, workloads ...Workload) error {
+	c.Waited = append(c.Waited, workloads...)
+
+	return c.WaitErr
+}
+
+func (c *FakeClusterClient) ListEvents(namespace string) ([]corev1.Event, error) {
+	events := make([]corev1.Event, 0)
+	for _, event := range c.Events {
+		if event.Namespace == namespace {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// Describe returns the live resource as yaml
+func (c *FakeClusterClient) Describe(apiVersion, kind, namespace, name string) (string, error) {
+	resource, err := c.Get(apiVersion, kind, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	if resource == nil {
+		return "", fmt.Errorf("%v %v/%v not found", kind, namespace, name)
+	}
+
+	return ResourcesToYaml([]*unstructured.Unstructured{resource})
+}
+
+// Logs returns the PodLogs of the container, the tailLines are ignored
+func (c *FakeClusterClient) Logs(namespace, pod, container string, tailLines int64) (string, error) {
+	logs, ok := c.PodLogs[namespace+"/"+pod+"/"+container]
+	if !ok {
+		return "", fmt.Errorf("container %v of pod %v/%v not found", container, namespace, pod)
+	}
+
+	return logs, nil
+}
+
+func (c *FakeClusterClient) Kubernetes() kubernetes.Interface {
+	return c.Kube
+}
+
+// ResourceDiffer creates a ResourceDiffer that compares with a copy of Resources.
+// The kinds of Resources are known, those without a namespace are cluster scoped.
+func (c *FakeClusterClient) ResourceDiffer(deployment string) *ResourceDiffer {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	objects := make([]runtime.Object, 0)
+	for _, resource := range c.Resources {
+		scope := meta.RESTScopeNamespace
+		if resource.GetNamespace() == "" {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(resource.GroupVersionKind(), scope)
+		objects = append(objects, resource.DeepCopy())
+	}
+
+	return NewResourceDiffer(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...), mapper, "default", deployment)
+}
+
+// ServerVersion returns Version, or an error if it is not set
+func (c *FakeClusterClient) ServerVersion() (*version.Info, error) {
+	if c.Version == nil {
+		return nil, fmt.Errorf("no server version")
+	}
+
+	return c.Version, nil
+}
+
+func (c *FakeClusterClient) remove(resource *unstructured.Unstructured) {
+	key := ResourceKey(resource)
+	resources := make([]*unstructured.Unstructured, 0)
+	for _, item := range c.Resources {
+		if ResourceKey(item) != key {
+			resources = append(resources, item)
+		}
+	}
+	c.Resources = resources
+}
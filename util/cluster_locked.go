@@ -0,0 +1,117 @@
+package util
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LockedClusterClient makes the changes of another ClusterClient only while a DeploymentLock is held.
+// Once the lock is lost no more resources are applied or deleted, and the error of the lock is returned instead.
+type LockedClusterClient struct {
+	client ClusterClient
+	lock   *DeploymentLock
+}
+
+// NewLockedClusterClient creates a LockedClusterClient that makes changes with client while lock is held
+func NewLockedClusterClient(client ClusterClient, lock *DeploymentLock) *LockedClusterClient {
+	return &LockedClusterClient{
+		client: client,
+		lock:   lock,
+	}
+}
+
+// Apply applies the resources one at a time, and stops once the lock is lost.
+// The CustomResourceDefinitions are applied and waited for first, as the other ClusterClients do.
+func (c *LockedClusterClient) Apply(timeout time.Duration, resources ...*unstructured.Unstructured) error {
+	crds, rest := SplitCustomResourceDefinitions(resources)
+	if len(crds) != 0 {
+		if err := c.lock.Err(); err != nil {
+			return err
+		}
+		if err := c.client.Apply(timeout, crds...); err != nil {
+			return err
+		}
+	}
+
+	for _, resource := range rest {
+		if err := c.lock.Err(); err != nil {
+			return err
+		}
+		if err := c.client.Apply(timeout, resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *LockedClusterClient) Get(apiVersion, kind, namespace, name string) (*unstructured.Unstructured, error) {
+	return c.client.Get(apiVersion, kind, namespace, name)
+}
+
+func (c *LockedClusterClient) List(apiVersion, kind, namespace, labelSelector string) ([]*unstructured.Unstructured, error) {
+	return c.client.List(apiVersion, kind, namespace, labelSelector)
+}
+
+// Delete deletes the resources one at a time, and stops once the lock is lost
+func (c *LockedClusterClient) Delete(resources ...*unstructured.Unstructured) error {
+	for _, resource := range resources {
+		if err := c.lock.Err(); err != nil {
+			return err
+		}
+		if err := c.client.Delete(resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Wait waits with the other ClusterClient, but returns the error of the lock as soon as it is lost
+func (c *LockedClusterClient) Wait(timeout time.Duration, workloads ...Workload) error {
+	if err := c.lock.Err(); err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- c.client.Wait(timeout, workloads...)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-c.lock.Lost():
+		return c.lock.Err()
+	}
+}
+
+func (c *LockedClusterClient) ListEvents(namespace string) ([]corev1.Event, error) {
+	return c.client.ListEvents(namespace)
+}
+
+func (c *LockedClusterClient) ServerVersion() (*version.Info, error) {
+	return c.client.ServerVersion()
+}
+
+func (c *LockedClusterClient) Describe(apiVersion, kind, namespace, name string) (string, error) {
+	return c.client.Describe(apiVersion, kind, namespace, name)
+}
+
+func (c *LockedClusterClient) Logs(namespace, pod, container string, tailLines int64) (string, error) {
+	return c.client.Logs(namespace, pod, container, tailLines)
+}
+
+// Kubernetes returns the typed client of the other ClusterClient, changes made with it do not check the lock
+func (c *LockedClusterClient) Kubernetes() kubernetes.Interface {
+	return c.client.Kubernetes()
+}
+
+// ResourceDiffer returns the ResourceDiffer of the other ClusterClient, it only sends dry runs
+func (c *LockedClusterClient) ResourceDiffer(deployment string) *ResourceDiffer {
+	return c.client.ResourceDiffer(deployment)
+}
@@ -0,0 +1,273 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+// testRESTMapper is a fixed RESTMapper, there is no discovery to reset
+type testRESTMapper struct {
+	*meta.DefaultRESTMapper
+}
+
+func (m testRESTMapper) Reset() {}
+
+func newTestDynamicClusterClient(t *testing.T, live string) *DynamicClusterClient {
+	resources, err := ParseResources(live)
+	assert.Nil(t, err)
+
+	objects := make([]runtime.Object, 0)
+	for _, resource := range resources {
+		objects = append(objects, resource)
+	}
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "WorkflowTemplate"}, meta.RESTScopeNamespace)
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+
+	return NewDynamicClusterClient(client, kubefake.NewSimpleClientset(), testRESTMapper{mapper}, "default")
+}
+
+func TestDynamicClusterClient_Apply(t *testing.T) {
+	client := newTestDynamicClusterClient(t, "")
+
+	resources, err := ParseResources(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: onepanel
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+data:
+  fqdn: app.example.com`)
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.Apply(time.Minute, resources...))
+
+	namespace, err := client.Get("v1", "Namespace", "", "onepanel")
+	assert.Nil(t, err)
+	assert.NotNil(t, namespace)
+
+	// The namespace of the client is used for resources that do not have one
+	configMap, err := client.Get("v1", "ConfigMap", "default", "onepanel")
+	assert.Nil(t, err)
+	assert.NotNil(t, configMap)
+	assert.Contains(t, configMap.GetAnnotations()[corev1.LastAppliedConfigAnnotation], `"fqdn":"app.example.com"`)
+
+	configMaps, err := client.List("v1", "ConfigMap", "default", "")
+	assert.Nil(t, err)
+	assert.Len(t, configMaps, 1)
+}
+
+func TestDynamicClusterClient_ApplyUpdate(t *testing.T) {
+	client := newTestDynamicClusterClient(t, "")
+
+	applied, err := ParseResources(`apiVersion: argoproj.io/v1alpha1
+kind: WorkflowTemplate
+metadata:
+  name: sample
+  namespace: onepanel
+spec:
+  entrypoint: main
+  arguments:
+    parameters:
+    - name: message`)
+	assert.Nil(t, err)
+	assert.Nil(t, client.Apply(time.Minute, applied...))
+
+	// Fields that are no longer applied are removed from the live resource
+	updated, err := ParseResources(`apiVersion: argoproj.io/v1alpha1
+kind: WorkflowTemplate
+metadata:
+  name: sample
+  namespace: onepanel
+spec:
+  entrypoint: start`)
+	assert.Nil(t, err)
+	assert.Nil(t, client.Apply(time.Minute, updated...))
+
+	live, err := client.Get("argoproj.io/v1alpha1", "WorkflowTemplate", "onepanel", "sample")
+	assert.Nil(t, err)
+	spec, _, _ := unstructured.NestedMap(live.Object, "spec")
+	assert.Equal(t, map[string]interface{}{"entrypoint": "start"}, spec)
+}
+
+func TestDynamicClusterClient_Delete(t *testing.T) {
+	client := newTestDynamicClusterClient(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel`)
+
+	resources, err := ParseResources(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: missing
+  namespace: onepanel
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: sample
+  namespace: onepanel`)
+	assert.Nil(t, err)
+
+	// Resources that do not exist, or whose kind is unknown, are skipped
+	assert.Nil(t, client.Delete(resources...))
+
+	configMap, err := client.Get("v1", "ConfigMap", "onepanel", "onepanel")
+	assert.Nil(t, err)
+	assert.Nil(t, configMap)
+
+	widget, err := client.Get("example.com/v1", "Widget", "onepanel", "sample")
+	assert.Nil(t, err)
+	assert.Nil(t, widget)
+}
+
+func TestDryRunClusterClient(t *testing.T) {
+	fake, err := NewFakeClusterClient(&corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "onepanel"},
+	})
+	assert.Nil(t, err)
+
+	out := &bytes.Buffer{}
+	client := NewDryRunClusterClient(fake, out)
+
+	resources, err := ParseResources(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new
+  namespace: onepanel`)
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.Apply(time.Minute, resources...))
+	assert.Nil(t, client.Delete(resources...))
+	assert.Nil(t, client.Wait(time.Minute, Workload{Kind: WorkloadDeployment, Namespace: "onepanel", Name: "core"}))
+
+	assert.Equal(t, "ConfigMap onepanel/onepanel configured (dry run)\n"+
+		"ConfigMap onepanel/new created (dry run)\n"+
+		"ConfigMap onepanel/onepanel deleted (dry run)\n", out.String())
+
+	// Nothing is changed
+	assert.Empty(t, fake.Applied)
+	assert.Empty(t, fake.Deleted)
+	assert.Empty(t, fake.Waited)
+	assert.Len(t, fake.Resources, 1)
+}
+
+func TestLockedClusterClient(t *testing.T) {
+	fake, err := NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	lock := NewDeploymentLock(fake.Kube, "alice@laptop")
+	assert.Nil(t, lock.Acquire(false))
+	defer lock.Release()
+	client := NewLockedClusterClient(fake, lock)
+
+	resources, err := ParseResources(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel`)
+	assert.Nil(t, err)
+	assert.Nil(t, client.Apply(time.Minute, resources...))
+	assert.Nil(t, lock.Err())
+
+	// Someone else takes the lock over, the next renewal notices
+	assert.Nil(t, NewDeploymentLock(fake.Kube, "bob@ci").Acquire(true))
+	err = lock.renew()
+	assert.IsType(t, &lockTakenOverError{}, err)
+	lock.setLost(err)
+
+	select {
+	case <-lock.Lost():
+	default:
+		assert.Fail(t, "Lost is not closed")
+	}
+	assert.IsType(t, &LockLostError{}, client.Apply(time.Minute, resources...))
+	assert.IsType(t, &LockLostError{}, client.Delete(resources...))
+	assert.IsType(t, &LockLostError{}, client.Wait(time.Minute, Workload{Kind: WorkloadDeployment, Namespace: "onepanel", Name: "core"}))
+
+	// Nothing is changed after the lock was lost
+	assert.Len(t, fake.Applied, 1)
+	assert.Empty(t, fake.Deleted)
+	assert.Empty(t, fake.Waited)
+}
+
+func TestFakeClusterClient(t *testing.T) {
+	client, err := NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetAPIVersion("v1")
+	configMap.SetKind("ConfigMap")
+	configMap.SetNamespace("onepanel")
+	configMap.SetName("onepanel")
+	configMap.SetLabels(map[string]string{"app": "onepanel"})
+
+	assert.Nil(t, client.Apply(time.Minute, configMap, configMap))
+	assert.Len(t, client.Applied, 2)
+	assert.Len(t, client.Resources, 1)
+
+	configMaps, err := client.List("v1", "ConfigMap", "onepanel", "app=onepanel")
+	assert.Nil(t, err)
+	assert.Len(t, configMaps, 1)
+	configMaps, err = client.List("v1", "ConfigMap", "onepanel", "app=other")
+	assert.Nil(t, err)
+	assert.Len(t, configMaps, 0)
+
+	assert.Nil(t, client.Delete(configMap))
+	assert.Len(t, client.Deleted, 1)
+	live, err := client.Get("v1", "ConfigMap", "onepanel", "onepanel")
+	assert.Nil(t, err)
+	assert.Nil(t, live)
+}
+
+func TestFakeClusterClient_ResourceDiffer(t *testing.T) {
+	client, err := NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetAPIVersion("v1")
+	configMap.SetKind("ConfigMap")
+	configMap.SetNamespace("onepanel")
+	configMap.SetName("onepanel")
+	SetOwnershipLabels([]*unstructured.Unstructured{configMap}, "onepanel")
+	assert.Nil(t, client.Apply(time.Minute, configMap))
+
+	// The differ compares with the live resources of the client
+	prunes, err := client.ResourceDiffer("onepanel").Prunes(nil, []*unstructured.Unstructured{configMap})
+	assert.Nil(t, err)
+	assert.Len(t, prunes, 1)
+	prunes, err = client.ResourceDiffer("other").Prunes(nil, []*unstructured.Unstructured{configMap})
+	assert.Nil(t, err)
+	assert.Empty(t, prunes)
+}
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+const (
+	customResourceDefinitionGroup = "apiextensions.k8s.io"
+	customResourceDefinitionKind  = "CustomResourceDefinition"
+)
+
+// IsCustomResourceDefinition returns true if the resource is a CustomResourceDefinition
+func IsCustomResourceDefinition(resource *unstructured.Unstructured) bool {
+	gvk := resource.GroupVersionKind()
+
+	return gvk.Group == customResourceDefinitionGroup && gvk.Kind == customResourceDefinitionKind
+}
+
+// SplitCustomResourceDefinitions separates the CustomResourceDefinitions from the rest of the resources
+func SplitCustomResourceDefinitions(resources []*unstructured.Unstructured) (crds, rest []*unstructured.Unstructured) {
+	crds = make([]*unstructured.Unstructured, 0)
+	rest = make([]*unstructured.Unstructured, 0)
+
+	for _, resource := range resources {
+		if IsCustomResourceDefinition(resource) {
+			crds = append(crds, resource)
+		} else {
+			rest = append(rest, resource)
+		}
+	}
+
+	return
+}
+
+// NotEstablishedError is returned when a custom resource definition is not established in time
+type NotEstablishedError struct {
+	Name    string
+	Timeout time.Duration
+}
+
+func (e *NotEstablishedError) Error() string {
+	return fmt.Sprintf("custom resource definition '%v' did not become established within %v", e.Name, e.Timeout)
+}
+
+// WaitForCustomResourceDefinitionsWithClient watches each crd until it has the Established condition.
+// The timeout is for all of the crds. If it passes, a *NotEstablishedError names the crd that is not established.
+func WaitForCustomResourceDefinitionsWithClient(client dynamic.Interface, crds []*unstructured.Unstructured, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, crd := range crds {
+		gvr := schema.GroupVersionResource{
+			Group:    customResourceDefinitionGroup,
+			Version:  crd.GroupVersionKind().Version,
+			Resource: "customresourcedefinitions",
+		}
+
+		if err := waitForCustomResourceDefinition(ctx, client.Resource(gvr), crd.GetName()); err != nil {
+			if err == watchtools.ErrWatchClosed || ctx.Err() != nil {
+				return &NotEstablishedError{Name: crd.GetName(), Timeout: timeout}
+			}
+
+			return fmt.Errorf("custom resource definition '%v' is not established: %v", crd.GetName(), err.Error())
+		}
+	}
+
+	return nil
+}
+
+func waitForCustomResourceDefinition(ctx context.Context, client dynamic.ResourceInterface, name string) error {
+	resourceVersion := ""
+
+	crd, err := client.Get(name, v1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		established, err := customResourceDefinitionEstablished(crd)
+		if established || err != nil {
+			return err
+		}
+		resourceVersion = crd.GetResourceVersion()
+	}
+
+	watcher, err := client.Watch(v1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+		ResourceVersion: resourceVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = watchtools.UntilWithoutRetry(ctx, watcher, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("deleted while waiting")
+		}
+
+		crd, ok := event.Object.(*unstructured.Unstructured)
+		if !ok || crd.GetName() != name {
+			return false, nil
+		}
+
+		return customResourceDefinitionEstablished(crd)
+	})
+
+	return err
+}
+
+// customResourceDefinitionEstablished checks the conditions of the crd.
+// An error is returned if the crd can never become established, like when its names conflict with another crd.
+func customResourceDefinitionEstablished(crd *unstructured.Unstructured) (bool, error) {
+	conditions, _, err := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		switch condition["type"] {
+		case "Established":
+			if condition["status"] == "True" {
+				return true, nil
+			}
+		case "NamesAccepted":
+			if condition["status"] == "False" {
+				return false, fmt.Errorf("names not accepted: %v", condition["message"])
+			}
+		}
+	}
+
+	return false, nil
+}
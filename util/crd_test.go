@@ -0,0 +1,63 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func testCustomResourceDefinition(t *testing.T, name, established string) *unstructured.Unstructured {
+	resources, err := ParseResources(`apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: ` + name + `
+status:
+  conditions:
+  - type: NamesAccepted
+    status: "True"
+  - type: Established
+    status: "` + established + `"`)
+	assert.Nil(t, err)
+
+	return resources[0]
+}
+
+func TestSplitCustomResourceDefinitions(t *testing.T) {
+	resources, err := ParseResources(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: onepanel
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: workflows.argoproj.io`)
+	assert.Nil(t, err)
+
+	crds, rest := SplitCustomResourceDefinitions(resources)
+	assert.Len(t, crds, 1)
+	assert.Equal(t, "workflows.argoproj.io", crds[0].GetName())
+	assert.Len(t, rest, 1)
+	assert.Equal(t, "Namespace", rest[0].GetKind())
+}
+
+func TestWaitForCustomResourceDefinitionsWithClient(t *testing.T) {
+	established := testCustomResourceDefinition(t, "workflows.argoproj.io", "True")
+	pending := testCustomResourceDefinition(t, "virtualservices.networking.istio.io", "False")
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), established, pending)
+
+	err := WaitForCustomResourceDefinitionsWithClient(client, []*unstructured.Unstructured{established}, time.Second)
+	assert.Nil(t, err)
+
+	err = WaitForCustomResourceDefinitionsWithClient(client, []*unstructured.Unstructured{established, pending}, 100*time.Millisecond)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "virtualservices.networking.istio.io"))
+	_, ok := err.(*NotEstablishedError)
+	assert.True(t, ok)
+}
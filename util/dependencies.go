@@ -0,0 +1,71 @@
+package util
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ComponentDependencies returns, for each component, the other components it depends on.
+// A component depends on another if it has resources in a Namespace the other creates,
+// or custom resources in an API group whose CustomResourceDefinitions the other creates.
+// Only the identity of the resources is needed, see InventoryResourcesToUnstructured.
+func ComponentDependencies(components map[string][]*unstructured.Unstructured) map[string][]string {
+	namespaceProviders := make(map[string]string)
+	groupProviders := make(map[string]string)
+
+	for component, resources := range components {
+		for _, resource := range resources {
+			if resource.GetKind() == "Namespace" {
+				namespaceProviders[resource.GetName()] = component
+			}
+
+			// CustomResourceDefinitions are named <plural>.<group>
+			if IsCustomResourceDefinition(resource) {
+				if index := strings.Index(resource.GetName(), "."); index >= 0 {
+					groupProviders[resource.GetName()[index+1:]] = component
+				}
+			}
+		}
+	}
+
+	dependencies := make(map[string][]string)
+	for component, resources := range components {
+		dependsOn := make(map[string]bool)
+
+		for _, resource := range resources {
+			if provider, ok := namespaceProviders[resource.GetNamespace()]; ok && provider != component {
+				dependsOn[provider] = true
+			}
+
+			if provider, ok := groupProviders[resource.GroupVersionKind().Group]; ok && provider != component {
+				dependsOn[provider] = true
+			}
+		}
+
+		dependencies[component] = make([]string, 0)
+		for provider := range dependsOn {
+			dependencies[component] = append(dependencies[component], provider)
+		}
+		sort.Strings(dependencies[component])
+	}
+
+	return dependencies
+}
+
+// ComponentDependents returns the components that depend on component, sorted by name
+func ComponentDependents(dependencies map[string][]string, component string) []string {
+	dependents := make([]string, 0)
+	for dependent, providers := range dependencies {
+		for _, provider := range providers {
+			if provider == component {
+				dependents = append(dependents, dependent)
+				break
+			}
+		}
+	}
+	sort.Strings(dependents)
+
+	return dependents
+}
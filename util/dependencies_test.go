@@ -0,0 +1,32 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestComponentDependencies(t *testing.T) {
+	components := map[string][]*unstructured.Unstructured{
+		"common/argo": InventoryResourcesToUnstructured([]InventoryResource{
+			{APIVersion: "apiextensions.k8s.io/v1beta1", Kind: "CustomResourceDefinition", Name: "workflows.argoproj.io"},
+			{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "onepanel", Name: "workflow-controller"},
+		}),
+		"common/onepanel": InventoryResourcesToUnstructured([]InventoryResource{
+			{APIVersion: "v1", Kind: "Namespace", Name: "onepanel"},
+			{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "onepanel", Name: "core"},
+		}),
+		"common/modeldb": InventoryResourcesToUnstructured([]InventoryResource{
+			{APIVersion: "argoproj.io/v1alpha1", Kind: "WorkflowTemplate", Namespace: "onepanel", Name: "modeldb"},
+		}),
+	}
+
+	dependencies := ComponentDependencies(components)
+	assert.Equal(t, []string{"common/onepanel"}, dependencies["common/argo"])
+	assert.Equal(t, []string{}, dependencies["common/onepanel"])
+	assert.Equal(t, []string{"common/argo", "common/onepanel"}, dependencies["common/modeldb"])
+
+	assert.Equal(t, []string{"common/argo", "common/modeldb"}, ComponentDependents(dependencies, "common/onepanel"))
+	assert.Equal(t, []string{}, ComponentDependents(dependencies, "common/modeldb"))
+}
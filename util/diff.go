@@ -0,0 +1,367 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// DiffActionCreate indicates the resource does not exist in the cluster yet
+	DiffActionCreate = "create"
+	// DiffActionUpdate indicates the resource exists and would be changed
+	DiffActionUpdate = "update"
+	// DiffActionPrune indicates the resource exists, but is no longer part of the rendered resources
+	DiffActionPrune = "prune"
+	// DiffActionUnchanged indicates applying the resource would not change it
+	DiffActionUnchanged = "unchanged"
+
+	diffContextLines = 3
+)
+
+// ResourceDiff is the change applying a single resource would make to the cluster
+type ResourceDiff struct {
+	Action   string
+	Resource *unstructured.Unstructured
+	Diff     string // unified diff from the live object to the resulting object. Empty if unchanged.
+}
+
+// ResourceDiffer compares rendered resources with the live cluster.
+// Updates and creates are sent to the server as dry runs so defaults and admission changes are part of the diff.
+type ResourceDiffer struct {
+	client     dynamic.Interface
+	mapper     meta.RESTMapper
+	namespace  string // used for namespaced resources that do not specify one
+	deployment string // only resources owned by this deployment are pruned, see IsOwnedBy
+}
+
+// NewResourceDiffer creates a ResourceDiffer that uses the client and mapper to look up live resources.
+func NewResourceDiffer(client dynamic.Interface, mapper meta.RESTMapper, namespace, deployment string) *ResourceDiffer {
+	return &ResourceDiffer{
+		client:     client,
+		mapper:     mapper,
+		namespace:  namespace,
+		deployment: deployment,
+	}
+}
+
+// Diff compares rendered with the cluster. Any resource in previous that is no longer rendered, but
+// still exists in the cluster, is reported as pruned. See Prunes.
+func (r *ResourceDiffer) Diff(rendered, previous []*unstructured.Unstructured) ([]*ResourceDiff, error) {
+	diffs := make([]*ResourceDiff, 0)
+
+	for _, resource := range rendered {
+		diff, err := r.diffResource(resource)
+		if err != nil {
+			return nil, fmt.Errorf("unable to diff %v: %v", ResourceDisplayName(resource), err.Error())
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	prunes, err := r.Prunes(rendered, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(diffs, prunes...), nil
+}
+
+// Prunes returns the resources in previous that are no longer rendered, but still exist in the cluster.
+// Resources that are not owned by the deployment of the differ are left alone, see IsOwnedBy.
+func (r *ResourceDiffer) Prunes(rendered, previous []*unstructured.Unstructured) ([]*ResourceDiff, error) {
+	renderedKeys := make(map[string]bool)
+	for _, resource := range rendered {
+		_, namespacedResource, err := r.resourceClient(resource)
+		if err != nil && !meta.IsNoMatchError(err) {
+			return nil, err
+		}
+
+		renderedKeys[ResourceKey(namespacedResource)] = true
+	}
+
+	diffs := make([]*ResourceDiff, 0)
+	for _, resource := range previous {
+		resourceClient, namespacedResource, err := r.resourceClient(resource)
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if renderedKeys[ResourceKey(namespacedResource)] {
+			continue
+		}
+
+		live, err := resourceClient.Get(namespacedResource.GetName(), v1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !IsOwnedBy(live, r.deployment) {
+			continue
+		}
+
+		liveYaml, err := normalizedYaml(live)
+		if err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, &ResourceDiff{
+			Action:   DiffActionPrune,
+			Resource: namespacedResource,
+			Diff:     UnifiedDiff("live/"+ResourceKey(namespacedResource), "/dev/null", liveYaml, ""),
+		})
+	}
+
+	return diffs, nil
+}
+
+// resourceClient returns a client for the resource, along with a copy of the resource that has its namespace set
+func (r *ResourceDiffer) resourceClient(resource *unstructured.Unstructured) (dynamic.ResourceInterface, *unstructured.Unstructured, error) {
+	gvk := resource.GroupVersionKind()
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, resource, err
+	}
+
+	resource = resource.DeepCopy()
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		resource.SetNamespace("")
+		return r.client.Resource(mapping.Resource), resource, nil
+	}
+
+	if resource.GetNamespace() == "" {
+		resource.SetNamespace(r.namespace)
+	}
+
+	return r.client.Resource(mapping.Resource).Namespace(resource.GetNamespace()), resource, nil
+}
+
+func (r *ResourceDiffer) diffResource(resource *unstructured.Unstructured) (*ResourceDiff, error) {
+	resourceClient, resource, err := r.resourceClient(resource)
+	// The kind is not known to the cluster yet, e.g. a custom resource whose definition is part of the same apply.
+	if meta.IsNoMatchError(err) {
+		return createDiff(resource, resource)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun := []string{v1.DryRunAll}
+
+	// The dry run sends what apply would send, see DynamicClusterClient.applyResource
+	applied := resource.DeepCopy()
+	modified, err := setLastAppliedConfiguration(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := resourceClient.Get(resource.GetName(), v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		created, err := resourceClient.Create(applied, v1.CreateOptions{DryRun: dryRun})
+		if err != nil {
+			return nil, err
+		}
+
+		return createDiff(resource, created)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	original := []byte(live.GetAnnotations()[corev1.LastAppliedConfigAnnotation])
+	current, err := json.Marshal(live.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	patchType, patch, err := applyPatch(resource.GroupVersionKind(), original, modified, current)
+	if err != nil {
+		return nil, err
+	}
+	if string(patch) == "{}" {
+		return &ResourceDiff{Action: DiffActionUnchanged, Resource: resource}, nil
+	}
+
+	patched, err := resourceClient.Patch(resource.GetName(), patchType, patch, v1.PatchOptions{DryRun: dryRun})
+	if err != nil {
+		return nil, err
+	}
+
+	liveYaml, err := normalizedYaml(live)
+	if err != nil {
+		return nil, err
+	}
+	patchedYaml, err := normalizedYaml(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	if liveYaml == patchedYaml {
+		return &ResourceDiff{Action: DiffActionUnchanged, Resource: resource}, nil
+	}
+
+	return &ResourceDiff{
+		Action:   DiffActionUpdate,
+		Resource: resource,
+		Diff:     UnifiedDiff("live/"+ResourceKey(resource), "merged/"+ResourceKey(resource), liveYaml, patchedYaml),
+	}, nil
+}
+
+func createDiff(resource, result *unstructured.Unstructured) (*ResourceDiff, error) {
+	resultYaml, err := normalizedYaml(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResourceDiff{
+		Action:   DiffActionCreate,
+		Resource: resource,
+		Diff:     UnifiedDiff("/dev/null", "merged/"+ResourceKey(resource), "", resultYaml),
+	}, nil
+}
+
+// normalizedYaml strips the fields the server manages so only meaningful changes show up in a diff
+func normalizedYaml(resource *unstructured.Unstructured) (string, error) {
+	resource = resource.DeepCopy()
+
+	unstructured.RemoveNestedField(resource.Object, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "selfLink", "creationTimestamp", "generation"} {
+		unstructured.RemoveNestedField(resource.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(resource.Object, "metadata", "annotations", corev1.LastAppliedConfigAnnotation)
+	if annotations, found, _ := unstructured.NestedMap(resource.Object, "metadata", "annotations"); found && len(annotations) == 0 {
+		unstructured.RemoveNestedField(resource.Object, "metadata", "annotations")
+	}
+
+	data, err := yaml.Marshal(resource.Object)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+type diffLine struct {
+	operation byte // ' ', '-' or '+'
+	text      string
+	fromIndex int // index of the next line in from, at the time of this operation
+	toIndex   int // index of the next line in to, at the time of this operation
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// UnifiedDiff returns the difference between from and to in the unified diff format.
+// An empty string is returned if there is no difference.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	fromLines := splitLines(from)
+	toLines := splitLines(to)
+
+	// lcs[i][j] is the length of the longest common subsequence of fromLines[i:] and toLines[j:]
+	lcs := make([][]int, len(fromLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(toLines)+1)
+	}
+	for i := len(fromLines) - 1; i >= 0; i-- {
+		for j := len(toLines) - 1; j >= 0; j-- {
+			if fromLines[i] == toLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0)
+	changes := make([]int, 0)
+	i, j := 0, 0
+	for i < len(fromLines) || j < len(toLines) {
+		switch {
+		case i < len(fromLines) && j < len(toLines) && fromLines[i] == toLines[j]:
+			lines = append(lines, diffLine{' ', fromLines[i], i, j})
+			i++
+			j++
+		case j == len(toLines) || (i < len(fromLines) && lcs[i+1][j] >= lcs[i][j+1]):
+			changes = append(changes, len(lines))
+			lines = append(lines, diffLine{'-', fromLines[i], i, j})
+			i++
+		default:
+			changes = append(changes, len(lines))
+			lines = append(lines, diffLine{'+', toLines[j], i, j})
+			j++
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+
+	builder := &strings.Builder{}
+	builder.WriteString(fmt.Sprintf("--- %v\n+++ %v\n", fromName, toName))
+
+	for start := 0; start < len(changes); {
+		// Group changes that are close enough to share context lines into one hunk
+		end := start
+		for end+1 < len(changes) && changes[end+1]-changes[end] <= 2*diffContextLines {
+			end++
+		}
+
+		first := changes[start] - diffContextLines
+		if first < 0 {
+			first = 0
+		}
+		last := changes[end] + diffContextLines
+		if last >= len(lines) {
+			last = len(lines) - 1
+		}
+
+		fromCount, toCount := 0, 0
+		for _, line := range lines[first : last+1] {
+			if line.operation != '+' {
+				fromCount++
+			}
+			if line.operation != '-' {
+				toCount++
+			}
+		}
+
+		fromStart := lines[first].fromIndex
+		if fromCount > 0 {
+			fromStart++
+		}
+		toStart := lines[first].toIndex
+		if toCount > 0 {
+			toStart++
+		}
+
+		builder.WriteString(fmt.Sprintf("@@ -%v,%v +%v,%v @@\n", fromStart, fromCount, toStart, toCount))
+		for _, line := range lines[first : last+1] {
+			builder.WriteByte(line.operation)
+			builder.WriteString(line.text)
+			builder.WriteByte('\n')
+		}
+
+		start = end + 1
+	}
+
+	return builder.String()
+}
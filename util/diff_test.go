@@ -0,0 +1,223 @@
+package util
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+const (
+	diffLiveResources = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+  resourceVersion: "10"
+data:
+  fqdn: app.example.com
+  scheme: http
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: legacy
+  namespace: onepanel
+  labels:
+    app.kubernetes.io/managed-by: opctl
+    opctl.onepanel.io/deployment: onepanel
+spec:
+  type: ClusterIP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: unmanaged
+  namespace: onepanel
+spec:
+  type: ClusterIP`
+
+	diffRenderedResources = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+data:
+  fqdn: app.example.com
+  scheme: https
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: onepanel
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: onepanel
+data:
+  token: dG9rZW4=`
+)
+
+func newTestResourceDiffer(t *testing.T, live string) *ResourceDiffer {
+	resources, err := ParseResources(live)
+	assert.Nil(t, err)
+
+	objects := make([]runtime.Object, 0)
+	for _, resource := range resources {
+		objects = append(objects, resource)
+	}
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	// The fake client can not apply strategic merge patches to unstructured objects, they are applied to the live
+	// resources with their typed objects here. Like a dry run, the live resources are not changed.
+	client.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(clienttesting.PatchAction)
+		if patchAction.GetPatchType() != types.StrategicMergePatchType {
+			return false, nil, nil
+		}
+
+		for _, resource := range resources {
+			if strings.ToLower(resource.GetKind())+"s" != patchAction.GetResource().Resource ||
+				resource.GetNamespace() != patchAction.GetNamespace() || resource.GetName() != patchAction.GetName() {
+				continue
+			}
+
+			current, err := json.Marshal(resource.Object)
+			if err != nil {
+				return true, nil, err
+			}
+			typed, err := scheme.Scheme.New(resource.GroupVersionKind())
+			if err != nil {
+				return true, nil, err
+			}
+			patched, err := strategicpatch.StrategicMergePatch(current, patchAction.GetPatch(), typed)
+			if err != nil {
+				return true, nil, err
+			}
+
+			result := &unstructured.Unstructured{}
+			return true, result, result.UnmarshalJSON(patched)
+		}
+
+		return false, nil, nil
+	})
+
+	return NewResourceDiffer(client, mapper, "default", "onepanel")
+}
+
+func TestResourceDiffer_Diff(t *testing.T) {
+	differ := newTestResourceDiffer(t, diffLiveResources)
+
+	rendered, err := ParseResources(diffRenderedResources)
+	assert.Nil(t, err)
+	previous, err := ParseResources(diffLiveResources)
+	assert.Nil(t, err)
+
+	diffs, err := differ.Diff(rendered, previous)
+	assert.Nil(t, err)
+	assert.Len(t, diffs, 4)
+
+	actions := make(map[string]*ResourceDiff)
+	for _, diff := range diffs {
+		actions[ResourceDisplayName(diff.Resource)] = diff
+	}
+
+	configMapDiff := actions["ConfigMap onepanel/onepanel"]
+	assert.Equal(t, DiffActionUpdate, configMapDiff.Action)
+	assert.Contains(t, configMapDiff.Diff, "-  scheme: http\n+  scheme: https\n")
+	assert.NotContains(t, configMapDiff.Diff, "resourceVersion")
+
+	assert.Equal(t, DiffActionCreate, actions["Namespace onepanel"].Action)
+	assert.Equal(t, DiffActionCreate, actions["Secret default/onepanel"].Action)
+	assert.Equal(t, DiffActionPrune, actions["Service onepanel/legacy"].Action)
+	assert.Contains(t, actions["Service onepanel/legacy"].Diff, "+++ /dev/null")
+	// Only resources owned by the deployment are pruned
+	assert.Nil(t, actions["Service onepanel/unmanaged"])
+}
+
+func TestResourceDiffer_DiffLastApplied(t *testing.T) {
+	// legacy was part of the last apply, but is no longer rendered. extra was added by someone else.
+	differ := newTestResourceDiffer(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: '{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"onepanel","namespace":"onepanel"},"data":{"fqdn":"app.example.com","legacy":"true"}}'
+data:
+  fqdn: app.example.com
+  legacy: "true"
+  extra: "true"`)
+
+	rendered, err := ParseResources(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+data:
+  fqdn: app.example.com`)
+	assert.Nil(t, err)
+
+	// Like apply, the three-way patch removes legacy and keeps extra
+	diffs, err := differ.Diff(rendered, nil)
+	assert.Nil(t, err)
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, DiffActionUpdate, diffs[0].Action)
+	assert.Contains(t, diffs[0].Diff, "-  legacy: \"true\"\n")
+	assert.NotContains(t, diffs[0].Diff, "-  extra")
+}
+
+func TestResourceDiffer_DiffUnknownKind(t *testing.T) {
+	differ := newTestResourceDiffer(t, "")
+
+	resource := &unstructured.Unstructured{}
+	resource.SetAPIVersion("argoproj.io/v1alpha1")
+	resource.SetKind("WorkflowTemplate")
+	resource.SetName("sample")
+
+	diffs, err := differ.Diff([]*unstructured.Unstructured{resource}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, DiffActionCreate, diffs[0].Action)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	to := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+
+	expected := `--- from
++++ to
+@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k
+`
+	assert.Equal(t, expected, UnifiedDiff("from", "to", from, to))
+	assert.Equal(t, "", UnifiedDiff("from", "to", from, from))
+	assert.Equal(t, "--- from\n+++ to\n@@ -0,0 +1,1 @@\n+a\n", UnifiedDiff("from", "to", "", "a\n"))
+}
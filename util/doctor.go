@@ -0,0 +1,336 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// artifactRepositoryAccessKey and artifactRepositorySecretKey are the keys of the secret of the artifact repository
+	artifactRepositoryAccessKey = "artifactRepositoryS3AccessKey"
+	artifactRepositorySecretKey = "artifactRepositoryS3SecretKey"
+)
+
+// certificateVersions are the versions of the cert-manager Certificate kind, newest first
+var certificateVersions = []string{"cert-manager.io/v1", "cert-manager.io/v1alpha3", "cert-manager.io/v1alpha2"}
+
+// DoctorResult is the outcome of a single check of a running deployment
+type DoctorResult struct {
+	Check   string      `json:"check"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+	// Remediation describes how to fix the problem, if the check did not pass
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// DoctorOptions describe the running deployment the Doctor checks
+type DoctorOptions struct {
+	// Namespace is the default namespace of the deployment, application.defaultNamespace
+	Namespace string
+	// URL is the url of the deployment, see GetDeployedWebURL
+	URL string
+	// FQDN is the domain name of the deployment, application.fqdn
+	FQDN string
+	// LocalProvider is true for clusters that run on the local machine, like minikube. Their DNS is the hosts file.
+	LocalProvider bool
+	// CertManager is true if the certificates of the deployment are issued by cert-manager
+	CertManager bool
+	// OnepanelResources are the resources of the onepanel component, its API workloads are checked
+	OnepanelResources []*unstructured.Unstructured
+}
+
+// Doctor finds problems in a running deployment
+type Doctor struct {
+	client     ClusterClient
+	lookupHost func(host string) ([]string, error)
+}
+
+// NewDoctor creates a Doctor that inspects the cluster with client and resolves names with the DNS of this machine
+func NewDoctor(client ClusterClient) *Doctor {
+	return &Doctor{
+		client:     client,
+		lookupHost: net.LookupHost,
+	}
+}
+
+// Run runs every check, in order. An error is returned if the cluster could not be inspected.
+func (d *Doctor) Run(options DoctorOptions) ([]DoctorResult, error) {
+	results := make([]DoctorResult, 0)
+
+	ingress, address, err := d.checkIngressAddress()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", ingress.Check, err)
+	}
+	results = append(results, ingress, d.checkDNS(options, address))
+
+	checks := []func(DoctorOptions) (DoctorResult, error){
+		d.checkCertificates,
+		d.checkArtifactRepositorySecret,
+		d.checkOnepanelAPI,
+	}
+	for _, check := range checks {
+		result, err := check(options)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", result.Check, err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// DoctorFailed returns true if any of the results failed
+func DoctorFailed(results []DoctorResult) bool {
+	for _, result := range results {
+		if result.Status == CheckFail {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIngressAddress also returns the address of the istio ingress gateway, empty if it has none
+func (d *Doctor) checkIngressAddress() (DoctorResult, string, error) {
+	result := DoctorResult{Check: "Ingress address"}
+
+	service, err := d.client.Get("v1", "Service", "istio-system", "istio-ingressgateway")
+	if err != nil {
+		return result, "", err
+	}
+	if service == nil {
+		result.Status = CheckFail
+		result.Message = "service istio-system/istio-ingressgateway does not exist"
+		result.Remediation = "Run 'opctl apply' to install istio, then check 'opctl app status'"
+		return result, "", nil
+	}
+
+	address := loadBalancerAddress(service)
+	if address == "" {
+		result.Status = CheckFail
+		result.Message = "service istio-system/istio-ingressgateway has no external address"
+		result.Remediation = "Run 'kubectl describe service -n istio-system istio-ingressgateway' for events of the load balancer. " +
+			"On clusters that are not in the cloud, run 'opctl init' with --enable-metallb and apply again"
+		return result, "", nil
+	}
+
+	result.Status = CheckPass
+	result.Message = address
+
+	return result, address, nil
+}
+
+func (d *Doctor) checkDNS(options DoctorOptions, address string) DoctorResult {
+	result := DoctorResult{Check: "DNS"}
+	if address == "" {
+		result.Status = CheckWarn
+		result.Message = "skipped, the ingress gateway has no address to compare with"
+		return result
+	}
+
+	// The hosts file has no wildcards, only the fqdn is added to it
+	host := options.FQDN
+	record := GetWildCardDNS(options.URL)
+	if !options.LocalProvider {
+		host = strings.Replace(record, "*", "opctl-doctor", 1)
+	}
+
+	resolved, err := d.lookupHost(host)
+	if err == nil && !d.sameAddress(resolved, address) {
+		err = fmt.Errorf("%v resolves to %v instead of %v", host, strings.Join(resolved, ", "), address)
+	}
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		if options.LocalProvider {
+			result.Remediation = fmt.Sprintf("In your hosts file, add '%v %v'", address, options.FQDN)
+		} else if IsIpv4(address) {
+			result.Remediation = fmt.Sprintf("In your DNS, add an A record for %v and point it to %v", record, address)
+		} else {
+			result.Remediation = fmt.Sprintf("In your DNS, add a CNAME record for %v and point it to %v", record, address)
+		}
+		return result
+	}
+
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%v resolves to %v", host, address)
+
+	return result
+}
+
+// sameAddress returns true if the resolved IPs include the address, or one of the IPs the address resolves to
+func (d *Doctor) sameAddress(resolved []string, address string) bool {
+	addresses := []string{address}
+	if !IsIpv4(address) {
+		if hostAddresses, err := d.lookupHost(address); err == nil {
+			addresses = hostAddresses
+		}
+	}
+
+	for _, ip := range resolved {
+		for _, expected := range addresses {
+			if ip == expected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (d *Doctor) checkCertificates(options DoctorOptions) (DoctorResult, error) {
+	result := DoctorResult{Check: "Certificates", Status: CheckPass}
+	if !options.CertManager {
+		result.Message = "the certificates of the deployment are not managed by cert-manager"
+		return result, nil
+	}
+
+	var certificates []*unstructured.Unstructured
+	for _, version := range certificateVersions {
+		var err error
+		certificates, err = d.client.List(version, "Certificate", "", "")
+		if err != nil {
+			return result, err
+		}
+		if len(certificates) != 0 {
+			break
+		}
+	}
+
+	if len(certificates) == 0 {
+		result.Status = CheckFail
+		result.Message = "there are no cert-manager Certificates"
+		result.Remediation = "Run 'opctl apply' and check that cert-manager is part of config.yaml"
+		return result, nil
+	}
+
+	notReady := make([]string, 0)
+	for _, certificate := range certificates {
+		ready, reason := certificateReady(certificate)
+		if !ready {
+			notReady = append(notReady, fmt.Sprintf("%v/%v: %v", certificate.GetNamespace(), certificate.GetName(), reason))
+		}
+	}
+
+	if len(notReady) != 0 {
+		result.Status = CheckFail
+		result.Message = "Certificates are not ready: " + strings.Join(notReady, "; ")
+		result.Remediation = "Run 'kubectl describe certificate -n <namespace> <name>' for the events of each Certificate. " +
+			"Failing DNS challenges usually mean the credentials of your DNS provider in params.yaml are wrong"
+		return result, nil
+	}
+
+	result.Message = fmt.Sprintf("%v Certificates are ready", len(certificates))
+
+	return result, nil
+}
+
+// certificateReady returns true if the certificate has the Ready condition, otherwise the reason it is not ready
+func certificateReady(certificate *unstructured.Unstructured) (bool, string) {
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == "True" {
+			return true, ""
+		}
+
+		message, _ := condition["message"].(string)
+		return false, message
+	}
+
+	return false, "no Ready condition yet"
+}
+
+func (d *Doctor) checkArtifactRepositorySecret(options DoctorOptions) (DoctorResult, error) {
+	result := DoctorResult{Check: "Artifact repository secret"}
+	remediation := "Set artifactRepository in params.yaml and run 'opctl apply'"
+
+	resources, err := d.client.List("v1", "Secret", options.Namespace, "")
+	if err != nil {
+		return result, err
+	}
+
+	for _, resource := range resources {
+		secret := &corev1.Secret{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, secret); err != nil {
+			return result, err
+		}
+		if _, ok := secret.Data[artifactRepositoryAccessKey]; !ok {
+			continue
+		}
+
+		missing := make([]string, 0)
+		for _, key := range []string{artifactRepositoryAccessKey, artifactRepositorySecretKey} {
+			if len(secret.Data[key]) == 0 {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) != 0 {
+			result.Status = CheckFail
+			result.Message = fmt.Sprintf("Secret %v/%v is missing %v", secret.Namespace, secret.Name, strings.Join(missing, ", "))
+			result.Remediation = remediation
+			return result, nil
+		}
+
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("Secret %v/%v has the access and secret keys", secret.Namespace, secret.Name)
+		return result, nil
+	}
+
+	result.Status = CheckFail
+	result.Message = fmt.Sprintf("no Secret in namespace %v has the artifact repository keys", options.Namespace)
+	result.Remediation = remediation
+
+	return result, nil
+}
+
+func (d *Doctor) checkOnepanelAPI(options DoctorOptions) (DoctorResult, error) {
+	result := DoctorResult{Check: "Onepanel API"}
+
+	health, err := NewHealthReporter(d.client).ComponentHealth("common/onepanel", nil, options.OnepanelResources)
+	if err != nil {
+		return result, err
+	}
+	if len(health.Workloads) == 0 {
+		result.Status = CheckWarn
+		result.Message = "the onepanel component has no workloads"
+		return result, nil
+	}
+
+	problems := make([]string, 0)
+	for _, workload := range health.Workloads {
+		if workload.Healthy() {
+			continue
+		}
+
+		problem := fmt.Sprintf("%v %v/%v has %v/%v ready replicas", workload.Kind, workload.Namespace, workload.Name,
+			workload.ReadyReplicas, workload.DesiredReplicas)
+		if workload.Missing {
+			problem = fmt.Sprintf("%v %v/%v does not exist", workload.Kind, workload.Namespace, workload.Name)
+		}
+		for _, pod := range workload.FailingPods {
+			problem += fmt.Sprintf(", pod %v is %v", pod.Name, pod.Reason)
+		}
+		problems = append(problems, problem)
+	}
+
+	if len(problems) != 0 {
+		result.Status = CheckFail
+		result.Message = strings.Join(problems, "; ")
+		result.Remediation = fmt.Sprintf("Run 'opctl app status' for recent events and 'kubectl logs -n %v <pod>' for the logs of failing pods", options.Namespace)
+		return result, nil
+	}
+
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%v workloads are healthy", len(health.Workloads))
+
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const doctorOnepanelResources = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: onepanel-core
+  namespace: onepanel`
+
+func testIngressGateway(address string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: v1.ObjectMeta{Namespace: "istio-system", Name: "istio-ingressgateway"},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: address}}},
+		},
+	}
+}
+
+func testCertificate(name, ready, message string) *unstructured.Unstructured {
+	certificate := &unstructured.Unstructured{}
+	certificate.SetAPIVersion("cert-manager.io/v1alpha2")
+	certificate.SetKind("Certificate")
+	certificate.SetNamespace("istio-system")
+	certificate.SetName(name)
+	_ = unstructured.SetNestedSlice(certificate.Object, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": ready, "message": message},
+	}, "status", "conditions")
+
+	return certificate
+}
+
+func testDoctorOptions(t *testing.T) DoctorOptions {
+	resources, err := ParseResources(doctorOnepanelResources)
+	assert.Nil(t, err)
+
+	return DoctorOptions{
+		Namespace:         "onepanel",
+		URL:               "https://app.example.com",
+		FQDN:              "app.example.com",
+		CertManager:       true,
+		OnepanelResources: resources,
+	}
+}
+
+func testLookupHost(hosts map[string][]string) func(string) ([]string, error) {
+	return func(host string) ([]string, error) {
+		if addresses, ok := hosts[host]; ok {
+			return addresses, nil
+		}
+
+		return nil, fmt.Errorf("lookup %v: no such host", host)
+	}
+}
+
+func doctorResults(results []DoctorResult) map[string]DoctorResult {
+	byCheck := make(map[string]DoctorResult)
+	for _, result := range results {
+		byCheck[result.Check] = result
+	}
+
+	return byCheck
+}
+
+func TestDoctor_Run(t *testing.T) {
+	replicas := int32(1)
+	client, err := NewFakeClusterClient(
+		testIngressGateway("10.0.0.1"),
+		testCertificate("wildcard", "True", ""),
+		&corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "onepanel"},
+			Data: map[string][]byte{
+				artifactRepositoryAccessKey: []byte("access"),
+				artifactRepositorySecretKey: []byte("secret"),
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "onepanel-core"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+	)
+	assert.Nil(t, err)
+
+	doctor := NewDoctor(client)
+	doctor.lookupHost = testLookupHost(map[string][]string{"opctl-doctor.example.com": {"10.0.0.1"}})
+
+	results, err := doctor.Run(testDoctorOptions(t))
+	assert.Nil(t, err)
+	assert.Len(t, results, 5)
+	assert.False(t, DoctorFailed(results))
+	for _, result := range results {
+		assert.Equal(t, CheckPass, result.Status, result.Check)
+		assert.Empty(t, result.Remediation)
+	}
+}
+
+func TestDoctor_RunFailures(t *testing.T) {
+	client, err := NewFakeClusterClient(
+		testIngressGateway("10.0.0.1"),
+		testCertificate("wildcard", "False", "Issuing certificate as Secret does not exist"),
+		&corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "onepanel"},
+			Data:       map[string][]byte{artifactRepositoryAccessKey: []byte("access")},
+		},
+	)
+	assert.Nil(t, err)
+
+	doctor := NewDoctor(client)
+	doctor.lookupHost = testLookupHost(map[string][]string{"opctl-doctor.example.com": {"10.0.0.2"}})
+
+	results, err := doctor.Run(testDoctorOptions(t))
+	assert.Nil(t, err)
+	assert.True(t, DoctorFailed(results))
+
+	byCheck := doctorResults(results)
+	assert.Equal(t, CheckPass, byCheck["Ingress address"].Status)
+	assert.Equal(t, CheckFail, byCheck["DNS"].Status)
+	assert.Equal(t, "In your DNS, add an A record for *.example.com and point it to 10.0.0.1", byCheck["DNS"].Remediation)
+	assert.Equal(t, CheckFail, byCheck["Certificates"].Status)
+	assert.Contains(t, byCheck["Certificates"].Message, "istio-system/wildcard: Issuing certificate as Secret does not exist")
+	assert.Equal(t, CheckFail, byCheck["Artifact repository secret"].Status)
+	assert.Contains(t, byCheck["Artifact repository secret"].Message, artifactRepositorySecretKey)
+	assert.Equal(t, CheckFail, byCheck["Onepanel API"].Status)
+	assert.Contains(t, byCheck["Onepanel API"].Message, "Deployment onepanel/onepanel-core does not exist")
+	for _, result := range results {
+		if result.Status == CheckFail {
+			assert.NotEmpty(t, result.Remediation, result.Check)
+		}
+	}
+}
+
+func TestDoctor_RunLocalProvider(t *testing.T) {
+	client, err := NewFakeClusterClient(&corev1.Service{
+		ObjectMeta: v1.ObjectMeta{Namespace: "istio-system", Name: "istio-ingressgateway"},
+	})
+	assert.Nil(t, err)
+
+	doctor := NewDoctor(client)
+	doctor.lookupHost = testLookupHost(nil)
+
+	options := testDoctorOptions(t)
+	options.LocalProvider = true
+	options.CertManager = false
+
+	byCheck := doctorResults(mustRunDoctor(t, doctor, options))
+	assert.Equal(t, CheckFail, byCheck["Ingress address"].Status)
+	assert.Contains(t, byCheck["Ingress address"].Remediation, "--enable-metallb")
+	assert.Equal(t, CheckWarn, byCheck["DNS"].Status)
+	assert.Equal(t, CheckPass, byCheck["Certificates"].Status)
+
+	client.Resources = nil
+	assert.Nil(t, client.Apply(0, mustUnstructured(t, testIngressGateway("192.168.64.2"))))
+
+	byCheck = doctorResults(mustRunDoctor(t, doctor, options))
+	assert.Equal(t, CheckFail, byCheck["DNS"].Status)
+	assert.Equal(t, "In your hosts file, add '192.168.64.2 app.example.com'", byCheck["DNS"].Remediation)
+}
+
+func mustRunDoctor(t *testing.T, doctor *Doctor, options DoctorOptions) []DoctorResult {
+	results, err := doctor.Run(options)
+	assert.Nil(t, err)
+
+	return results
+}
+
+func mustUnstructured(t *testing.T, service *corev1.Service) *unstructured.Unstructured {
+	resource, err := toUnstructured(service)
+	assert.Nil(t, err)
+
+	return resource
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/iancoleman/strcase"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
-	"log"
 	"sort"
 	"strconv"
 	"strings"
@@ -63,6 +62,10 @@ type NodePair struct {
 
 type DynamicYaml struct {
 	node *yaml.Node
+	// decryptedKeys are the flattened keys of the values that were decrypted, see DecryptParams
+	decryptedKeys map[string]bool
+	// references are the values of the flattened keys before their references were resolved, see ResolveParamReferences
+	references map[string]string
 }
 
 func LoadDynamicYamlFromFile(filePath string) (*DynamicYaml, error) {
@@ -535,6 +538,8 @@ func (d *DynamicYaml) Flatten(keyFormatter FlatMapKeyFormatter) map[string]NodeP
 	return results
 }
 
+// FlattenToKeyValue flattens the data into a map of keys to bools, ints or strings, see NodeValueToActual.
+// Values that can not be converted, e.g. an int in hex notation, are kept as strings.
 func (d *DynamicYaml) FlattenToKeyValue(keyFormatter FlatMapKeyFormatter) map[string]interface{} {
 	results := make(map[string]NodePair)
 
@@ -545,8 +550,7 @@ func (d *DynamicYaml) FlattenToKeyValue(keyFormatter FlatMapKeyFormatter) map[st
 	for key := range results {
 		value, err := NodeValueToActual(results[key].Value)
 		if err != nil {
-			log.Fatal("Unable to convert node value: %v", err.Error())
-			continue
+			value = results[key].Value.Value
 		}
 
 		flatResult[key] = value
@@ -0,0 +1,228 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// GeneratedSecretsSecretName is the name of the Secret, in InventoryNamespace, that keeps the generated secrets
+	GeneratedSecretsSecretName = "opctl-generated-secrets"
+
+	// MetalLbSecretKey is the key MetalLB speakers use to encrypt their memberlist traffic
+	MetalLbSecretKey = "metalLbSecretKey"
+	// ArtifactRepositoryGCSSecretKey is the secret key of the minio gateway in front of a GCS artifact repository
+	ArtifactRepositoryGCSSecretKey = "artifactRepositoryGCSSecretKey"
+)
+
+// generatedSecretGenerators create a new value for each generated secret, by name
+var generatedSecretGenerators = map[string]func() (string, error){
+	MetalLbSecretKey: func() (string, error) {
+		key := make([]byte, 128)
+		if _, err := rand.Read(key); err != nil {
+			return "", err
+		}
+
+		return base64.StdEncoding.EncodeToString(key), nil
+	},
+	ArtifactRepositoryGCSSecretKey: func() (string, error) {
+		return RandASCIIString(16)
+	},
+}
+
+// GeneratedSecretPlaceholder returns the value that is rendered for the generated secret when it must not be created,
+// e.g. by build. It is valid base64, like the generated MetalLB key.
+func GeneratedSecretPlaceholder(name string) string {
+	return base64.StdEncoding.EncodeToString([]byte("opctl-generated-" + name))
+}
+
+// GeneratedSecretNames returns the names of the secrets opctl generates, sorted
+func GeneratedSecretNames() []string {
+	names := make([]string, 0, len(generatedSecretGenerators))
+	for name := range generatedSecretGenerators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GeneratedSecretStore saves and loads the generated secrets in the cluster
+type GeneratedSecretStore struct {
+	client kubernetes.Interface
+}
+
+// NewGeneratedSecretStore creates a GeneratedSecretStore that uses client to access the Secret
+func NewGeneratedSecretStore(client kubernetes.Interface) *GeneratedSecretStore {
+	return &GeneratedSecretStore{client: client}
+}
+
+// Load returns the generated secrets by name. If none were saved yet, the result is empty.
+func (s *GeneratedSecretStore) Load() (map[string]string, error) {
+	values := make(map[string]string)
+
+	secret, err := s.client.CoreV1().Secrets(InventoryNamespace).Get(GeneratedSecretsSecretName, v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range secret.Data {
+		values[name] = string(value)
+	}
+
+	return values, nil
+}
+
+// Save replaces the generated secrets in the cluster. InventoryNamespace is created if it does not exist.
+func (s *GeneratedSecretStore) Save(values map[string]string) error {
+	if err := ensureInventoryNamespace(s.client); err != nil {
+		return err
+	}
+
+	data := make(map[string][]byte)
+	for name, value := range values {
+		data[name] = []byte(value)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: InventoryNamespace,
+			Name:      GeneratedSecretsSecretName,
+			Labels: map[string]string{
+				ManagedByLabel: ManagedByValue,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+
+	secrets := s.client.CoreV1().Secrets(InventoryNamespace)
+	_, err := secrets.Update(secret)
+	if k8serrors.IsNotFound(err) {
+		_, err = secrets.Create(secret)
+	}
+
+	return err
+}
+
+// Delete removes the generated secrets from the cluster. It is not an error if there are none.
+func (s *GeneratedSecretStore) Delete() error {
+	err := s.client.CoreV1().Secrets(InventoryNamespace).Delete(GeneratedSecretsSecretName, &v1.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+// GeneratedSecrets hands out generated secrets, so every build uses the same values instead of new ones.
+// The saved values are loaded on first use. Missing values are generated, and kept until Save is called.
+type GeneratedSecrets struct {
+	store  *GeneratedSecretStore
+	values map[string]string
+	// readOnly is true if missing values are returned as GeneratedSecretPlaceholder instead of being generated
+	readOnly bool
+	// unsaved is true if values has secrets that are not in the store yet
+	unsaved bool
+}
+
+// NewGeneratedSecrets creates GeneratedSecrets that are kept in store
+func NewGeneratedSecrets(store *GeneratedSecretStore) *GeneratedSecrets {
+	return &GeneratedSecrets{store: store}
+}
+
+// NewReadOnlyGeneratedSecrets creates GeneratedSecrets that only load the saved values of store.
+// Secrets that were not saved yet are returned as GeneratedSecretPlaceholder.
+func NewReadOnlyGeneratedSecrets(store *GeneratedSecretStore) *GeneratedSecrets {
+	return &GeneratedSecrets{store: store, readOnly: true}
+}
+
+// Get returns the value of the generated secret. It is generated if it does not exist yet.
+func (g *GeneratedSecrets) Get(name string) (string, error) {
+	generate, ok := generatedSecretGenerators[name]
+	if !ok {
+		return "", fmt.Errorf("unknown generated secret '%v'", name)
+	}
+
+	if err := g.load(); err != nil {
+		return "", err
+	}
+
+	if value, ok := g.values[name]; ok {
+		return value, nil
+	}
+	if g.readOnly {
+		return GeneratedSecretPlaceholder(name), nil
+	}
+
+	value, err := generate()
+	if err != nil {
+		return "", err
+	}
+	g.values[name] = value
+	g.unsaved = true
+
+	return value, nil
+}
+
+// Save saves the secrets that were generated by Get. Nothing is saved if there are none.
+func (g *GeneratedSecrets) Save() error {
+	if !g.unsaved {
+		return nil
+	}
+
+	if err := g.store.Save(g.values); err != nil {
+		return err
+	}
+	g.unsaved = false
+
+	return nil
+}
+
+// Rotate replaces the value of the generated secret with a new one and saves it
+func (g *GeneratedSecrets) Rotate(name string) error {
+	generate, ok := generatedSecretGenerators[name]
+	if !ok {
+		return fmt.Errorf("unknown generated secret '%v'", name)
+	}
+	if g.readOnly {
+		return fmt.Errorf("unable to rotate %v, the generated secrets are read only", name)
+	}
+
+	if err := g.load(); err != nil {
+		return err
+	}
+
+	value, err := generate()
+	if err != nil {
+		return err
+	}
+	g.values[name] = value
+	g.unsaved = true
+
+	return g.Save()
+}
+
+func (g *GeneratedSecrets) load() error {
+	if g.values != nil {
+		return nil
+	}
+
+	values, err := g.store.Load()
+	if err != nil {
+		return err
+	}
+	g.values = values
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGeneratedSecrets(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := NewGeneratedSecretStore(client)
+
+	secrets := NewGeneratedSecrets(store)
+	value, err := secrets.Get(MetalLbSecretKey)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, value)
+
+	again, err := secrets.Get(MetalLbSecretKey)
+	assert.Nil(t, err)
+	assert.Equal(t, value, again)
+
+	// Nothing is saved until Save is called
+	saved, err := store.Load()
+	assert.Nil(t, err)
+	assert.Empty(t, saved)
+
+	assert.Nil(t, secrets.Save())
+	reloaded, err := NewGeneratedSecrets(store).Get(MetalLbSecretKey)
+	assert.Nil(t, err)
+	assert.Equal(t, value, reloaded)
+
+	_, err = secrets.Get("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestGeneratedSecrets_Rotate(t *testing.T) {
+	store := NewGeneratedSecretStore(fake.NewSimpleClientset())
+
+	secrets := NewGeneratedSecrets(store)
+	gcsKey, err := secrets.Get(ArtifactRepositoryGCSSecretKey)
+	assert.Nil(t, err)
+	metalLbKey, err := secrets.Get(MetalLbSecretKey)
+	assert.Nil(t, err)
+	assert.Nil(t, secrets.Save())
+
+	assert.Nil(t, NewGeneratedSecrets(store).Rotate(MetalLbSecretKey))
+
+	saved, err := store.Load()
+	assert.Nil(t, err)
+	assert.NotEqual(t, metalLbKey, saved[MetalLbSecretKey])
+	assert.Equal(t, gcsKey, saved[ArtifactRepositoryGCSSecretKey])
+
+	assert.Nil(t, store.Delete())
+	saved, err = store.Load()
+	assert.Nil(t, err)
+	assert.Empty(t, saved)
+}
+
+func TestGeneratedSecrets_ReadOnly(t *testing.T) {
+	store := NewGeneratedSecretStore(fake.NewSimpleClientset())
+
+	// Missing secrets are neither generated nor saved
+	secrets := NewReadOnlyGeneratedSecrets(store)
+	value, err := secrets.Get(MetalLbSecretKey)
+	assert.Nil(t, err)
+	assert.Equal(t, GeneratedSecretPlaceholder(MetalLbSecretKey), value)
+	assert.Nil(t, secrets.Save())
+	assert.NotNil(t, secrets.Rotate(MetalLbSecretKey))
+
+	saved, err := store.Load()
+	assert.Nil(t, err)
+	assert.Empty(t, saved)
+
+	generated := NewGeneratedSecrets(store)
+	metalLbKey, err := generated.Get(MetalLbSecretKey)
+	assert.Nil(t, err)
+	assert.Nil(t, generated.Save())
+
+	value, err = NewReadOnlyGeneratedSecrets(store).Get(MetalLbSecretKey)
+	assert.Nil(t, err)
+	assert.Equal(t, metalLbKey, value)
+}
+
+func TestRandASCIIString(t *testing.T) {
+	value, err := RandASCIIString(64)
+	assert.Nil(t, err)
+	assert.Len(t, value, 64)
+	for _, letter := range value {
+		assert.Contains(t, letterBytes, string(letter))
+	}
+}
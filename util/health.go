@@ -0,0 +1,262 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// healthEventWindow is how far back warning events are considered recent
+	healthEventWindow = time.Hour
+	// healthMaxEvents is the most warning events reported per component
+	healthMaxEvents = 5
+)
+
+// ComponentHealth is the health of the workloads rendered from a single component and its overlays
+type ComponentHealth struct {
+	Component string           `json:"component"`
+	Overlays  []string         `json:"overlays,omitempty"`
+	Healthy   bool             `json:"healthy"`
+	Workloads []WorkloadHealth `json:"workloads"`
+	Events    []WarningEvent   `json:"events,omitempty"`
+}
+
+// WorkloadHealth is the replica status of a Deployment, StatefulSet or DaemonSet along with its failing pods
+type WorkloadHealth struct {
+	Kind            string       `json:"kind"`
+	Namespace       string       `json:"namespace"`
+	Name            string       `json:"name"`
+	DesiredReplicas int32        `json:"desiredReplicas"`
+	ReadyReplicas   int32        `json:"readyReplicas"`
+	Missing         bool         `json:"missing,omitempty"` // true if the workload does not exist in the cluster
+	FailingPods     []PodFailure `json:"failingPods,omitempty"`
+}
+
+// Healthy returns true if the workload exists, all desired replicas are ready and no pods are failing
+func (w *WorkloadHealth) Healthy() bool {
+	return !w.Missing && w.ReadyReplicas >= w.DesiredReplicas && len(w.FailingPods) == 0
+}
+
+// PodFailure describes why a pod is not ready, e.g. CrashLoopBackOff
+type PodFailure struct {
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// WarningEvent is a summary of a recent kubernetes Warning event
+type WarningEvent struct {
+	Object   string    `json:"object"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// HealthReporter inspects the live state of rendered workloads
+type HealthReporter struct {
+	client ClusterClient
+}
+
+// NewHealthReporter creates a HealthReporter that uses client to look up workloads
+func NewHealthReporter(client ClusterClient) *HealthReporter {
+	return &HealthReporter{client: client}
+}
+
+// ComponentHealth reports the health of every Deployment, StatefulSet and DaemonSet in resources,
+// which are expected to be the rendered resources of component.
+func (h *HealthReporter) ComponentHealth(component string, overlays []string, resources []*unstructured.Unstructured) (*ComponentHealth, error) {
+	report := &ComponentHealth{
+		Component: component,
+		Overlays:  overlays,
+		Healthy:   true,
+		Workloads: make([]WorkloadHealth, 0),
+	}
+
+	involvedObjects := make(map[string]bool)
+	namespaces := make(map[string]bool)
+
+	for _, resource := range resources {
+		workload, pods, err := h.workloadHealth(resource)
+		if err != nil {
+			return nil, err
+		}
+		if workload == nil {
+			continue
+		}
+
+		if !workload.Healthy() {
+			report.Healthy = false
+		}
+		report.Workloads = append(report.Workloads, *workload)
+
+		namespaces[workload.Namespace] = true
+		involvedObjects[workload.Namespace+"/"+workload.Name] = true
+		for _, pod := range pods {
+			involvedObjects[pod.Namespace+"/"+pod.Name] = true
+		}
+	}
+
+	for namespace := range namespaces {
+		events, err := h.warningEvents(namespace, involvedObjects)
+		if err != nil {
+			return nil, err
+		}
+		report.Events = append(report.Events, events...)
+	}
+
+	sort.Slice(report.Events, func(i, j int) bool {
+		return report.Events[i].LastSeen.After(report.Events[j].LastSeen)
+	})
+	if len(report.Events) > healthMaxEvents {
+		report.Events = report.Events[:healthMaxEvents]
+	}
+
+	return report, nil
+}
+
+// workloadHealth returns nil if the resource is not a workload
+func (h *HealthReporter) workloadHealth(resource *unstructured.Unstructured) (*WorkloadHealth, []corev1.Pod, error) {
+	workload := &WorkloadHealth{
+		Kind:      resource.GetKind(),
+		Namespace: resource.GetNamespace(),
+		Name:      resource.GetName(),
+	}
+
+	switch resource.GetKind() {
+	case "Deployment", "StatefulSet", "DaemonSet":
+	default:
+		return nil, nil, nil
+	}
+
+	live, err := h.client.Get("apps/v1", resource.GetKind(), workload.Namespace, workload.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if live == nil {
+		workload.Missing = true
+		return workload, nil, nil
+	}
+
+	var selector *v1.LabelSelector
+	switch resource.GetKind() {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, deployment); err != nil {
+			return nil, nil, err
+		}
+		workload.DesiredReplicas = 1
+		if deployment.Spec.Replicas != nil {
+			workload.DesiredReplicas = *deployment.Spec.Replicas
+		}
+		workload.ReadyReplicas = deployment.Status.ReadyReplicas
+		selector = deployment.Spec.Selector
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, statefulSet); err != nil {
+			return nil, nil, err
+		}
+		workload.DesiredReplicas = 1
+		if statefulSet.Spec.Replicas != nil {
+			workload.DesiredReplicas = *statefulSet.Spec.Replicas
+		}
+		workload.ReadyReplicas = statefulSet.Status.ReadyReplicas
+		selector = statefulSet.Spec.Selector
+	case "DaemonSet":
+		daemonSet := &appsv1.DaemonSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, daemonSet); err != nil {
+			return nil, nil, err
+		}
+		workload.DesiredReplicas = daemonSet.Status.DesiredNumberScheduled
+		workload.ReadyReplicas = daemonSet.Status.NumberReady
+		selector = daemonSet.Spec.Selector
+	}
+
+	pods, err := h.selectPods(workload.Namespace, selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range pods {
+		reason, message := podNotReadyReason(&pods[i])
+		if reason == "" || pods[i].Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+
+		workload.FailingPods = append(workload.FailingPods, PodFailure{
+			Name:    pods[i].Name,
+			Reason:  reason,
+			Message: message,
+		})
+	}
+
+	return workload, pods, nil
+}
+
+func (h *HealthReporter) selectPods(namespace string, selector *v1.LabelSelector) ([]corev1.Pod, error) {
+	if selector == nil {
+		return nil, nil
+	}
+
+	labelSelector, err := v1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := h.client.List("v1", "Pod", namespace, labelSelector.String())
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]corev1.Pod, len(resources))
+	for i, resource := range resources {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, &pods[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return pods, nil
+}
+
+func (h *HealthReporter) warningEvents(namespace string, involvedObjects map[string]bool) ([]WarningEvent, error) {
+	events, err := h.client.ListEvents(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-healthEventWindow)
+	results := make([]WarningEvent, 0)
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning {
+			continue
+		}
+		if !involvedObjects[event.InvolvedObject.Namespace+"/"+event.InvolvedObject.Name] {
+			continue
+		}
+
+		lastSeen := event.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = event.EventTime.Time
+		}
+		if lastSeen.Before(since) {
+			continue
+		}
+
+		results = append(results, WarningEvent{
+			Object:   fmt.Sprintf("%v %v", event.InvolvedObject.Kind, event.InvolvedObject.Name),
+			Reason:   event.Reason,
+			Message:  event.Message,
+			Count:    event.Count,
+			LastSeen: lastSeen,
+		})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHealthReporter_ComponentHealth(t *testing.T) {
+	replicas := int32(1)
+	labels := map[string]string{"app": "core"}
+
+	pending := testPod("onepanel", "core-abc", corev1.PodPending, corev1.ConditionFalse)
+	pending.Labels = labels
+	pending.Status.Conditions = append(pending.Status.Conditions, corev1.PodCondition{
+		Type:    corev1.PodScheduled,
+		Status:  corev1.ConditionFalse,
+		Message: "0/1 nodes are available: 1 Insufficient cpu.",
+	})
+
+	client, err := NewFakeClusterClient(
+		&appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "core"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &v1.LabelSelector{MatchLabels: labels},
+			},
+		},
+		pending,
+		&corev1.Event{
+			ObjectMeta:     v1.ObjectMeta{Namespace: "onepanel", Name: "core-abc.1"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "onepanel", Name: "core-abc"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "FailedScheduling",
+			Message:        "0/1 nodes are available: 1 Insufficient cpu.",
+			Count:          3,
+			LastTimestamp:  v1.NewTime(time.Now()),
+		},
+		&corev1.Event{
+			ObjectMeta:     v1.ObjectMeta{Namespace: "onepanel", Name: "other.1"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "onepanel", Name: "other"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "BackOff",
+			LastTimestamp:  v1.NewTime(time.Now()),
+		},
+	)
+	assert.Nil(t, err)
+
+	resources, err := ParseResources(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: core
+  namespace: onepanel
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: onepanel
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: core
+  namespace: onepanel`)
+	assert.Nil(t, err)
+
+	report, err := NewHealthReporter(client).ComponentHealth("common/onepanel", []string{"common/onepanel/overlays/gke"}, resources)
+	assert.Nil(t, err)
+
+	assert.False(t, report.Healthy)
+	assert.Len(t, report.Workloads, 2)
+
+	core := report.Workloads[0]
+	assert.Equal(t, int32(1), core.DesiredReplicas)
+	assert.Equal(t, int32(0), core.ReadyReplicas)
+	assert.Len(t, core.FailingPods, 1)
+	assert.Equal(t, "Pending", core.FailingPods[0].Reason)
+	assert.Equal(t, "0/1 nodes are available: 1 Insufficient cpu.", core.FailingPods[0].Message)
+
+	assert.True(t, report.Workloads[1].Missing)
+
+	assert.Len(t, report.Events, 1)
+	assert.Equal(t, "FailedScheduling", report.Events[0].Reason)
+}
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// InventoryNamespace is the namespace opctl keeps its own state in
+	InventoryNamespace = "opctl-system"
+	// InventorySecretName is the name of the Secret that holds the inventory of the last apply
+	InventorySecretName = "opctl-inventory"
+
+	inventoryDataKey = "inventory.json"
+)
+
+// InventoryResource identifies a single resource that was applied to the cluster
+type InventoryResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// InventoryComponent is a component from config.yaml along with the resources it rendered
+type InventoryComponent struct {
+	Name      string              `json:"name"`
+	Overlays  []string            `json:"overlays,omitempty"`
+	Resources []InventoryResource `json:"resources"`
+}
+
+// Inventory records what the last apply deployed, so other commands do not depend on local files.
+// ApplicationResources are applied before, and deleted after, Resources.
+type Inventory struct {
+	Revision             int                  `json:"revision"`
+	RollbackOf           int                  `json:"rollbackOf,omitempty"` // the revision that was rolled back to, if any
+	User                 string               `json:"user"`
+	CLIVersion           string               `json:"cliVersion"`
+	ManifestsTag         string               `json:"manifestsTag"`
+	AppliedAt            time.Time            `json:"appliedAt"`
+	Config               string               `json:"config"`
+	Params               string               `json:"params"` // secret params are redacted, references are resolved, see RedactSecretParams
+	ApplicationResources []InventoryResource  `json:"applicationResources"`
+	Resources            []InventoryResource  `json:"resources"`
+	Components           []InventoryComponent `json:"components"`
+}
+
+// NewInventoryResources returns the identity of each resource
+func NewInventoryResources(resources []*unstructured.Unstructured) []InventoryResource {
+	results := make([]InventoryResource, 0)
+	for _, resource := range resources {
+		results = append(results, InventoryResource{
+			APIVersion: resource.GetAPIVersion(),
+			Kind:       resource.GetKind(),
+			Namespace:  resource.GetNamespace(),
+			Name:       resource.GetName(),
+		})
+	}
+
+	return results
+}
+
+// InventoryResourcesToUnstructured returns objects that only have the identity of each resource set.
+// They are enough to look up, or delete, the resources.
+func InventoryResourcesToUnstructured(resources []InventoryResource) []*unstructured.Unstructured {
+	results := make([]*unstructured.Unstructured, 0)
+	for _, resource := range resources {
+		object := &unstructured.Unstructured{Object: make(map[string]interface{})}
+		object.SetAPIVersion(resource.APIVersion)
+		object.SetKind(resource.Kind)
+		object.SetNamespace(resource.Namespace)
+		object.SetName(resource.Name)
+
+		results = append(results, object)
+	}
+
+	return results
+}
+
+// InventoryStore saves and loads the inventory in the cluster
+type InventoryStore struct {
+	client kubernetes.Interface
+}
+
+// NewInventoryStore creates an InventoryStore that uses client to access the inventory Secret
+func NewInventoryStore(client kubernetes.Interface) *InventoryStore {
+	return &InventoryStore{client: client}
+}
+
+// Load returns the inventory of the last apply. If there is none, nil is returned, with no error
+func (s *InventoryStore) Load() (*Inventory, error) {
+	secret, err := s.client.CoreV1().Secrets(InventoryNamespace).Get(InventorySecretName, v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &Inventory{}
+	if err := json.Unmarshal(secret.Data[inventoryDataKey], inventory); err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
+
+// Save replaces the inventory in the cluster. InventoryNamespace is created if it does not exist.
+func (s *InventoryStore) Save(inventory *Inventory) error {
+	if err := ensureInventoryNamespace(s.client); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: InventoryNamespace,
+			Name:      InventorySecretName,
+			Labels: map[string]string{
+				ManagedByLabel: ManagedByValue,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			inventoryDataKey: data,
+		},
+	}
+
+	secrets := s.client.CoreV1().Secrets(InventoryNamespace)
+	_, err = secrets.Update(secret)
+	if k8serrors.IsNotFound(err) {
+		_, err = secrets.Create(secret)
+	}
+
+	return err
+}
+
+// Delete removes the inventory from the cluster. It is not an error if there is none.
+func (s *InventoryStore) Delete() error {
+	err := s.client.CoreV1().Secrets(InventoryNamespace).Delete(InventorySecretName, &v1.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+// ensureInventoryNamespace creates InventoryNamespace if it does not exist
+func ensureInventoryNamespace(client kubernetes.Interface) error {
+	namespace := &corev1.Namespace{
+		ObjectMeta: v1.ObjectMeta{Name: InventoryNamespace},
+	}
+
+	_, err := client.CoreV1().Namespaces().Create(namespace)
+	if k8serrors.IsAlreadyExists(err) {
+		return nil
+	}
+
+	return err
+}
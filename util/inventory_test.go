@@ -0,0 +1,172 @@
+package util
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInventoryStore(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := NewInventoryStore(client)
+
+	inventory, err := store.Load()
+	assert.Nil(t, err)
+	assert.Nil(t, inventory)
+
+	resources, err := ParseResources(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: core
+  namespace: onepanel
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: onepanel`)
+	assert.Nil(t, err)
+
+	saved := &Inventory{
+		CLIVersion:   "v0.1.0",
+		ManifestsTag: "v0.1.0",
+		AppliedAt:    time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+		Params:       "application:\n  defaultNamespace: example\n",
+		Resources:    NewInventoryResources(resources),
+	}
+	assert.Nil(t, store.Save(saved))
+	// Saving again updates the existing inventory
+	assert.Nil(t, store.Save(saved))
+
+	_, err = client.CoreV1().Namespaces().Get(InventoryNamespace, v1.GetOptions{})
+	assert.Nil(t, err)
+
+	inventory, err = store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, saved, inventory)
+
+	objects := InventoryResourcesToUnstructured(inventory.Resources)
+	assert.Len(t, objects, 2)
+	assert.Equal(t, "apps/Deployment/onepanel/core", ResourceKey(objects[0]))
+	assert.Equal(t, "/Namespace//onepanel", ResourceKey(objects[1]))
+
+	assert.Nil(t, store.Delete())
+	assert.Nil(t, store.Delete())
+	inventory, err = store.Load()
+	assert.Nil(t, err)
+	assert.Nil(t, inventory)
+}
+
+func TestRedactSecretParams(t *testing.T) {
+	yamlFile, err := LoadDynamicYamlFromString(`application:
+  defaultNamespace: example
+database:
+  host: postgres
+  password: hunter2
+artifactRepository:
+  s3:
+    accessKey: AKIA
+    secretKey: ""
+    bucket: example
+  gcs:
+    serviceAccountJSON: "{}"
+`)
+	assert.Nil(t, err)
+
+	redacted, err := RedactSecretParams(yamlFile)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "hunter2", yamlFile.GetValue("database.password").Value)
+	assert.Equal(t, RedactedValue, redacted.GetValue("database.password").Value)
+	assert.Equal(t, RedactedValue, redacted.GetValue("artifactRepository.s3.accessKey").Value)
+	assert.Equal(t, "", redacted.GetValue("artifactRepository.s3.secretKey").Value)
+	assert.Equal(t, "postgres", redacted.GetValue("database.host").Value)
+	assert.Equal(t, "example", redacted.GetValue("artifactRepository.s3.bucket").Value)
+	assert.Equal(t, RedactedValue, redacted.GetValue("artifactRepository.gcs.serviceAccountJSON").Value)
+}
+
+func TestInventoryStore_ReferencedParams(t *testing.T) {
+	defer os.Unsetenv("OPCTL_TEST_NAMESPACE")
+	assert.Nil(t, os.Setenv("OPCTL_TEST_NAMESPACE", "example"))
+
+	yamlFile, err := LoadDynamicYamlFromString("application:\n  defaultNamespace: ${env:OPCTL_TEST_NAMESPACE}\n")
+	assert.Nil(t, err)
+	_, err = ResolveParamReferences(yamlFile, os.TempDir())
+	assert.Nil(t, err)
+	redacted, err := RedactSecretParams(yamlFile)
+	assert.Nil(t, err)
+	params, err := redacted.String()
+	assert.Nil(t, err)
+
+	store := NewInventoryStore(fake.NewSimpleClientset())
+	assert.Nil(t, store.Save(&Inventory{Params: params}))
+
+	// The params of the inventory are used as they are, e.g. by app status, so the resolved value is stored
+	inventory, err := store.Load()
+	assert.Nil(t, err)
+	inventoryParams, err := LoadDynamicYamlFromString(inventory.Params)
+	assert.Nil(t, err)
+	assert.Equal(t, "example", inventoryParams.GetValue("application.defaultNamespace").Value)
+}
+
+func TestRedactSecretResources(t *testing.T) {
+	redacted, err := RedactSecretResources(`apiVersion: v1
+kind: Secret
+metadata:
+  name: onepanel
+data:
+  artifactRepositoryS3AccessKey: QUtJQQ==
+stringData:
+  password: hunter2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+data:
+  bucket: example
+`)
+	assert.Nil(t, err)
+
+	resources, err := ParseResources(redacted)
+	assert.Nil(t, err)
+	assert.Len(t, resources, 2)
+	assert.Equal(t, map[string]interface{}{"artifactRepositoryS3AccessKey": RedactedValue}, resources[0].Object["data"])
+	assert.Equal(t, map[string]interface{}{"password": RedactedValue}, resources[0].Object["stringData"])
+	assert.Equal(t, map[string]interface{}{"bucket": "example"}, resources[1].Object["data"])
+}
+
+func TestInventoryStore_Record(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := NewInventoryStore(client)
+
+	for i := 0; i < RevisionHistoryLimit+2; i++ {
+		inventory := &Inventory{ManifestsTag: "v0.1.0"}
+		assert.Nil(t, store.Record(inventory, "kind: Namespace", "kind: Deployment"))
+		assert.Equal(t, i+1, inventory.Revision)
+	}
+
+	revisions, err := store.Revisions()
+	assert.Nil(t, err)
+	assert.Len(t, revisions, RevisionHistoryLimit)
+	assert.Equal(t, 3, revisions[0].Revision)
+
+	current, err := store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, RevisionHistoryLimit+2, current.Revision)
+
+	revision, err := store.LoadRevision(5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, revision.Inventory.Revision)
+	assert.Equal(t, "kind: Namespace", revision.ApplicationManifests)
+	assert.Equal(t, "kind: Deployment", revision.Manifests)
+
+	revision, err = store.LoadRevision(1)
+	assert.Nil(t, err)
+	assert.Nil(t, revision)
+}
@@ -2,8 +2,9 @@ package util
 
 import (
 	"github.com/pkg/errors"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"net/http"
 	"os"
 	"regexp"
@@ -11,38 +12,82 @@ import (
 
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/transport"
 )
 
 type Config = restclient.Config
 
-func NewConfig() (config *Config, err error) {
-	config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+// KubeConfigOptions select the cluster, and the user, for every cluster call. Empty fields use the kubeconfig defaults.
+type KubeConfigOptions struct {
+	// Kubeconfig is the path of the kubeconfig file
+	Kubeconfig string
+	// Context is the kubeconfig context to use
+	Context string
+	// Namespace is the namespace of requests that do not name one
+	Namespace string
+	// Impersonate is the user to act as
+	Impersonate string
+}
+
+var kubeConfigOptions KubeConfigOptions
 
-	return
+// SetKubeConfigOptions sets the options used by every cluster call of this package
+func SetKubeConfigOptions(options KubeConfigOptions) {
+	kubeConfigOptions = options
 }
 
-func GetBearerToken(in *restclient.Config, explicitKubeConfigPath string, serviceAccountName string) (token string, username string, err error) {
-	if in == nil {
-		return "", serviceAccountName, errors.Errorf("RestClient can't be nil")
+// newConfigFlags returns kubectl config flags for the options, see SetKubeConfigOptions.
+// The namespace is left out, so rendered resources that do not set one still go to the namespace of the context.
+func newConfigFlags() *genericclioptions.ConfigFlags {
+	options := kubeConfigOptions
+	kubeConfigFlags := genericclioptions.NewConfigFlags(true).WithDeprecatedPasswordFlag()
+	if options.Kubeconfig != "" {
+		kubeConfigFlags.KubeConfig = &options.Kubeconfig
+	}
+	if options.Context != "" {
+		kubeConfigFlags.Context = &options.Context
+	}
+	if options.Impersonate != "" {
+		kubeConfigFlags.Impersonate = &options.Impersonate
 	}
 
-	kubeClient, err := kubernetes.NewForConfig(in)
-	if err != nil {
-		return "", serviceAccountName, errors.Errorf("Could not get kubeClient")
+	return kubeConfigFlags
+}
+
+// NewConfig returns the client configuration of the cluster, see SetKubeConfigOptions
+func NewConfig() (config *Config, err error) {
+	kubeConfigFlags := newConfigFlags()
+	if kubeConfigOptions.Namespace != "" {
+		kubeConfigFlags.Namespace = &kubeConfigOptions.Namespace
 	}
+
+	return kubeConfigFlags.ToRESTConfig()
+}
+
+// GetBearerToken returns the token of the service account, from its token secret in the namespace of onepanel.
+// The namespace can be changed with the Namespace option, see SetKubeConfigOptions.
+func GetBearerToken(client ClusterClient, serviceAccountName string) (token string, username string, err error) {
 	ns := "onepanel"
-	secrets, err := kubeClient.CoreV1().Secrets(ns).List(v1.ListOptions{})
+	if kubeConfigOptions.Namespace != "" {
+		ns = kubeConfigOptions.Namespace
+	}
+	secrets, err := client.List("v1", "Secret", ns, "")
 	if err != nil {
-		return "", serviceAccountName, errors.Errorf("Could not get %s secrets.", ns)
+		return "", serviceAccountName, errors.Wrapf(err, "Could not get %s secrets", ns)
 	}
 	search := `^` + serviceAccountName + `-token-`
 	re := regexp.MustCompile(search)
-	for _, secret := range secrets.Items {
-		if re.Find([]byte(secret.ObjectMeta.Name)) != nil {
-			return string(secret.Data["token"]), serviceAccountName, nil
+	for _, resource := range secrets {
+		if re.Find([]byte(resource.GetName())) == nil {
+			continue
 		}
+
+		secret := &corev1.Secret{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, secret); err != nil {
+			return "", serviceAccountName, err
+		}
+		return string(secret.Data["token"]), serviceAccountName, nil
 	}
 	return "", serviceAccountName, errors.Errorf("could not find a token")
 }
@@ -76,7 +121,14 @@ func ReloadKubeConfig(explicitPath string) clientcmd.ClientConfig {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	loadingRules.DefaultClientConfig = &clientcmd.DefaultClientConfig
 	loadingRules.ExplicitPath = explicitPath
-	overrides := clientcmd.ConfigOverrides{}
+	if explicitPath == "" {
+		loadingRules.ExplicitPath = kubeConfigOptions.Kubeconfig
+	}
+	overrides := clientcmd.ConfigOverrides{
+		CurrentContext: kubeConfigOptions.Context,
+		Context:        clientcmdapi.Context{Namespace: kubeConfigOptions.Namespace},
+		AuthInfo:       clientcmdapi.AuthInfo{Impersonate: kubeConfigOptions.Impersonate},
+	}
 	return clientcmd.NewInteractiveDeferredLoadingClientConfig(loadingRules, &overrides, os.Stdin)
 }
 
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: first
+  cluster:
+    server: https://first.example.com
+- name: second
+  cluster:
+    server: https://second.example.com
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: first
+  context:
+    cluster: first
+    user: admin
+- name: second
+  context:
+    cluster: second
+    user: admin
+current-context: first
+`
+
+func TestNewConfig_KubeConfigOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opctl-kubeconfig")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kubeconfig")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(testKubeconfig), 0600))
+
+	defer SetKubeConfigOptions(KubeConfigOptions{})
+
+	SetKubeConfigOptions(KubeConfigOptions{Kubeconfig: path})
+	config, err := NewConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://first.example.com", config.Host)
+	assert.Equal(t, "", config.Impersonate.UserName)
+
+	SetKubeConfigOptions(KubeConfigOptions{Kubeconfig: path, Context: "second", Impersonate: "alice"})
+	config, err = NewConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://second.example.com", config.Host)
+	assert.Equal(t, "alice", config.Impersonate.UserName)
+
+	SetKubeConfigOptions(KubeConfigOptions{Kubeconfig: path, Context: "missing"})
+	_, err = NewConfig()
+	assert.NotNil(t, err)
+}
+
+func TestGetBearerToken(t *testing.T) {
+	client, err := NewFakeClusterClient(
+		&corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "admin-token-abcde"},
+			Data:       map[string][]byte{"token": []byte("secret-token")},
+		},
+		&corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{Namespace: "other", Name: "viewer-token-abcde"},
+			Data:       map[string][]byte{"token": []byte("other-token")},
+		},
+	)
+	assert.Nil(t, err)
+
+	token, username, err := GetBearerToken(client, "admin")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-token", token)
+	assert.Equal(t, "admin", username)
+
+	_, _, err = GetBearerToken(client, "viewer")
+	assert.NotNil(t, err)
+
+	defer SetKubeConfigOptions(KubeConfigOptions{})
+	SetKubeConfigOptions(KubeConfigOptions{Namespace: "other"})
+	token, _, err = GetBearerToken(client, "viewer")
+	assert.Nil(t, err)
+	assert.Equal(t, "other-token", token)
+}
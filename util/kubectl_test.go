@@ -0,0 +1,40 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterIngressAddress(t *testing.T) {
+	client, err := NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	_, err = ClusterIngressAddress(client)
+	assert.NotNil(t, err)
+
+	client, err = NewFakeClusterClient(&corev1.Service{
+		ObjectMeta: v1.ObjectMeta{Namespace: "istio-system", Name: "istio-ingressgateway"},
+	})
+	assert.Nil(t, err)
+
+	address, err := ClusterIngressAddress(client)
+	assert.Nil(t, err)
+	assert.Equal(t, "", address)
+
+	for _, ingress := range []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}, {Hostname: "lb.example.com"}} {
+		client, err = NewFakeClusterClient(&corev1.Service{
+			ObjectMeta: v1.ObjectMeta{Namespace: "istio-system", Name: "istio-ingressgateway"},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{ingress}},
+			},
+		})
+		assert.Nil(t, err)
+
+		address, err = ClusterIngressAddress(client)
+		assert.Nil(t, err)
+		assert.Equal(t, ingress.IP+ingress.Hostname, address)
+	}
+}
@@ -0,0 +1,294 @@
+package util
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LockName is the name of the Lease that guards changes to the deployment
+	LockName = "opctl-lock"
+
+	// lockDuration is how long the lock is held without being renewed, e.g. after the holder crashed
+	lockDuration = time.Minute
+	// lockRenewInterval is how often the holder renews the lock
+	lockRenewInterval = 20 * time.Second
+)
+
+// LockedError is returned when another holder has the lock
+type LockedError struct {
+	Holder     string
+	AcquiredAt time.Time
+	RenewedAt  time.Time
+}
+
+// Error names the holder of the lock and how to recover if it is no longer running
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("the deployment is locked by %v since %v, last renewed %v. "+
+		"If it is no longer running, wait %v for the lock to expire or run again with --force-unlock",
+		e.Holder, e.AcquiredAt.Local().Format(time.RFC822), e.RenewedAt.Local().Format(time.RFC822), lockDuration)
+}
+
+// LockLostError is returned by DeploymentLock.Err once the lock was lost while it was held
+type LockLostError struct {
+	Err error
+}
+
+// Error says why the lock was lost
+func (e *LockLostError) Error() string {
+	return fmt.Sprintf("the deployment lock was lost, stopping so two changes do not run at once: %v", e.Err.Error())
+}
+
+func (e *LockLostError) Unwrap() error {
+	return e.Err
+}
+
+// DeploymentLock is a Lease in InventoryNamespace that only one opctl process can hold at a time.
+// The lock is renewed while it is held, so it expires soon after the holder crashes.
+type DeploymentLock struct {
+	client   kubernetes.Interface
+	identity string
+	mutex    sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	// lost is closed once lostErr is set, see Lost
+	lost    chan struct{}
+	lostErr error
+}
+
+// NewDeploymentLock creates a DeploymentLock that uses client to access the Lease. identity names the holder.
+func NewDeploymentLock(client kubernetes.Interface, identity string) *DeploymentLock {
+	return &DeploymentLock{
+		client:   client,
+		identity: identity,
+		lost:     make(chan struct{}),
+	}
+}
+
+// Lost returns a channel that is closed once the lock is lost while it is held, see Err
+func (l *DeploymentLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns a *LockLostError once the lock is lost: someone else took it over, or it could not be renewed
+// before it expired. Until then it returns nil.
+func (l *DeploymentLock) Err() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.lostErr
+}
+
+func (l *DeploymentLock) setLost(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.lostErr != nil {
+		return
+	}
+	l.lostErr = &LockLostError{Err: err}
+	close(l.lost)
+}
+
+// Acquire takes the lock and keeps renewing it until Release is called.
+// If another holder has the lock, and it has not expired, a *LockedError is returned unless force is true.
+func (l *DeploymentLock) Acquire(force bool) error {
+	if err := ensureInventoryNamespace(l.client); err != nil {
+		return err
+	}
+
+	leases := l.client.CoordinationV1().Leases(InventoryNamespace)
+	now := v1.NewMicroTime(time.Now())
+	durationSeconds := int32(lockDuration.Seconds())
+
+	lease, err := leases.Get(LockName, v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = leases.Create(&coordinationv1.Lease{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: InventoryNamespace,
+				Name:      LockName,
+				Labels: map[string]string{
+					ManagedByLabel: ManagedByValue,
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		})
+		if k8serrors.IsAlreadyExists(err) {
+			return l.Acquire(force)
+		}
+		if err != nil {
+			return err
+		}
+
+		l.startRenewing()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if lockedErr := leaseHeldByOther(lease, l.identity); lockedErr != nil && !force {
+		return lockedErr
+	}
+
+	lease.Spec.HolderIdentity = &l.identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	// The update fails with a conflict if someone else took the lock since it was read
+	if _, err := leases.Update(lease); err != nil {
+		if k8serrors.IsConflict(err) {
+			return fmt.Errorf("the lock was taken by someone else while acquiring it, try again")
+		}
+		return err
+	}
+
+	l.startRenewing()
+	return nil
+}
+
+// Release stops renewing the lock and deletes it, if it is still held by this holder
+func (l *DeploymentLock) Release() error {
+	l.mutex.Lock()
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop = nil
+	}
+	l.mutex.Unlock()
+
+	leases := l.client.CoordinationV1().Leases(InventoryNamespace)
+	lease, err := leases.Get(LockName, v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+		return nil
+	}
+
+	err = leases.Delete(LockName, &v1.DeleteOptions{
+		Preconditions: &v1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if k8serrors.IsNotFound(err) || k8serrors.IsConflict(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (l *DeploymentLock) startRenewing() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(lockRenewInterval)
+		defer ticker.Stop()
+
+		renewed := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := l.renew()
+				if err == nil {
+					renewed = time.Now()
+					continue
+				}
+
+				// A failed renewal is tried again, unless someone else has the lock or it may have expired by now
+				if _, ok := err.(*lockTakenOverError); ok || time.Since(renewed) >= lockDuration {
+					l.setLost(err)
+					return
+				}
+				log.Printf("Unable to renew the deployment lock: %v", err.Error())
+			}
+		}
+	}(l.stop, l.done)
+}
+
+func (l *DeploymentLock) renew() error {
+	leases := l.client.CoordinationV1().Leases(InventoryNamespace)
+	lease, err := leases.Get(LockName, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+		return &lockTakenOverError{holder: leaseHolder(lease)}
+	}
+
+	now := v1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(lease)
+
+	return err
+}
+
+// lockTakenOverError is returned by renew if someone else has the lock now
+type lockTakenOverError struct {
+	holder string
+}
+
+func (e *lockTakenOverError) Error() string {
+	return fmt.Sprintf("the lock was taken over by %v", e.holder)
+}
+
+// leaseHeldByOther returns a *LockedError if the lease is held by someone other than identity and has not expired
+func leaseHeldByOther(lease *coordinationv1.Lease, identity string) *LockedError {
+	holder := leaseHolder(lease)
+	if holder == "" || holder == identity {
+		return nil
+	}
+
+	renewedAt := time.Time{}
+	if lease.Spec.RenewTime != nil {
+		renewedAt = lease.Spec.RenewTime.Time
+	}
+	duration := lockDuration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	if time.Now().After(renewedAt.Add(duration)) {
+		return nil
+	}
+
+	acquiredAt := renewedAt
+	if lease.Spec.AcquireTime != nil {
+		acquiredAt = lease.Spec.AcquireTime.Time
+	}
+
+	return &LockedError{
+		Holder:     holder,
+		AcquiredAt: acquiredAt,
+		RenewedAt:  renewedAt,
+	}
+}
+
+func leaseHolder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+
+	return *lease.Spec.HolderIdentity
+}
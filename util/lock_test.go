@@ -0,0 +1,58 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDeploymentLock(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	first := NewDeploymentLock(client, "alice@laptop")
+	assert.Nil(t, first.Acquire(false))
+
+	second := NewDeploymentLock(client, "bob@ci")
+	err := second.Acquire(false)
+	lockedErr, ok := err.(*LockedError)
+	assert.True(t, ok)
+	assert.Equal(t, "alice@laptop", lockedErr.Holder)
+	assert.Contains(t, err.Error(), "--force-unlock")
+
+	assert.Nil(t, second.Acquire(true))
+
+	// The first holder lost the lock, so releasing it leaves the lock alone
+	assert.Nil(t, first.Release())
+	lease, err := client.CoordinationV1().Leases(InventoryNamespace).Get(LockName, v1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "bob@ci", *lease.Spec.HolderIdentity)
+
+	assert.Nil(t, second.Release())
+	_, err = client.CoordinationV1().Leases(InventoryNamespace).Get(LockName, v1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+}
+
+func TestDeploymentLock_Expired(t *testing.T) {
+	holder := "alice@laptop"
+	durationSeconds := int32(60)
+	renewTime := v1.NewMicroTime(time.Now().Add(-2 * time.Minute))
+
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: v1.ObjectMeta{Namespace: InventoryNamespace, Name: LockName},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &durationSeconds,
+			AcquireTime:          &renewTime,
+			RenewTime:            &renewTime,
+		},
+	})
+
+	lock := NewDeploymentLock(client, "bob@ci")
+	assert.Nil(t, lock.Acquire(false))
+	assert.Nil(t, lock.Release())
+}
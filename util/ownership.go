@@ -0,0 +1,45 @@
+package util
+
+import "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+const (
+	// ManagedByLabel marks the resources opctl manages
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByLabel for resources opctl manages
+	ManagedByValue = "opctl"
+	// DeploymentLabel is the deployment a managed resource belongs to, the default namespace of the deployment
+	DeploymentLabel = "opctl.onepanel.io/deployment"
+)
+
+// SetOwnershipLabels marks each resource as managed by opctl for deployment
+func SetOwnershipLabels(resources []*unstructured.Unstructured, deployment string) {
+	for _, resource := range resources {
+		labels := resource.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+
+		labels[ManagedByLabel] = ManagedByValue
+		labels[DeploymentLabel] = deployment
+		resource.SetLabels(labels)
+	}
+}
+
+// IsOwnedBy returns true if the resource is managed by opctl for deployment
+func IsOwnedBy(resource *unstructured.Unstructured, deployment string) bool {
+	labels := resource.GetLabels()
+
+	return labels[ManagedByLabel] == ManagedByValue && labels[DeploymentLabel] == deployment
+}
+
+// LabelRenderedResources sets the ownership labels of deployment on every resource in the rendered yaml
+func LabelRenderedResources(content, deployment string) (string, error) {
+	resources, err := ParseResources(content)
+	if err != nil {
+		return "", err
+	}
+
+	SetOwnershipLabels(resources, deployment)
+
+	return ResourcesToYaml(resources)
+}
@@ -0,0 +1,334 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ParamsPassphraseEnv is the environment variable with the passphrase params are encrypted with.
+	// If it is not set, the key file is used.
+	ParamsPassphraseEnv = "OPCTL_PARAMS_PASSPHRASE"
+	// ParamsKeyFileEnv is the environment variable with the path of the key file, see DefaultParamsKeyFile
+	ParamsKeyFileEnv = "OPCTL_PARAMS_KEY_FILE"
+
+	// encryptedValuePrefix starts every encrypted value, e.g.
+	// ENC[xchacha20poly1305,kdf:scrypt,salt:...,nonce:...,data:...]
+	encryptedValuePrefix = "ENC["
+	encryptedValueCipher = "xchacha20poly1305"
+	kdfScrypt            = "scrypt"
+	kdfNone              = "none"
+
+	// scrypt parameters recommended for interactive logins, as of 2017
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptSalt   = 16
+	paramsKeyLen = chacha20poly1305.KeySize
+)
+
+// DefaultParamsKeyFile is the key file used if neither ParamsPassphraseEnv nor ParamsKeyFileEnv is set.
+// Keep it out of git, unlike params.yaml.
+var DefaultParamsKeyFile = filepath.Join(".onepanel", "params.key")
+
+// ErrNoParamsKey is returned when params have to be encrypted or decrypted, but there is no passphrase or key file
+var ErrNoParamsKey = errors.New("there is no passphrase or key file for the encrypted params")
+
+// ParamsKey encrypts and decrypts the values of params. Values are bound to their key, so they can not be moved to another key.
+type ParamsKey struct {
+	// key is set if the key comes from a key file
+	key []byte
+	// passphrase is set otherwise, keys are derived from it with scrypt
+	passphrase []byte
+	// salt is used for every value this ParamsKey encrypts, so scrypt only runs once
+	salt []byte
+	// derived are the keys derived from passphrase, by salt
+	derived map[string][]byte
+}
+
+// NewParamsKey creates a ParamsKey from the content of a key file, a base64 encoded key of 32 bytes
+func NewParamsKey(content string) (*ParamsKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+	if err != nil {
+		return nil, fmt.Errorf("the params key is not base64 encoded: %w", err)
+	}
+	if len(key) != paramsKeyLen {
+		return nil, fmt.Errorf("the params key has %v bytes instead of %v", len(key), paramsKeyLen)
+	}
+
+	return &ParamsKey{key: key}, nil
+}
+
+// NewParamsPassphraseKey creates a ParamsKey that derives its keys from passphrase
+func NewParamsPassphraseKey(passphrase string) *ParamsKey {
+	return &ParamsKey{
+		passphrase: []byte(passphrase),
+		derived:    make(map[string][]byte),
+	}
+}
+
+// LoadParamsKey returns the ParamsKey from ParamsPassphraseEnv, or the key file.
+// If there is neither, ErrNoParamsKey is returned.
+func LoadParamsKey() (*ParamsKey, error) {
+	if passphrase := os.Getenv(ParamsPassphraseEnv); passphrase != "" {
+		return NewParamsPassphraseKey(passphrase), nil
+	}
+
+	content, err := ioutil.ReadFile(ParamsKeyFilePath())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w, set %v or create the key file %v with 'opctl params encrypt'", ErrNoParamsKey, ParamsPassphraseEnv, ParamsKeyFilePath())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewParamsKey(string(content))
+}
+
+// ParamsKeyFilePath returns the path of the key file, ParamsKeyFileEnv or DefaultParamsKeyFile
+func ParamsKeyFilePath() string {
+	if filePath := os.Getenv(ParamsKeyFileEnv); filePath != "" {
+		return filePath
+	}
+
+	return DefaultParamsKeyFile
+}
+
+// GenerateParamsKeyFile writes a new random key to filePath, only readable by the current user.
+// An existing file is not replaced, values encrypted with it could not be decrypted anymore.
+func GenerateParamsKeyFile(filePath string) error {
+	key := make([]byte, paramsKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+
+	return err
+}
+
+// IsEncryptedValue returns true if value was encrypted by a ParamsKey
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, encryptedValuePrefix) && strings.HasSuffix(value, "]")
+}
+
+// Encrypt encrypts the value of the flattened params key name, e.g. database.password
+func (k *ParamsKey) Encrypt(name, value string) (string, error) {
+	kdf := kdfNone
+	key := k.key
+	if key == nil {
+		kdf = kdfScrypt
+		if k.salt == nil {
+			k.salt = make([]byte, scryptSalt)
+			if _, err := rand.Read(k.salt); err != nil {
+				return "", err
+			}
+		}
+
+		var err error
+		if key, err = k.derive(k.salt); err != nil {
+			return "", err
+		}
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := aead.Seal(nil, nonce, []byte(value), []byte(name))
+
+	fields := []string{encryptedValueCipher, "kdf:" + kdf}
+	if kdf == kdfScrypt {
+		fields = append(fields, "salt:"+base64.StdEncoding.EncodeToString(k.salt))
+	}
+	fields = append(fields,
+		"nonce:"+base64.StdEncoding.EncodeToString(nonce),
+		"data:"+base64.StdEncoding.EncodeToString(data),
+	)
+
+	return encryptedValuePrefix + strings.Join(fields, ",") + "]", nil
+}
+
+// Decrypt decrypts the encrypted value of the flattened params key name
+func (k *ParamsKey) Decrypt(name, value string) (string, error) {
+	if !IsEncryptedValue(value) {
+		return "", fmt.Errorf("%v is not encrypted", name)
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, encryptedValuePrefix), "]"), ",")
+	if parts[0] != encryptedValueCipher {
+		return "", fmt.Errorf("%v is encrypted with the unsupported cipher '%v'", name, parts[0])
+	}
+	fields := make(map[string]string)
+	for _, part := range parts[1:] {
+		keyValue := strings.SplitN(part, ":", 2)
+		if len(keyValue) != 2 {
+			return "", fmt.Errorf("%v has an invalid encrypted value", name)
+		}
+		fields[keyValue[0]] = keyValue[1]
+	}
+
+	decoded := make(map[string][]byte)
+	for _, field := range []string{"salt", "nonce", "data"} {
+		if _, ok := fields[field]; !ok {
+			continue
+		}
+		content, err := base64.StdEncoding.DecodeString(fields[field])
+		if err != nil {
+			return "", fmt.Errorf("%v has an invalid encrypted value: %w", name, err)
+		}
+		decoded[field] = content
+	}
+
+	key := k.key
+	switch fields["kdf"] {
+	case kdfNone:
+		if key == nil {
+			return "", fmt.Errorf("%v was encrypted with a key file, not a passphrase", name)
+		}
+	case kdfScrypt:
+		if k.passphrase == nil {
+			return "", fmt.Errorf("%v was encrypted with a passphrase, not a key file", name)
+		}
+		var err error
+		if key, err = k.derive(decoded["salt"]); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("%v is encrypted with the unsupported key derivation '%v'", name, fields["kdf"])
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+	if len(decoded["nonce"]) != aead.NonceSize() {
+		return "", fmt.Errorf("%v has an invalid encrypted value", name)
+	}
+	plaintext, err := aead.Open(nil, decoded["nonce"], decoded["data"], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt %v, the key or passphrase is wrong or the value was changed", name)
+	}
+
+	return string(plaintext), nil
+}
+
+func (k *ParamsKey) derive(salt []byte) ([]byte, error) {
+	if len(salt) == 0 {
+		return nil, errors.New("the encrypted value has no salt")
+	}
+	if key, ok := k.derived[string(salt)]; ok {
+		return key, nil
+	}
+
+	key, err := scrypt.Key(k.passphrase, salt, scryptN, scryptR, scryptP, paramsKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	k.derived[string(salt)] = key
+
+	return key, nil
+}
+
+// EncryptParams encrypts the values of the flattened keys in place. If no keys are given, every secret param is
+// encrypted, see IsSecretParamKey. Empty and already encrypted values are skipped, as are references to environment
+// variables and files, see ResolveParamReferences. The encrypted keys are returned, sorted.
+func EncryptParams(yamlFile *DynamicYaml, key *ParamsKey, keys ...string) ([]string, error) {
+	flatMap := yamlFile.Flatten(AppendDotFlatMapKeyFormatter)
+	if len(keys) == 0 {
+		for name := range flatMap {
+			if IsSecretParamKey(name) {
+				keys = append(keys, name)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	encrypted := make([]string, 0)
+	for _, name := range keys {
+		pair, ok := flatMap[name]
+		if !ok {
+			return nil, fmt.Errorf("%v is not a value in params.yaml", name)
+		}
+		if pair.Value.Value == "" || IsEncryptedValue(pair.Value.Value) || HasParamReference(pair.Value.Value) {
+			continue
+		}
+
+		value, err := key.Encrypt(name, pair.Value.Value)
+		if err != nil {
+			return nil, err
+		}
+		setStringValue(pair.Value, value)
+		encrypted = append(encrypted, name)
+	}
+
+	return encrypted, nil
+}
+
+// DecryptParams decrypts every encrypted value in place. The decrypted keys are returned, sorted.
+// They are redacted by RedactSecretParams like secret params.
+func DecryptParams(yamlFile *DynamicYaml, key *ParamsKey) ([]string, error) {
+	decrypted := make([]string, 0)
+	for name, pair := range yamlFile.Flatten(AppendDotFlatMapKeyFormatter) {
+		if !IsEncryptedValue(pair.Value.Value) {
+			continue
+		}
+
+		value, err := key.Decrypt(name, pair.Value.Value)
+		if err != nil {
+			return nil, err
+		}
+		setStringValue(pair.Value, value)
+		decrypted = append(decrypted, name)
+
+		if yamlFile.decryptedKeys == nil {
+			yamlFile.decryptedKeys = make(map[string]bool)
+		}
+		yamlFile.decryptedKeys[name] = true
+	}
+	sort.Strings(decrypted)
+
+	return decrypted, nil
+}
+
+// HasEncryptedParams returns true if any value of the params is encrypted
+func HasEncryptedParams(yamlFile *DynamicYaml) bool {
+	for _, pair := range yamlFile.Flatten(AppendDotFlatMapKeyFormatter) {
+		if IsEncryptedValue(pair.Value.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setStringValue replaces the value of a scalar node with a string, the style is picked when it is written
+func setStringValue(node *yaml.Node, value string) {
+	node.Value = value
+	node.Tag = "!!str"
+	node.Style = 0
+}
@@ -0,0 +1,152 @@
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testEncryptedParams = `application:
+  defaultNamespace: example
+database:
+  # the password of the onepanel database
+  password: hunter2
+artifactRepository:
+  s3:
+    accessKey: AKIA
+    secretKey: ""
+    bucket: example
+`
+
+func TestEncryptParams(t *testing.T) {
+	for _, key := range []*ParamsKey{testParamsKey(t), NewParamsPassphraseKey("correct horse battery staple")} {
+		yamlFile, err := LoadDynamicYamlFromString(testEncryptedParams)
+		assert.Nil(t, err)
+
+		encrypted, err := EncryptParams(yamlFile, key)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"artifactRepository.s3.accessKey", "database.password"}, encrypted)
+		assert.True(t, IsEncryptedValue(yamlFile.GetValue("database.password").Value))
+		assert.Equal(t, "", yamlFile.GetValue("artifactRepository.s3.secretKey").Value)
+		assert.Equal(t, "example", yamlFile.GetValue("artifactRepository.s3.bucket").Value)
+
+		content, err := yamlFile.String()
+		assert.Nil(t, err)
+		assert.NotContains(t, content, "hunter2")
+		assert.Contains(t, content, "# the password of the onepanel database")
+
+		// Encrypting again skips the encrypted values
+		encrypted, err = EncryptParams(yamlFile, key)
+		assert.Nil(t, err)
+		assert.Empty(t, encrypted)
+
+		reloaded, err := LoadDynamicYamlFromString(content)
+		assert.Nil(t, err)
+		decrypted, err := DecryptParams(reloaded, key)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"artifactRepository.s3.accessKey", "database.password"}, decrypted)
+		assert.Equal(t, "hunter2", reloaded.GetValue("database.password").Value)
+		assert.Equal(t, "AKIA", reloaded.GetValue("artifactRepository.s3.accessKey").Value)
+	}
+}
+
+func TestEncryptParams_Keys(t *testing.T) {
+	yamlFile, err := LoadDynamicYamlFromString(testEncryptedParams)
+	assert.Nil(t, err)
+	key := testParamsKey(t)
+
+	encrypted, err := EncryptParams(yamlFile, key, "artifactRepository.s3.bucket")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"artifactRepository.s3.bucket"}, encrypted)
+	assert.Equal(t, "hunter2", yamlFile.GetValue("database.password").Value)
+
+	_, err = EncryptParams(yamlFile, key, "database.host")
+	assert.NotNil(t, err)
+
+	// Decrypted values are redacted, even if their key is not a secret param
+	_, err = DecryptParams(yamlFile, key)
+	assert.Nil(t, err)
+	redacted, err := RedactSecretParams(yamlFile)
+	assert.Nil(t, err)
+	assert.Equal(t, RedactedValue, redacted.GetValue("artifactRepository.s3.bucket").Value)
+}
+
+func TestParamsKey_Decrypt(t *testing.T) {
+	key := testParamsKey(t)
+	value, err := key.Encrypt("database.password", "hunter2")
+	assert.Nil(t, err)
+
+	// The value is bound to its key
+	_, err = key.Decrypt("database.user", value)
+	assert.NotNil(t, err)
+
+	_, err = testParamsKey(t).Decrypt("database.password", value)
+	assert.NotNil(t, err)
+
+	_, err = NewParamsPassphraseKey("passphrase").Decrypt("database.password", value)
+	assert.NotNil(t, err)
+
+	tampered := strings.Replace(value, "data:", "data:AA", 1)
+	_, err = key.Decrypt("database.password", tampered)
+	assert.NotNil(t, err)
+}
+
+func TestLoadParamsFromFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "params")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	keyFilePath := filepath.Join(directory, "params.key")
+	paramsPath := filepath.Join(directory, "params.yaml")
+	defer os.Unsetenv(ParamsKeyFileEnv)
+	assert.Nil(t, os.Setenv(ParamsKeyFileEnv, keyFilePath))
+
+	_, err = LoadParamsKey()
+	assert.True(t, errors.Is(err, ErrNoParamsKey))
+
+	assert.Nil(t, GenerateParamsKeyFile(keyFilePath))
+	assert.NotNil(t, GenerateParamsKeyFile(keyFilePath))
+	info, err := os.Stat(keyFilePath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	key, err := LoadParamsKey()
+	assert.Nil(t, err)
+	yamlFile, err := LoadDynamicYamlFromString(testEncryptedParams)
+	assert.Nil(t, err)
+	_, err = EncryptParams(yamlFile, key)
+	assert.Nil(t, err)
+	content, err := yamlFile.String()
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(paramsPath, []byte(content), 0644))
+
+	params, err := LoadParamsFromFile(paramsPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "hunter2", params.GetValue("database.password").Value)
+
+	// The file keeps the encrypted values
+	onDisk, err := ioutil.ReadFile(paramsPath)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(onDisk))
+}
+
+func testParamsKey(t *testing.T) *ParamsKey {
+	directory, err := ioutil.TempDir("", "params")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	keyFilePath := filepath.Join(directory, "params.key")
+	assert.Nil(t, GenerateParamsKeyFile(keyFilePath))
+	content, err := ioutil.ReadFile(keyFilePath)
+	assert.Nil(t, err)
+
+	key, err := NewParamsKey(string(content))
+	assert.Nil(t, err)
+
+	return key
+}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// paramReferenceRegex matches references to external values in params, ${env:NAME} or ${file:path}
+var paramReferenceRegex = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+
+// UnresolvedParamsError is returned when references in params can not be resolved
+type UnresolvedParamsError struct {
+	// Problems has a description of each reference that can not be resolved, by param key
+	Problems map[string]string
+}
+
+func (e *UnresolvedParamsError) Error() string {
+	keys := make([]string, 0, len(e.Problems))
+	for key := range e.Problems {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%v: %v", key, e.Problems[key]))
+	}
+
+	return "unable to resolve the references in params.yaml\n" + strings.Join(lines, "\n")
+}
+
+// HasParamReference returns true if value references an environment variable or a file
+func HasParamReference(value string) bool {
+	return paramReferenceRegex.MatchString(value)
+}
+
+// ResolveParamReferences replaces ${env:NAME} with the value of the environment variable NAME and ${file:path}
+// with the content of the file in place, trailing newlines are removed. References can be part of a longer value.
+// Relative paths are relative to directory, the directory of params.yaml.
+// The resolved keys are returned, sorted. If any reference can not be resolved, an *UnresolvedParamsError is returned.
+func ResolveParamReferences(yamlFile *DynamicYaml, directory string) ([]string, error) {
+	problems := make(map[string]string)
+	resolved := make([]string, 0)
+
+	for key, pair := range yamlFile.Flatten(AppendDotFlatMapKeyFormatter) {
+		original := pair.Value.Value
+		if !HasParamReference(original) {
+			continue
+		}
+
+		value := paramReferenceRegex.ReplaceAllStringFunc(original, func(reference string) string {
+			match := paramReferenceRegex.FindStringSubmatch(reference)
+			source, name := match[1], strings.TrimSpace(match[2])
+			if name == "" {
+				problems[key] = fmt.Sprintf("%v has no %v name", reference, source)
+				return reference
+			}
+
+			if source == "env" {
+				value, ok := os.LookupEnv(name)
+				if !ok {
+					problems[key] = fmt.Sprintf("environment variable %v is not set", name)
+				}
+				return value
+			}
+
+			filePath := name
+			if !filepath.IsAbs(filePath) {
+				filePath = filepath.Join(directory, filePath)
+			}
+			content, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				problems[key] = fmt.Sprintf("unable to read file %v: %v", name, err.Error())
+				return reference
+			}
+			return strings.TrimRight(string(content), "\r\n")
+		})
+		if _, ok := problems[key]; ok {
+			continue
+		}
+
+		setStringValue(pair.Value, value)
+		resolved = append(resolved, key)
+
+		if yamlFile.references == nil {
+			yamlFile.references = make(map[string]string)
+		}
+		yamlFile.references[key] = original
+	}
+
+	if len(problems) != 0 {
+		return nil, &UnresolvedParamsError{Problems: problems}
+	}
+	sort.Strings(resolved)
+
+	return resolved, nil
+}
+
+// LoadParamsFromFile loads params like LoadDynamicYamlFromFile, then decrypts their encrypted values with the key from
+// LoadParamsKey and resolves their references, see ResolveParamReferences. This happens in memory, the file is not changed.
+func LoadParamsFromFile(filePath string) (*DynamicYaml, error) {
+	yamlFile, err := LoadDynamicYamlFromFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if HasEncryptedParams(yamlFile) {
+		key, err := LoadParamsKey()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := DecryptParams(yamlFile, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := ResolveParamReferences(yamlFile, filepath.Dir(filePath)); err != nil {
+		return nil, err
+	}
+
+	return yamlFile, nil
+}
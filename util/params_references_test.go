@@ -0,0 +1,102 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testReferencedParams = `application:
+  defaultNamespace: example
+  fqdn: ${env:OPCTL_TEST_DOMAIN}
+  url: https://app.${env:OPCTL_TEST_DOMAIN}
+artifactRepository:
+  s3:
+    accessKey: ${env:OPCTL_TEST_ACCESS_KEY}
+  gcs:
+    serviceAccountKey: ${file:gcs-key.json}
+`
+
+func TestResolveParamReferences(t *testing.T) {
+	directory, err := ioutil.TempDir("", "params")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(directory, "gcs-key.json"), []byte("{\"type\": \"service_account\"}\n"), 0600))
+
+	defer os.Unsetenv("OPCTL_TEST_DOMAIN")
+	defer os.Unsetenv("OPCTL_TEST_ACCESS_KEY")
+	assert.Nil(t, os.Setenv("OPCTL_TEST_DOMAIN", "example.com"))
+	assert.Nil(t, os.Setenv("OPCTL_TEST_ACCESS_KEY", "AKIA"))
+
+	yamlFile, err := LoadDynamicYamlFromString(testReferencedParams)
+	assert.Nil(t, err)
+
+	resolved, err := ResolveParamReferences(yamlFile, directory)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"application.fqdn", "application.url", "artifactRepository.gcs.serviceAccountKey", "artifactRepository.s3.accessKey"}, resolved)
+	assert.Equal(t, "example.com", yamlFile.GetValue("application.fqdn").Value)
+	assert.Equal(t, "https://app.example.com", yamlFile.GetValue("application.url").Value)
+	assert.Equal(t, "AKIA", yamlFile.GetValue("artifactRepository.s3.accessKey").Value)
+	assert.Equal(t, `{"type": "service_account"}`, yamlFile.GetValue("artifactRepository.gcs.serviceAccountKey").Value)
+
+	// Shared params keep the references, secrets are redacted
+	redacted, err := RedactSecretParamsForSharing(yamlFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "${env:OPCTL_TEST_DOMAIN}", redacted.GetValue("application.fqdn").Value)
+	assert.Equal(t, RedactedValue, redacted.GetValue("artifactRepository.s3.accessKey").Value)
+
+	// Stored params keep the resolved values
+	redacted, err = RedactSecretParams(yamlFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", redacted.GetValue("application.fqdn").Value)
+	assert.Equal(t, RedactedValue, redacted.GetValue("artifactRepository.s3.accessKey").Value)
+}
+
+func TestResolveParamReferences_Unresolved(t *testing.T) {
+	os.Unsetenv("OPCTL_TEST_DOMAIN")
+	os.Unsetenv("OPCTL_TEST_ACCESS_KEY")
+
+	yamlFile, err := LoadDynamicYamlFromString(testReferencedParams)
+	assert.Nil(t, err)
+
+	_, err = ResolveParamReferences(yamlFile, os.TempDir())
+	assert.IsType(t, &UnresolvedParamsError{}, err)
+	problems := err.(*UnresolvedParamsError).Problems
+	assert.Len(t, problems, 4)
+	assert.Equal(t, "environment variable OPCTL_TEST_ACCESS_KEY is not set", problems["artifactRepository.s3.accessKey"])
+	assert.Contains(t, err.Error(), "application.fqdn: environment variable OPCTL_TEST_DOMAIN is not set")
+	assert.Contains(t, problems["artifactRepository.gcs.serviceAccountKey"], "unable to read file gcs-key.json")
+
+	// Nothing is resolved if anything can not be
+	assert.Equal(t, "${env:OPCTL_TEST_DOMAIN}", yamlFile.GetValue("application.fqdn").Value)
+}
+
+func TestLoadParamsFromFile_KeepsReferences(t *testing.T) {
+	directory, err := ioutil.TempDir("", "params")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	paramsPath := filepath.Join(directory, "params.yaml")
+	assert.Nil(t, ioutil.WriteFile(paramsPath, []byte(testReferencedParams), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(directory, "gcs-key.json"), []byte("{}"), 0600))
+	defer os.Unsetenv("OPCTL_TEST_DOMAIN")
+	defer os.Unsetenv("OPCTL_TEST_ACCESS_KEY")
+	assert.Nil(t, os.Setenv("OPCTL_TEST_DOMAIN", "example.com"))
+	assert.Nil(t, os.Setenv("OPCTL_TEST_ACCESS_KEY", "AKIA"))
+
+	params, err := LoadParamsFromFile(paramsPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", params.GetValue("artifactRepository.gcs.serviceAccountKey").Value)
+
+	// init merges the defaults of the manifests into the unresolved params, the references are kept
+	raw, err := LoadDynamicYamlFromFile(paramsPath)
+	assert.Nil(t, err)
+	defaults, err := LoadDynamicYamlFromString("application:\n  fqdn: default.example.com\n  insecure: true\n")
+	assert.Nil(t, err)
+	raw.Merge(defaults)
+	assert.Equal(t, "${env:OPCTL_TEST_DOMAIN}", raw.GetValue("application.fqdn").Value)
+	assert.Equal(t, "true", raw.GetValue("application.insecure").Value)
+}
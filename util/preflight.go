@@ -0,0 +1,519 @@
+package util
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+)
+
+// CheckStatus is the outcome of a check of the cluster, see PreflightChecker and Doctor
+type CheckStatus string
+
+const (
+	// CheckPass means this part of the deployment is, or can be, working
+	CheckPass CheckStatus = "pass"
+	// CheckWarn means part of the deployment may not work
+	CheckWarn CheckStatus = "warn"
+	// CheckFail means part of the deployment does not, or will not, work
+	CheckFail CheckStatus = "fail"
+)
+
+const (
+	// MinKubernetesVersion is the oldest kubernetes version onepanel runs on
+	MinKubernetesVersion = "1.15.0"
+	// MaxKubernetesVersion is the newest kubernetes minor version onepanel is tested on
+	MaxKubernetesVersion = "1.18.0"
+
+	defaultStorageClassAnnotation     = "storageclass.kubernetes.io/is-default-class"
+	betaDefaultStorageClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+// preflightCRDGroups are the CustomResourceDefinition groups of the tools onepanel installs, by tool.
+// Another install of one of these tools conflicts with the one of the deployment.
+var preflightCRDGroups = map[string][]string{
+	"Istio":        {"istio.io"},
+	"cert-manager": {"cert-manager.io", "certmanager.k8s.io"},
+	"Argo":         {"argoproj.io"},
+}
+
+// PreflightResult is the outcome of a single preflight check
+type PreflightResult struct {
+	Check   string      `json:"check"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+}
+
+// PreflightOptions describe the deployment the cluster is checked for
+type PreflightOptions struct {
+	// Deployment is the name of the deployment, see IsOwnedBy
+	Deployment string
+	// CloudProvider is true if the cluster runs on a cloud provider that provides LoadBalancers, e.g. gke
+	CloudProvider bool
+	// Components are the rendered resources of each component that will be applied, by component name, e.g. common/onepanel
+	Components map[string][]*unstructured.Unstructured
+}
+
+// PreflightChecker checks if a cluster can run a deployment before it is applied
+type PreflightChecker struct {
+	client ClusterClient
+}
+
+// NewPreflightChecker creates a PreflightChecker that inspects the cluster with client
+func NewPreflightChecker(client ClusterClient) *PreflightChecker {
+	return &PreflightChecker{client: client}
+}
+
+// Run runs every check, in order. An error is returned if the cluster could not be inspected.
+func (p *PreflightChecker) Run(options PreflightOptions) ([]PreflightResult, error) {
+	checks := []func(PreflightOptions) (PreflightResult, error){
+		p.checkKubernetesVersion,
+		p.checkDefaultStorageClass,
+		p.checkAllocatableResources,
+		p.checkGPUNodeLabels,
+		p.checkLoadBalancer,
+		p.checkConflictingInstalls,
+	}
+
+	results := make([]PreflightResult, 0)
+	for _, check := range checks {
+		result, err := check(options)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", result.Check, err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// PreflightFailed returns true if any of the results failed
+func PreflightFailed(results []PreflightResult) bool {
+	for _, result := range results {
+		if result.Status == CheckFail {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *PreflightChecker) checkKubernetesVersion(options PreflightOptions) (PreflightResult, error) {
+	result := PreflightResult{Check: "Kubernetes version"}
+
+	info, err := p.client.ServerVersion()
+	if err != nil {
+		return result, err
+	}
+
+	serverVersion, err := utilversion.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return result, err
+	}
+
+	minVersion := utilversion.MustParseGeneric(MinKubernetesVersion)
+	maxVersion := utilversion.MustParseGeneric(MaxKubernetesVersion)
+	// Every patch release of the newest tested minor version is supported
+	untestedVersion := maxVersion.WithMinor(maxVersion.Minor() + 1).WithPatch(0)
+	switch {
+	case serverVersion.LessThan(minVersion):
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%v is not supported, the oldest supported version is %v", info.GitVersion, MinKubernetesVersion)
+	case serverVersion.AtLeast(untestedVersion):
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("%v is newer than %v.%v, the newest tested version", info.GitVersion, maxVersion.Major(), maxVersion.Minor())
+	default:
+		result.Status = CheckPass
+		result.Message = info.GitVersion
+	}
+
+	return result, nil
+}
+
+func (p *PreflightChecker) checkDefaultStorageClass(options PreflightOptions) (PreflightResult, error) {
+	result := PreflightResult{Check: "Default StorageClass"}
+
+	for _, resources := range options.Components {
+		for _, resource := range resources {
+			if resource.GetKind() == "StorageClass" && isDefaultStorageClass(resource) {
+				result.Status = CheckPass
+				result.Message = fmt.Sprintf("%v is part of the deployment", resource.GetName())
+				return result, nil
+			}
+		}
+	}
+
+	storageClasses, err := p.client.List("storage.k8s.io/v1", "StorageClass", "", "")
+	if err != nil {
+		return result, err
+	}
+
+	defaults := make([]string, 0)
+	for _, storageClass := range storageClasses {
+		if isDefaultStorageClass(storageClass) {
+			defaults = append(defaults, storageClass.GetName())
+		}
+	}
+
+	switch len(defaults) {
+	case 0:
+		result.Status = CheckFail
+		result.Message = "there is no default StorageClass, volumes of the deployment will not be provisioned"
+	case 1:
+		result.Status = CheckPass
+		result.Message = defaults[0]
+	default:
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("there are %v default StorageClasses: %v. Kubernetes will refuse volumes that do not set one",
+			len(defaults), strings.Join(defaults, ", "))
+	}
+
+	return result, nil
+}
+
+func isDefaultStorageClass(storageClass *unstructured.Unstructured) bool {
+	annotations := storageClass.GetAnnotations()
+
+	return annotations[defaultStorageClassAnnotation] == "true" || annotations[betaDefaultStorageClassAnnotation] == "true"
+}
+
+func (p *PreflightChecker) checkAllocatableResources(options PreflightOptions) (PreflightResult, error) {
+	result := PreflightResult{Check: "CPU and memory"}
+
+	requestedCPU, requestedMemory, err := requestedResources(options.Components)
+	if err != nil {
+		return result, err
+	}
+
+	nodes, err := p.listNodes()
+	if err != nil {
+		return result, err
+	}
+
+	allocatableCPU := resource.Quantity{}
+	allocatableMemory := resource.Quantity{}
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		allocatableCPU.Add(*node.Status.Allocatable.Cpu())
+		allocatableMemory.Add(*node.Status.Allocatable.Memory())
+	}
+
+	result.Message = fmt.Sprintf("the deployment requests %v CPU and %v memory, the nodes have %v CPU and %v memory allocatable",
+		requestedCPU.String(), requestedMemory.String(), allocatableCPU.String(), allocatableMemory.String())
+	result.Status = CheckPass
+	if requestedCPU.Cmp(allocatableCPU) > 0 || requestedMemory.Cmp(allocatableMemory) > 0 {
+		result.Status = CheckFail
+	}
+
+	return result, nil
+}
+
+// requestedResources adds up the CPU and memory the containers of every workload request, for each replica
+func requestedResources(components map[string][]*unstructured.Unstructured) (cpu, memory resource.Quantity, err error) {
+	for _, resources := range components {
+		for _, resource := range resources {
+			podSpec, replicas, err := workloadPodSpec(resource)
+			if err != nil {
+				return cpu, memory, err
+			}
+			if podSpec == nil {
+				continue
+			}
+
+			for _, container := range podSpec.Containers {
+				for i := int32(0); i < replicas; i++ {
+					cpu.Add(*container.Resources.Requests.Cpu())
+					memory.Add(*container.Resources.Requests.Memory())
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// workloadPodSpec returns the pod template of a Deployment, StatefulSet or DaemonSet and how many replicas it has.
+// DaemonSets count as a single replica. nil is returned for other kinds.
+func workloadPodSpec(resource *unstructured.Unstructured) (*corev1.PodSpec, int32, error) {
+	group := resource.GroupVersionKind().Group
+	if group != "apps" && group != "extensions" {
+		return nil, 0, nil
+	}
+
+	switch resource.GetKind() {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, deployment); err != nil {
+			return nil, 0, err
+		}
+		return &deployment.Spec.Template.Spec, replicasOrDefault(deployment.Spec.Replicas), nil
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, statefulSet); err != nil {
+			return nil, 0, err
+		}
+		return &statefulSet.Spec.Template.Spec, replicasOrDefault(statefulSet.Spec.Replicas), nil
+	case "DaemonSet":
+		daemonSet := &appsv1.DaemonSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, daemonSet); err != nil {
+			return nil, 0, err
+		}
+		return &daemonSet.Spec.Template.Spec, 1, nil
+	}
+
+	return nil, 0, nil
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+
+	return *replicas
+}
+
+func (p *PreflightChecker) checkGPUNodeLabels(options PreflightOptions) (PreflightResult, error) {
+	result := PreflightResult{Check: "GPU node labels", Status: CheckPass}
+
+	daemonSets := make([]*unstructured.Unstructured, 0)
+	for component, resources := range options.Components {
+		if path.Base(component) != "gpu-plugins" {
+			continue
+		}
+		for _, resource := range resources {
+			if resource.GetKind() == "DaemonSet" {
+				daemonSets = append(daemonSets, resource)
+			}
+		}
+	}
+	if len(daemonSets) == 0 {
+		result.Message = "no GPU device plugins are part of the deployment"
+		return result, nil
+	}
+
+	nodes, err := p.listNodes()
+	if err != nil {
+		return result, err
+	}
+
+	missing := make([]string, 0)
+	for _, daemonSet := range daemonSets {
+		podSpec, _, err := workloadPodSpec(daemonSet)
+		if err != nil {
+			return result, err
+		}
+
+		selectors, err := nodeSelectors(podSpec)
+		if err != nil {
+			return result, err
+		}
+
+		if !anyNodeMatches(nodes, selectors) {
+			descriptions := make([]string, 0)
+			for _, selector := range selectors {
+				descriptions = append(descriptions, selector.String())
+			}
+			missing = append(missing, fmt.Sprintf("%v expects %v", daemonSet.GetName(), strings.Join(descriptions, " or ")))
+		}
+	}
+
+	if len(missing) != 0 {
+		result.Status = CheckWarn
+		result.Message = "no node has the labels the GPU device plugins expect, label your GPU nodes: " + strings.Join(missing, "; ")
+		return result, nil
+	}
+
+	result.Message = fmt.Sprintf("%v GPU device plugins can be scheduled", len(daemonSets))
+
+	return result, nil
+}
+
+// nodeSelectors returns the selectors of the nodes the pod can be scheduled on. A node has to match one of them.
+// The node selector of the pod is combined with each required node affinity term.
+func nodeSelectors(podSpec *corev1.PodSpec) ([]labels.Selector, error) {
+	base := labels.SelectorFromSet(podSpec.NodeSelector)
+
+	affinity := podSpec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return []labels.Selector{base}, nil
+	}
+
+	selectors := make([]labels.Selector, 0)
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		selector := labels.SelectorFromSet(podSpec.NodeSelector)
+		for _, expression := range term.MatchExpressions {
+			requirement, err := nodeSelectorRequirement(expression)
+			if err != nil {
+				return nil, err
+			}
+			selector = selector.Add(*requirement)
+		}
+		selectors = append(selectors, selector)
+	}
+	if len(selectors) == 0 {
+		return []labels.Selector{base}, nil
+	}
+
+	return selectors, nil
+}
+
+func nodeSelectorRequirement(expression corev1.NodeSelectorRequirement) (*labels.Requirement, error) {
+	operators := map[corev1.NodeSelectorOperator]selection.Operator{
+		corev1.NodeSelectorOpIn:           selection.In,
+		corev1.NodeSelectorOpNotIn:        selection.NotIn,
+		corev1.NodeSelectorOpExists:       selection.Exists,
+		corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+		corev1.NodeSelectorOpGt:           selection.GreaterThan,
+		corev1.NodeSelectorOpLt:           selection.LessThan,
+	}
+
+	operator, ok := operators[expression.Operator]
+	if !ok {
+		return nil, fmt.Errorf("unknown node selector operator '%v'", expression.Operator)
+	}
+
+	return labels.NewRequirement(expression.Key, operator, expression.Values)
+}
+
+func anyNodeMatches(nodes []corev1.Node, selectors []labels.Selector) bool {
+	for _, node := range nodes {
+		for _, selector := range selectors {
+			if selector.Matches(labels.Set(node.Labels)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *PreflightChecker) checkLoadBalancer(options PreflightOptions) (PreflightResult, error) {
+	result := PreflightResult{Check: "LoadBalancer", Status: CheckPass}
+
+	if options.CloudProvider {
+		result.Message = "provided by the cloud provider"
+		return result, nil
+	}
+	for component := range options.Components {
+		if path.Base(component) == "metallb" {
+			result.Message = "MetalLB is part of the deployment"
+			return result, nil
+		}
+	}
+
+	services, err := p.client.List("v1", "Service", "", "")
+	if err != nil {
+		return result, err
+	}
+
+	for _, service := range services {
+		serviceType, _, _ := unstructured.NestedString(service.Object, "spec", "type")
+		ingresses, _, _ := unstructured.NestedSlice(service.Object, "status", "loadBalancer", "ingress")
+		if serviceType == string(corev1.ServiceTypeLoadBalancer) && len(ingresses) != 0 {
+			result.Message = fmt.Sprintf("Service %v/%v has a LoadBalancer address", service.GetNamespace(), service.GetName())
+			return result, nil
+		}
+	}
+
+	result.Status = CheckWarn
+	result.Message = "no LoadBalancer Service has an address, so the istio ingress gateway may not get one. " +
+		"Run 'opctl init' with --enable-metallb to add MetalLB"
+
+	return result, nil
+}
+
+func (p *PreflightChecker) checkConflictingInstalls(options PreflightOptions) (PreflightResult, error) {
+	result := PreflightResult{Check: "Existing installs", Status: CheckPass}
+
+	// Only tools the deployment installs can conflict
+	tools := make(map[string]bool)
+	for _, resources := range options.Components {
+		for _, resource := range resources {
+			if IsCustomResourceDefinition(resource) {
+				if tool := crdTool(resource.GetName()); tool != "" {
+					tools[tool] = true
+				}
+			}
+		}
+	}
+	if len(tools) == 0 {
+		result.Message = "the deployment has no Istio, cert-manager or Argo CustomResourceDefinitions"
+		return result, nil
+	}
+
+	crds, err := p.client.List("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "")
+	if err != nil {
+		return result, err
+	}
+
+	conflicts := make([]string, 0)
+	unlabeled := make([]string, 0)
+	for _, crd := range crds {
+		tool := crdTool(crd.GetName())
+		if !tools[tool] || IsOwnedBy(crd, options.Deployment) {
+			continue
+		}
+
+		// Resources that are labeled for another deployment were certainly not installed by this one
+		if crd.GetLabels()[ManagedByLabel] != "" {
+			conflicts = append(conflicts, fmt.Sprintf("%v (%v)", crd.GetName(), tool))
+		} else {
+			unlabeled = append(unlabeled, fmt.Sprintf("%v (%v)", crd.GetName(), tool))
+		}
+	}
+
+	if len(conflicts) != 0 {
+		result.Status = CheckFail
+		result.Message = "CustomResourceDefinitions are managed by another install: " + strings.Join(conflicts, ", ")
+	} else if len(unlabeled) != 0 {
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("%v CustomResourceDefinitions were not installed by this deployment, e.g. %v. "+
+			"They may belong to another install, or to a deployment applied by an older opctl", len(unlabeled), unlabeled[0])
+	} else {
+		result.Message = "no other install found"
+	}
+
+	return result, nil
+}
+
+// crdTool returns the tool of preflightCRDGroups the CustomResourceDefinition belongs to, or an empty string.
+// The name of a CustomResourceDefinition is <plural>.<group>.
+func crdTool(name string) string {
+	for tool, groups := range preflightCRDGroups {
+		for _, group := range groups {
+			if strings.HasSuffix(name, "."+group) {
+				return tool
+			}
+		}
+	}
+
+	return ""
+}
+
+func (p *PreflightChecker) listNodes() ([]corev1.Node, error) {
+	resources, err := p.client.List("v1", "Node", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]corev1.Node, 0)
+	for _, resource := range resources {
+		node := corev1.Node{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, &node); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
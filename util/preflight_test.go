@@ -0,0 +1,184 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+const preflightRenderedResources = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: core
+  namespace: onepanel
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: core
+        resources:
+          requests:
+            cpu: 500m
+            memory: 1Gi
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: workflows.argoproj.io`
+
+const preflightGPUPluginResources = `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: nvidia-device-plugin
+  namespace: kube-system
+spec:
+  template:
+    spec:
+      nodeSelector:
+        accelerator: nvidia
+      containers:
+      - name: nvidia-device-plugin`
+
+func testNode(name string, cpu, memory string, nodeLabels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: v1.ObjectMeta{Name: name, Labels: nodeLabels},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}
+}
+
+func testPreflightOptions(t *testing.T, components map[string]string) PreflightOptions {
+	options := PreflightOptions{
+		Deployment: "onepanel",
+		Components: make(map[string][]*unstructured.Unstructured),
+	}
+
+	for component, content := range components {
+		resources, err := ParseResources(content)
+		assert.Nil(t, err)
+		options.Components[component] = resources
+	}
+
+	return options
+}
+
+func preflightStatuses(results []PreflightResult) map[string]CheckStatus {
+	statuses := make(map[string]CheckStatus)
+	for _, result := range results {
+		statuses[result.Check] = result.Status
+	}
+
+	return statuses
+}
+
+func TestPreflightChecker_Run(t *testing.T) {
+	client, err := NewFakeClusterClient(
+		testNode("node-1", "2", "4Gi", nil),
+		&storagev1.StorageClass{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        "standard",
+				Annotations: map[string]string{defaultStorageClassAnnotation: "true"},
+			},
+		},
+	)
+	assert.Nil(t, err)
+	client.Version = &version.Info{GitVersion: "v1.16.13-gke.1"}
+
+	options := testPreflightOptions(t, map[string]string{"common/onepanel": preflightRenderedResources})
+	options.CloudProvider = true
+
+	results, err := NewPreflightChecker(client).Run(options)
+	assert.Nil(t, err)
+	assert.Len(t, results, 6)
+	assert.False(t, PreflightFailed(results))
+	for _, result := range results {
+		assert.Equal(t, CheckPass, result.Status, result.Check)
+	}
+	assert.Contains(t, results[2].Message, "requests 1 CPU and 2Gi memory")
+}
+
+func TestPreflightChecker_RunFailures(t *testing.T) {
+	argoCRD := &unstructured.Unstructured{}
+	argoCRD.SetAPIVersion("apiextensions.k8s.io/v1beta1")
+	argoCRD.SetKind("CustomResourceDefinition")
+	argoCRD.SetName("workflows.argoproj.io")
+	argoCRD.SetLabels(map[string]string{ManagedByLabel: "Helm"})
+
+	client, err := NewFakeClusterClient(testNode("node-1", "500m", "1Gi", nil), argoCRD)
+	assert.Nil(t, err)
+	client.Version = &version.Info{GitVersion: "v1.14.10"}
+
+	options := testPreflightOptions(t, map[string]string{
+		"common/onepanel": preflightRenderedResources,
+		"gpu-plugins":     preflightGPUPluginResources,
+	})
+
+	results, err := NewPreflightChecker(client).Run(options)
+	assert.Nil(t, err)
+	assert.True(t, PreflightFailed(results))
+	assert.Equal(t, map[string]CheckStatus{
+		"Kubernetes version":   CheckFail,
+		"Default StorageClass": CheckFail,
+		"CPU and memory":       CheckFail,
+		"GPU node labels":      CheckWarn,
+		"LoadBalancer":         CheckWarn,
+		"Existing installs":    CheckFail,
+	}, preflightStatuses(results))
+}
+
+func TestPreflightChecker_RunWarnings(t *testing.T) {
+	argoCRD := &unstructured.Unstructured{}
+	argoCRD.SetAPIVersion("apiextensions.k8s.io/v1beta1")
+	argoCRD.SetKind("CustomResourceDefinition")
+	argoCRD.SetName("workflows.argoproj.io")
+
+	client, err := NewFakeClusterClient(
+		testNode("node-1", "4", "8Gi", nil),
+		testNode("gpu-node-1", "4", "8Gi", map[string]string{"accelerator": "nvidia"}),
+		argoCRD,
+	)
+	assert.Nil(t, err)
+	client.Version = &version.Info{GitVersion: "v1.19.2"}
+
+	options := testPreflightOptions(t, map[string]string{
+		"common/onepanel": preflightRenderedResources + "\n---\n" + `apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: onepanel
+  annotations:
+    storageclass.kubernetes.io/is-default-class: "true"`,
+		"gpu-plugins": preflightGPUPluginResources,
+		"metallb":     "",
+	})
+
+	results, err := NewPreflightChecker(client).Run(options)
+	assert.Nil(t, err)
+	assert.False(t, PreflightFailed(results))
+	assert.Equal(t, map[string]CheckStatus{
+		"Kubernetes version":   CheckWarn,
+		"Default StorageClass": CheckPass,
+		"CPU and memory":       CheckPass,
+		"GPU node labels":      CheckPass,
+		"LoadBalancer":         CheckPass,
+		"Existing installs":    CheckWarn,
+	}, preflightStatuses(results))
+}
+
+func TestPreflightChecker_RunClusterError(t *testing.T) {
+	client, err := NewFakeClusterClient()
+	assert.Nil(t, err)
+
+	_, err = NewPreflightChecker(client).Run(testPreflightOptions(t, nil))
+	assert.NotNil(t, err)
+}
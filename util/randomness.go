@@ -1,36 +1,33 @@
 package util
 
-import "math/rand"
+import "crypto/rand"
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
-// RandASCIIBytes generates n rando ASCII bytes
-// adapted from source: https://github.com/kpbird/golang_random_string/blob/master/main.go
+// RandASCIIBytes generates n random ASCII letters with crypto/rand, so they can be used as secrets
 func RandASCIIBytes(n int) ([]byte, error) {
-	output := make([]byte, n)
-	// We will take n bytes, one byte for each character of output.
+	output := make([]byte, 0, n)
+	// Random bytes at or above the largest multiple of len(letterBytes) are skipped,
+	// otherwise the first letters would be picked more often than the rest
+	limit := byte(256 / len(letterBytes) * len(letterBytes))
 	randomness := make([]byte, n)
-	// read all random
-	_, err := rand.Read(randomness)
-	if err != nil {
-		return nil, err
-	}
+	for len(output) < n {
+		if _, err := rand.Read(randomness); err != nil {
+			return nil, err
+		}
 
-	l := len(letterBytes)
-	// fill output
-	for pos := range output {
-		// get random item
-		random := uint8(randomness[pos])
-		// random % 64
-		randomPos := random % uint8(l)
-		// put into output
-		output[pos] = letterBytes[randomPos]
+		for _, random := range randomness {
+			if random >= limit || len(output) == n {
+				continue
+			}
+			output = append(output, letterBytes[int(random)%len(letterBytes)])
+		}
 	}
 
 	return output, nil
 }
 
-// RandASCIIString returns a rnadom string up to n characters
+// RandASCIIString returns a random string of n letters, see RandASCIIBytes
 func RandASCIIString(n int) (string, error) {
 	res, err := RandASCIIBytes(n)
 	if err != nil {
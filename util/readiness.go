@@ -0,0 +1,438 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// WorkloadPod is a single pod, or every pod in a namespace
+	WorkloadPod = "Pod"
+	// WorkloadStatefulSet is a single StatefulSet, or every StatefulSet in a namespace
+	WorkloadStatefulSet = "StatefulSet"
+	// WorkloadDeployment is a single Deployment, or every Deployment in a namespace
+	WorkloadDeployment = "Deployment"
+
+	readinessInitialBackoff = time.Second
+	readinessMaxBackoff     = 15 * time.Second
+)
+
+// Workload is something the readiness checker can wait for.
+// If Name is empty, every workload of Kind in Namespace has to be ready, and at least one has to exist.
+type Workload struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// String returns a human friendly name, e.g. Deployment onepanel/core or Pods in onepanel
+func (w Workload) String() string {
+	if w.Name == "" {
+		return fmt.Sprintf("%vs in %v", w.Kind, w.Namespace)
+	}
+
+	return fmt.Sprintf("%v %v/%v", w.Kind, w.Namespace, w.Name)
+}
+
+// WorkloadStatus is the result of checking a single workload
+type WorkloadStatus struct {
+	Workload Workload
+	Ready    bool
+	Reason   string // why the workload is not ready. Empty if it is ready.
+}
+
+// NotReadyError is returned when workloads do not become ready in time
+type NotReadyError struct {
+	Timeout  time.Duration
+	Blocking []WorkloadStatus
+}
+
+// Error lists the workloads that blocked progress
+func (e *NotReadyError) Error() string {
+	blocking := make([]string, 0)
+	for _, status := range e.Blocking {
+		blocking = append(blocking, fmt.Sprintf("%v (%v)", status.Workload, status.Reason))
+	}
+
+	return fmt.Sprintf("not ready after %v: %v", e.Timeout, strings.Join(blocking, ", "))
+}
+
+// ReadinessChecker checks pods, StatefulSets and Deployments for readiness
+type ReadinessChecker struct {
+	client kubernetes.Interface
+}
+
+// NewReadinessChecker creates a ReadinessChecker that uses client to look up workloads
+func NewReadinessChecker(client kubernetes.Interface) *ReadinessChecker {
+	return &ReadinessChecker{client: client}
+}
+
+// Check returns the current status of each workload
+func (r *ReadinessChecker) Check(workloads ...Workload) ([]WorkloadStatus, error) {
+	return checkWorkloads(&apiWorkloadGetter{client: r.client}, workloads)
+}
+
+// WaitForReady blocks until every workload is ready, or the timeout passes.
+// Workloads are checked again whenever a watched object changes, with a growing backoff in between if nothing does.
+// If the timeout passes, a *NotReadyError naming the blocking workloads is returned.
+func (r *ReadinessChecker) WaitForReady(timeout time.Duration, workloads ...Workload) error {
+	deadline := time.After(timeout)
+	backoff := readinessInitialBackoff
+
+	stop := make(chan struct{})
+	defer close(stop)
+	changes := r.watchWorkloads(workloads, stop)
+
+	for {
+		statuses, err := r.Check(workloads...)
+		if err != nil {
+			return err
+		}
+
+		blocking := NotReadyWorkloads(statuses)
+		if len(blocking) == 0 {
+			return nil
+		}
+
+		select {
+		case <-deadline:
+			return &NotReadyError{Timeout: timeout, Blocking: blocking}
+		case <-changes:
+			backoff = readinessInitialBackoff
+		case <-time.After(backoff):
+			backoff *= 2
+			if backoff > readinessMaxBackoff {
+				backoff = readinessMaxBackoff
+			}
+		}
+	}
+}
+
+// NotReadyWorkloads filters statuses down to those that are not ready
+func NotReadyWorkloads(statuses []WorkloadStatus) []WorkloadStatus {
+	notReady := make([]WorkloadStatus, 0)
+	for _, status := range statuses {
+		if !status.Ready {
+			notReady = append(notReady, status)
+		}
+	}
+
+	return notReady
+}
+
+// watchWorkloads returns a channel that receives a value whenever one of the workloads changes.
+// Watches that fail to start are ignored, the backoff in WaitForReady still rechecks them.
+func (r *ReadinessChecker) watchWorkloads(workloads []Workload, stop <-chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	for _, workload := range workloads {
+		options := v1.ListOptions{}
+		if workload.Name != "" {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", workload.Name).String()
+		}
+
+		var watcher watch.Interface
+		var err error
+		switch workload.Kind {
+		case WorkloadPod:
+			watcher, err = r.client.CoreV1().Pods(workload.Namespace).Watch(options)
+		case WorkloadStatefulSet:
+			watcher, err = r.client.AppsV1().StatefulSets(workload.Namespace).Watch(options)
+		case WorkloadDeployment:
+			watcher, err = r.client.AppsV1().Deployments(workload.Namespace).Watch(options)
+		}
+		if err != nil || watcher == nil {
+			continue
+		}
+
+		go func(watcher watch.Interface) {
+			defer watcher.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case _, ok := <-watcher.ResultChan():
+					if !ok {
+						return
+					}
+					select {
+					case changes <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}(watcher)
+	}
+
+	return changes
+}
+
+// workloadGetter gets the pods, StatefulSets or Deployments of a workload. An empty name gets all of them in the
+// namespace, a named one that does not exist is a NotFound error.
+type workloadGetter interface {
+	pods(namespace, name string) ([]corev1.Pod, error)
+	statefulSets(namespace, name string) ([]appsv1.StatefulSet, error)
+	deployments(namespace, name string) ([]appsv1.Deployment, error)
+}
+
+// apiWorkloadGetter gets the workloads from the API server
+type apiWorkloadGetter struct {
+	client kubernetes.Interface
+}
+
+func (a *apiWorkloadGetter) pods(namespace, name string) ([]corev1.Pod, error) {
+	if name != "" {
+		pod, err := a.client.CoreV1().Pods(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+
+	list, err := a.client.CoreV1().Pods(namespace).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (a *apiWorkloadGetter) statefulSets(namespace, name string) ([]appsv1.StatefulSet, error) {
+	if name != "" {
+		statefulSet, err := a.client.AppsV1().StatefulSets(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return []appsv1.StatefulSet{*statefulSet}, nil
+	}
+
+	list, err := a.client.AppsV1().StatefulSets(namespace).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (a *apiWorkloadGetter) deployments(namespace, name string) ([]appsv1.Deployment, error) {
+	if name != "" {
+		deployment, err := a.client.AppsV1().Deployments(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return []appsv1.Deployment{*deployment}, nil
+	}
+
+	list, err := a.client.AppsV1().Deployments(namespace).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// checkWorkloads returns the status of each workload, looked up with getter
+func checkWorkloads(getter workloadGetter, workloads []Workload) ([]WorkloadStatus, error) {
+	statuses := make([]WorkloadStatus, 0)
+
+	for _, workload := range workloads {
+		ready, reason, err := checkWorkload(getter, workload)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, WorkloadStatus{
+			Workload: workload,
+			Ready:    ready,
+			Reason:   reason,
+		})
+	}
+
+	return statuses, nil
+}
+
+func checkWorkload(getter workloadGetter, workload Workload) (ready bool, reason string, err error) {
+	switch workload.Kind {
+	case WorkloadPod:
+		return checkPods(getter, workload)
+	case WorkloadStatefulSet:
+		return checkStatefulSets(getter, workload)
+	case WorkloadDeployment:
+		return checkDeployments(getter, workload)
+	}
+
+	return false, "", fmt.Errorf("unknown workload kind '%v'", workload.Kind)
+}
+
+func checkPods(getter workloadGetter, workload Workload) (bool, string, error) {
+	found, err := getter.pods(workload.Namespace, workload.Name)
+	if k8serrors.IsNotFound(err) {
+		return false, "not found", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	pods := make([]corev1.Pod, 0)
+	for _, pod := range found {
+		// Pods of completed jobs are done, they will never be ready
+		if workload.Name != "" || pod.Status.Phase != corev1.PodSucceeded {
+			pods = append(pods, pod)
+		}
+	}
+
+	if len(pods) == 0 {
+		return false, "no pods found", nil
+	}
+
+	reasons := make([]string, 0)
+	for i := range pods {
+		if ready, reason := PodReady(&pods[i]); !ready {
+			reasons = append(reasons, fmt.Sprintf("%v: %v", pods[i].Name, reason))
+		}
+	}
+	sort.Strings(reasons)
+
+	return len(reasons) == 0, strings.Join(reasons, "; "), nil
+}
+
+func checkStatefulSets(getter workloadGetter, workload Workload) (bool, string, error) {
+	statefulSets, err := getter.statefulSets(workload.Namespace, workload.Name)
+	if k8serrors.IsNotFound(err) {
+		return false, "not found", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	reasons := make([]string, 0)
+	for i := range statefulSets {
+		if ready, reason := StatefulSetReady(&statefulSets[i]); !ready {
+			reasons = append(reasons, fmt.Sprintf("%v: %v", statefulSets[i].Name, reason))
+		}
+	}
+	sort.Strings(reasons)
+
+	return len(reasons) == 0, strings.Join(reasons, "; "), nil
+}
+
+func checkDeployments(getter workloadGetter, workload Workload) (bool, string, error) {
+	deployments, err := getter.deployments(workload.Namespace, workload.Name)
+	if k8serrors.IsNotFound(err) {
+		return false, "not found", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	reasons := make([]string, 0)
+	for i := range deployments {
+		if ready, reason := DeploymentReady(&deployments[i]); !ready {
+			reasons = append(reasons, fmt.Sprintf("%v: %v", deployments[i].Name, reason))
+		}
+	}
+	sort.Strings(reasons)
+
+	return len(reasons) == 0, strings.Join(reasons, "; "), nil
+}
+
+// PodReady returns true if the pod is running and has the Ready condition.
+// Otherwise, the most specific reason available is returned, like CrashLoopBackOff.
+func PodReady(pod *corev1.Pod) (bool, string) {
+	reason, message := podNotReadyReason(pod)
+	if reason == "" {
+		return true, ""
+	}
+
+	if pod.Status.Phase == corev1.PodPending && message != "" {
+		return false, fmt.Sprintf("%v: %v", reason, message)
+	}
+
+	return false, reason
+}
+
+// podNotReadyReason returns why the pod is not ready, along with a longer message if one is available.
+// The reason is empty if the pod is ready.
+func podNotReadyReason(pod *corev1.Pod) (reason, message string) {
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.State.Waiting != nil && containerStatus.State.Waiting.Reason != "" &&
+			containerStatus.State.Waiting.Reason != "ContainerCreating" {
+			return containerStatus.State.Waiting.Reason, containerStatus.State.Waiting.Message
+		}
+	}
+
+	if pod.Status.Phase == corev1.PodPending {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+				return string(corev1.PodPending), condition.Message
+			}
+		}
+	}
+
+	if pod.Status.Phase != corev1.PodRunning {
+		return string(pod.Status.Phase), pod.Status.Message
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			if condition.Status == corev1.ConditionTrue {
+				return "", ""
+			}
+			break
+		}
+	}
+
+	return "ContainersNotReady", "containers not ready"
+}
+
+// StatefulSetReady returns true if the StatefulSet finished rolling out and all replicas are ready
+func StatefulSetReady(statefulSet *appsv1.StatefulSet) (bool, string) {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return false, "update not yet observed"
+	}
+	if statefulSet.Status.UpdateRevision != "" && statefulSet.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("%v of %v replicas updated", statefulSet.Status.UpdatedReplicas, replicas)
+	}
+	if statefulSet.Status.ReadyReplicas < replicas {
+		return false, fmt.Sprintf("%v of %v replicas ready", statefulSet.Status.ReadyReplicas, replicas)
+	}
+
+	return true, ""
+}
+
+// DeploymentReady returns true if the Deployment finished rolling out and all replicas are available
+func DeploymentReady(deployment *appsv1.Deployment) (bool, string) {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false, "update not yet observed"
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return false, condition.Message
+		}
+	}
+	if deployment.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("%v of %v replicas updated", deployment.Status.UpdatedReplicas, replicas)
+	}
+	if deployment.Status.AvailableReplicas < replicas {
+		return false, fmt.Sprintf("%v of %v replicas available", deployment.Status.AvailableReplicas, replicas)
+	}
+
+	return true, ""
+}
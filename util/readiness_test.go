@@ -0,0 +1,136 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPod(namespace, name string, phase corev1.PodPhase, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Namespace: namespace, Name: name},
+		Status: corev1.PodStatus{
+			Phase:      phase,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
+
+func TestReadinessChecker_Check(t *testing.T) {
+	replicas := int32(2)
+	crashing := testPod("onepanel", "core-1", corev1.PodRunning, corev1.ConditionFalse)
+	crashing.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	}}
+
+	client := fake.NewSimpleClientset(
+		testPod("application-system", "application-controller-manager-0", corev1.PodRunning, corev1.ConditionTrue),
+		testPod("onepanel", "completed-job", corev1.PodSucceeded, corev1.ConditionFalse),
+		crashing,
+		&appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "core"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{UpdatedReplicas: 2, AvailableReplicas: 1},
+		},
+	)
+	checker := NewReadinessChecker(client)
+
+	statuses, err := checker.Check(
+		Workload{Kind: WorkloadPod, Namespace: "application-system", Name: "application-controller-manager-0"},
+		Workload{Kind: WorkloadPod, Namespace: "onepanel"},
+		Workload{Kind: WorkloadDeployment, Namespace: "onepanel"},
+		Workload{Kind: WorkloadStatefulSet, Namespace: "onepanel"},
+		Workload{Kind: WorkloadPod, Namespace: "istio-system"},
+	)
+	assert.Nil(t, err)
+	assert.Len(t, statuses, 5)
+
+	assert.True(t, statuses[0].Ready)
+	assert.False(t, statuses[1].Ready)
+	assert.Equal(t, "core-1: CrashLoopBackOff", statuses[1].Reason)
+	assert.False(t, statuses[2].Ready)
+	assert.Equal(t, "core: 1 of 2 replicas available", statuses[2].Reason)
+	assert.True(t, statuses[3].Ready)
+	assert.False(t, statuses[4].Ready)
+	assert.Equal(t, "no pods found", statuses[4].Reason)
+}
+
+func TestReadinessChecker_WaitForReady(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testPod("application-system", "application-controller-manager-0", corev1.PodRunning, corev1.ConditionTrue),
+		testPod("onepanel", "core-0", corev1.PodPending, corev1.ConditionFalse),
+	)
+	checker := NewReadinessChecker(client)
+
+	err := checker.WaitForReady(time.Second, Workload{Kind: WorkloadPod, Namespace: "application-system"})
+	assert.Nil(t, err)
+
+	err = checker.WaitForReady(100*time.Millisecond, Workload{Kind: WorkloadPod, Namespace: "onepanel", Name: "core-0"})
+	notReadyErr, ok := err.(*NotReadyError)
+	assert.True(t, ok)
+	assert.Len(t, notReadyErr.Blocking, 1)
+	assert.True(t, strings.Contains(err.Error(), "Pod onepanel/core-0"))
+}
+
+func TestReadinessChecker_WatchUntilReady(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testPod("onepanel", "core-0", corev1.PodPending, corev1.ConditionFalse),
+	)
+	checker := NewReadinessChecker(client)
+	workload := Workload{Kind: WorkloadPod, Namespace: "onepanel", Name: "core-0"}
+
+	updates := 0
+	err := checker.WatchUntilReady(5*time.Second, func(statuses []WorkloadStatus) {
+		updates++
+		if updates == 1 {
+			assert.False(t, statuses[0].Ready)
+			_, updateErr := client.CoreV1().Pods("onepanel").Update(testPod("onepanel", "core-0", corev1.PodRunning, corev1.ConditionTrue))
+			assert.Nil(t, updateErr)
+		}
+	}, workload)
+	assert.Nil(t, err)
+	assert.True(t, updates >= 2)
+	// The workloads are checked in the caches of the informers, not with requests of their own
+	for _, action := range client.Actions() {
+		assert.NotEqual(t, "get", action.GetVerb())
+	}
+
+	client = fake.NewSimpleClientset(
+		testPod("onepanel", "core-0", corev1.PodPending, corev1.ConditionFalse),
+	)
+	err = NewReadinessChecker(client).WatchUntilReady(100*time.Millisecond, func([]WorkloadStatus) {}, workload)
+	_, ok := err.(*NotReadyError)
+	assert.True(t, ok)
+}
+
+func TestResourceWorkloads(t *testing.T) {
+	resources, err := ParseResources(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: core
+  namespace: onepanel
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: onepanel
+  namespace: onepanel
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: database
+  namespace: onepanel`)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []Workload{
+		{Kind: WorkloadDeployment, Namespace: "onepanel", Name: "core"},
+		{Kind: WorkloadStatefulSet, Namespace: "onepanel", Name: "database"},
+	}, ResourceWorkloads(resources))
+}
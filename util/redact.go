@@ -0,0 +1,121 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/onepanelio/cli/cloud/storage"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RedactedValue replaces the value of secret params when params are stored or shared
+const RedactedValue = "<redacted>"
+
+// secretParamKeyParts are parts of param names whose values are sensitive,
+// e.g. database.password or artifactRepository.s3.secretKey
+var secretParamKeyParts = []string{
+	"password",
+	"secret",
+	"accesskey",
+	"accountkey",
+	"privatekey",
+	"apikey",
+	"token",
+	"credential",
+}
+
+// IsSecretParamKey returns true if the value of the flattened params key, e.g. database.password, is sensitive.
+// The credentials of the artifact repository, see storage.SecretParams, are always sensitive.
+func IsSecretParamKey(key string) bool {
+	for _, param := range storage.SecretParams {
+		if strings.EqualFold(key, param) {
+			return true
+		}
+	}
+
+	lastPart := strings.ToLower(key[strings.LastIndex(key, ".")+1:])
+
+	for _, part := range secretParamKeyParts {
+		if strings.Contains(lastPart, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactSecretParams returns a copy of the params where the value of every secret param is replaced with RedactedValue.
+// Values that are, or were, encrypted are secret as well, see DecryptParams.
+// Other values keep their resolved value, so the copy can be used without resolving it again, e.g. from the inventory.
+// Empty values are kept so it is still visible whether they were set.
+func RedactSecretParams(yamlFile *DynamicYaml) (*DynamicYaml, error) {
+	return redactSecretParams(yamlFile, false)
+}
+
+// RedactSecretParamsForSharing redacts the params like RedactSecretParams, for sharing them, e.g. in a support bundle.
+// Values that were resolved from references get their reference back, see ResolveParamReferences.
+func RedactSecretParamsForSharing(yamlFile *DynamicYaml) (*DynamicYaml, error) {
+	return redactSecretParams(yamlFile, true)
+}
+
+func redactSecretParams(yamlFile *DynamicYaml, restoreReferences bool) (*DynamicYaml, error) {
+	content, err := yamlFile.String()
+	if err != nil {
+		return nil, err
+	}
+
+	redacted, err := LoadDynamicYamlFromString(content)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, pair := range redacted.Flatten(AppendDotFlatMapKeyFormatter) {
+		secret := IsSecretParamKey(key) || yamlFile.decryptedKeys[key] || IsEncryptedValue(pair.Value.Value)
+		if reference, ok := yamlFile.references[key]; ok && restoreReferences && !secret {
+			setStringValue(pair.Value, reference)
+			continue
+		}
+		if !secret || pair.Value.Value == "" {
+			continue
+		}
+
+		pair.Value.Value = RedactedValue
+		pair.Value.Tag = "!!str"
+		pair.Value.Style = 0
+	}
+
+	return redacted, nil
+}
+
+// RedactSecretResources returns the yaml resources in content with the value of every key of a Secret replaced
+// with RedactedValue. The keys are kept so it is still visible what a Secret holds.
+func RedactSecretResources(content string) (string, error) {
+	resources, err := ParseResources(content)
+	if err != nil {
+		return "", err
+	}
+
+	for _, resource := range resources {
+		if resource.GetAPIVersion() != "v1" || resource.GetKind() != "Secret" {
+			continue
+		}
+
+		for _, field := range []string{"data", "stringData"} {
+			values, found, err := unstructured.NestedMap(resource.Object, field)
+			if err != nil {
+				return "", err
+			}
+			if !found {
+				continue
+			}
+
+			for key := range values {
+				values[key] = RedactedValue
+			}
+			if err := unstructured.SetNestedMap(resource.Object, values, field); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return ResourcesToYaml(resources)
+}
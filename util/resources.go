@@ -0,0 +1,106 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8yaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ParseResources splits multi-document kubernetes yaml, like the output of kustomize, into objects.
+// Empty documents are skipped.
+func ParseResources(content string) ([]*unstructured.Unstructured, error) {
+	decoder := k8yaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(content), 4096)
+
+	resources := make([]*unstructured.Unstructured, 0)
+	for {
+		data := make(map[string]interface{})
+		if err := decoder.Decode(&data); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if len(data) == 0 {
+			continue
+		}
+
+		resource := &unstructured.Unstructured{Object: data}
+		if resource.GetKind() == "" {
+			return nil, fmt.Errorf("resource '%v' is missing a kind", resource.GetName())
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, nil
+}
+
+// ParseResourcesFromFile loads the file at filePath and parses it with ParseResources
+func ParseResourcesFromFile(filePath string) ([]*unstructured.Unstructured, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseResources(string(content))
+}
+
+// ResourceKey returns a string that uniquely identifies a resource in a cluster, e.g.
+// apps/Deployment/onepanel/core
+func ResourceKey(resource *unstructured.Unstructured) string {
+	gvk := resource.GroupVersionKind()
+
+	return strings.Join([]string{gvk.Group, gvk.Kind, resource.GetNamespace(), resource.GetName()}, "/")
+}
+
+// ResourceDisplayName returns a human friendly name for the resource, e.g. Deployment onepanel/core
+func ResourceDisplayName(resource *unstructured.Unstructured) string {
+	if resource.GetNamespace() == "" {
+		return fmt.Sprintf("%v %v", resource.GetKind(), resource.GetName())
+	}
+
+	return fmt.Sprintf("%v %v/%v", resource.GetKind(), resource.GetNamespace(), resource.GetName())
+}
+
+// ResourcesToYaml joins the resources into a single multi-document yaml string
+func ResourcesToYaml(resources []*unstructured.Unstructured) (string, error) {
+	builder := &strings.Builder{}
+
+	for i, resource := range resources {
+		data, err := yaml.Marshal(resource.Object)
+		if err != nil {
+			return "", err
+		}
+
+		if i > 0 {
+			builder.WriteString("---\n")
+		}
+		builder.Write(data)
+	}
+
+	return builder.String(), nil
+}
+
+// ResourcesNotIn returns the resources that have no resource with the same ResourceKey in others
+func ResourcesNotIn(resources, others []*unstructured.Unstructured) []*unstructured.Unstructured {
+	otherKeys := make(map[string]bool)
+	for _, other := range others {
+		otherKeys[ResourceKey(other)] = true
+	}
+
+	results := make([]*unstructured.Unstructured, 0)
+	for _, resource := range resources {
+		if !otherKeys[ResourceKey(resource)] {
+			results = append(results, resource)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,191 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RevisionHistoryLimit is how many revisions are kept in the cluster. Older revisions are deleted.
+	RevisionHistoryLimit = 10
+
+	revisionLabel                   = "opctl.onepanel.io/revision"
+	revisionApplicationManifestsKey = "application.kubernetes.yaml.gz"
+	revisionManifestsKey            = "kubernetes.yaml.gz"
+)
+
+// Revision is a recorded apply, along with the manifests that were applied.
+// ApplicationManifests are applied before Manifests, see Inventory.
+type Revision struct {
+	Inventory            *Inventory
+	ApplicationManifests string
+	Manifests            string
+}
+
+// RevisionSecretName returns the name of the Secret that holds the revision, e.g. opctl-revision-3
+func RevisionSecretName(revision int) string {
+	return fmt.Sprintf("opctl-revision-%v", revision)
+}
+
+// Record saves a new revision with the rendered manifests and makes inventory the current inventory.
+// inventory.Revision is set to the number of the new revision.
+// Revisions beyond RevisionHistoryLimit are deleted, oldest first.
+func (s *InventoryStore) Record(inventory *Inventory, applicationManifests, manifests string) error {
+	revisions, err := s.Revisions()
+	if err != nil {
+		return err
+	}
+
+	inventory.Revision = 1
+	if len(revisions) != 0 {
+		inventory.Revision = revisions[len(revisions)-1].Revision + 1
+	}
+
+	if err := ensureInventoryNamespace(s.client); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+	applicationManifestsData, err := gzipString(applicationManifests)
+	if err != nil {
+		return err
+	}
+	manifestsData, err := gzipString(manifests)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: InventoryNamespace,
+			Name:      RevisionSecretName(inventory.Revision),
+			Labels: map[string]string{
+				ManagedByLabel: ManagedByValue,
+				revisionLabel:  strconv.Itoa(inventory.Revision),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			inventoryDataKey:                data,
+			revisionApplicationManifestsKey: applicationManifestsData,
+			revisionManifestsKey:            manifestsData,
+		},
+	}
+	if _, err := s.client.CoreV1().Secrets(InventoryNamespace).Create(secret); err != nil {
+		return err
+	}
+
+	if err := s.Save(inventory); err != nil {
+		return err
+	}
+
+	revisions = append(revisions, inventory)
+	for len(revisions) > RevisionHistoryLimit {
+		err := s.client.CoreV1().Secrets(InventoryNamespace).Delete(RevisionSecretName(revisions[0].Revision), &v1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		revisions = revisions[1:]
+	}
+
+	return nil
+}
+
+// Revisions returns the inventory of every recorded revision, oldest first
+func (s *InventoryStore) Revisions() ([]*Inventory, error) {
+	secrets, err := s.client.CoreV1().Secrets(InventoryNamespace).List(v1.ListOptions{LabelSelector: revisionLabel})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*Inventory, 0)
+	for _, secret := range secrets.Items {
+		inventory := &Inventory{}
+		if err := json.Unmarshal(secret.Data[inventoryDataKey], inventory); err != nil {
+			return nil, fmt.Errorf("unable to read revision secret '%v': %v", secret.Name, err.Error())
+		}
+
+		revisions = append(revisions, inventory)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions, nil
+}
+
+// LoadRevision returns the revision along with its manifests. If the revision does not exist, nil is returned, with no error
+func (s *InventoryStore) LoadRevision(revision int) (*Revision, error) {
+	secret, err := s.client.CoreV1().Secrets(InventoryNamespace).Get(RevisionSecretName(revision), v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Revision{
+		Inventory: &Inventory{},
+	}
+	if err := json.Unmarshal(secret.Data[inventoryDataKey], result.Inventory); err != nil {
+		return nil, err
+	}
+
+	result.ApplicationManifests, err = gunzipString(secret.Data[revisionApplicationManifestsKey])
+	if err != nil {
+		return nil, err
+	}
+	result.Manifests, err = gunzipString(secret.Data[revisionManifestsKey])
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DeleteRevisions removes every recorded revision from the cluster
+func (s *InventoryStore) DeleteRevisions() error {
+	return s.client.CoreV1().Secrets(InventoryNamespace).DeleteCollection(&v1.DeleteOptions{}, v1.ListOptions{LabelSelector: revisionLabel})
+}
+
+// gzipString compresses content, rendered manifests are too large to store as is
+func gzipString(content string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func gunzipString(data []byte) (string, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
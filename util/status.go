@@ -1,57 +1,47 @@
 package util
 
-import (
-	"errors"
-	"fmt"
-	"strings"
-)
-
-func DeploymentStatus(yamlFile *DynamicYaml) (ready bool, err error) {
-	//True is a required namespace
-	namespacesToCheck := make(map[string]bool)
-	namespacesToCheck["application-system"] = true
-	namespacesToCheck["onepanel"] = true
-	namespacesToCheck["istio-system"] = true
+import "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+// DeploymentWorkloads returns the workloads that have to be ready for the deployment described by yamlFile to be ready.
+// Every namespace has to have pods, and all of its pods, StatefulSets and Deployments have to be ready.
+func DeploymentWorkloads(yamlFile *DynamicYaml) []Workload {
+	namespaces := []string{"application-system", "onepanel", "istio-system"}
 
 	if yamlFile.HasKey("certManager") {
-		namespacesToCheck["cert-manager"] = true
+		namespaces = append(namespaces, "cert-manager")
 	}
 	if yamlFile.HasKey("logging") {
-		namespacesToCheck["kube-logging"] = true
+		namespaces = append(namespaces, "kube-logging")
 	}
 
-	var stdout, stderr string
-	for namespace, required := range namespacesToCheck {
-		flags := make(map[string]interface{})
-		var extraArgs []string
-		stdout, stderr, err = KubectlGet("pod", "", namespace, extraArgs, flags)
-		if err != nil {
-			return false, err
-		}
-		if stderr != "" {
-			if strings.Contains(stderr, "No resources found") {
-				if required {
-					return false, errors.New(stderr)
-				}
-				fmt.Println(stderr)
-				continue
-			}
-			return false, errors.New(stderr)
-		}
-		lines := strings.Split(stdout, "\n")
-		if len(lines) > 1 {
-			//check that the pods are running, line by line
-			for idx, line := range lines {
-				if idx == 0 {
-					continue
-				}
-				if line != "" && !strings.Contains(line, "Running") {
-					return false, nil
-				}
-			}
-		} else {
-			return false, errors.New(stdout + "No pods detected in namespace " + namespace)
+	workloads := make([]Workload, 0)
+	for _, namespace := range namespaces {
+		workloads = append(workloads,
+			Workload{Kind: WorkloadDeployment, Namespace: namespace},
+			Workload{Kind: WorkloadStatefulSet, Namespace: namespace},
+			Workload{Kind: WorkloadPod, Namespace: namespace},
+		)
+	}
+
+	return workloads
+}
+
+// ResourceWorkloads returns the Deployments and StatefulSets among resources, as the workloads to wait for
+func ResourceWorkloads(resources []*unstructured.Unstructured) []Workload {
+	workloads := make([]Workload, 0)
+	for _, resource := range resources {
+		kind := resource.GetKind()
+		if kind != WorkloadDeployment && kind != WorkloadStatefulSet {
+			continue
 		}
+
+		workloads = append(workloads, Workload{Kind: kind, Namespace: resource.GetNamespace(), Name: resource.GetName()})
 	}
-	return true, nil
+
+	return workloads
+}
+
+// DeploymentStatus checks the workloads of the deployment described by yamlFile once
+func DeploymentStatus(client ClusterClient, yamlFile *DynamicYaml) ([]WorkloadStatus, error) {
+	return NewReadinessChecker(client.Kubernetes()).Check(DeploymentWorkloads(yamlFile)...)
 }
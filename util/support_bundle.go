@@ -0,0 +1,281 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// supportBundleDirectory is the directory every file of a support bundle is written to in the tarball
+const supportBundleDirectory = "support-bundle"
+
+// supportBundleWorkloadKinds are described in addition to the pods of each namespace
+var supportBundleWorkloadKinds = []struct {
+	APIVersion string
+	Kind       string
+}{
+	{"apps/v1", "Deployment"},
+	{"apps/v1", "StatefulSet"},
+	{"apps/v1", "DaemonSet"},
+}
+
+// SupportBundle collects files that describe a deployment, so they can be attached to an issue
+type SupportBundle struct {
+	names    []string
+	contents map[string]string
+}
+
+// NewSupportBundle creates an empty SupportBundle
+func NewSupportBundle() *SupportBundle {
+	return &SupportBundle{
+		names:    make([]string, 0),
+		contents: make(map[string]string),
+	}
+}
+
+// Add adds a file to the bundle, name is a slash separated path. A file that was already added is replaced.
+func (b *SupportBundle) Add(name, content string) {
+	if _, ok := b.contents[name]; !ok {
+		b.names = append(b.names, name)
+	}
+	b.contents[name] = content
+}
+
+// AddError records that the file could not be collected, as a name.error file with the error
+func (b *SupportBundle) AddError(name string, err error) {
+	b.Add(name+".error", err.Error()+"\n")
+}
+
+// Names returns the names of the files, in the order they were added
+func (b *SupportBundle) Names() []string {
+	return append([]string{}, b.names...)
+}
+
+// Content returns the content of the file, and false if there is no such file
+func (b *SupportBundle) Content(name string) (string, bool) {
+	content, ok := b.contents[name]
+
+	return content, ok
+}
+
+// Errors returns the names of the files that could not be collected
+func (b *SupportBundle) Errors() []string {
+	errors := make([]string, 0)
+	for _, name := range b.names {
+		if strings.HasSuffix(name, ".error") {
+			errors = append(errors, strings.TrimSuffix(name, ".error"))
+		}
+	}
+
+	return errors
+}
+
+// WriteTarball writes the files as a gzipped tarball, in the support-bundle directory
+func (b *SupportBundle) WriteTarball(w io.Writer) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	now := time.Now()
+	for _, name := range b.names {
+		content := b.contents[name]
+		header := &tar.Header{
+			Name:    path.Join(supportBundleDirectory, name),
+			Mode:    0600,
+			Size:    int64(len(content)),
+			ModTime: now,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tarWriter, content); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+
+	return gzipWriter.Close()
+}
+
+// CollectNamespace adds the pods, events, describe output and the last tailLines of the logs of every container
+// of the namespace, in the namespaces/<namespace> directory. Sensitive environment variables are redacted in the describe
+// output, see redactDescribedEnvironment, but the logs are added as they are. Anything that can not be collected is recorded with AddError,
+// so one failing pod does not keep the rest out of the bundle.
+func (b *SupportBundle) CollectNamespace(client ClusterClient, namespace string, tailLines int64) {
+	directory := path.Join("namespaces", namespace)
+
+	resources, err := client.List("v1", "Pod", namespace, "")
+	if err != nil {
+		b.AddError(path.Join(directory, "pods.txt"), err)
+	}
+	pods := make([]corev1.Pod, 0, len(resources))
+	for _, resource := range resources {
+		pod := corev1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, &pod); err != nil {
+			b.AddError(path.Join(directory, "pods", resource.GetName()), err)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	if err == nil {
+		b.Add(path.Join(directory, "pods.txt"), podsTable(pods))
+	}
+
+	events, err := client.ListEvents(namespace)
+	if err != nil {
+		b.AddError(path.Join(directory, "events.txt"), err)
+	} else {
+		b.Add(path.Join(directory, "events.txt"), eventsTable(events))
+	}
+
+	for _, pod := range pods {
+		b.collectDescribe(client, directory, "v1", "Pod", namespace, pod.Name)
+	}
+	for _, workloadKind := range supportBundleWorkloadKinds {
+		workloads, err := client.List(workloadKind.APIVersion, workloadKind.Kind, namespace, "")
+		if err != nil {
+			b.AddError(path.Join(directory, "describe", workloadKind.Kind), err)
+			continue
+		}
+		for _, workload := range workloads {
+			b.collectDescribe(client, directory, workloadKind.APIVersion, workloadKind.Kind, namespace, workload.GetName())
+		}
+	}
+
+	for _, pod := range pods {
+		containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		for _, container := range containers {
+			name := path.Join(directory, "logs", fmt.Sprintf("%v-%v.log", pod.Name, container.Name))
+			logs, err := client.Logs(namespace, pod.Name, container.Name, tailLines)
+			if err != nil {
+				b.AddError(name, err)
+				continue
+			}
+			b.Add(name, logs)
+		}
+	}
+}
+
+func (b *SupportBundle) collectDescribe(client ClusterClient, directory, apiVersion, kind, namespace, name string) {
+	fileName := path.Join(directory, "describe", fmt.Sprintf("%v-%v.txt", kind, name))
+	description, err := client.Describe(apiVersion, kind, namespace, name)
+	if err != nil {
+		b.AddError(fileName, err)
+		return
+	}
+
+	b.Add(fileName, redactDescribedEnvironment(description))
+}
+
+// describedEnvironmentVariable matches a variable in the Environment of a container in describe output,
+// e.g. "      DB_PASSWORD:  value"
+var describedEnvironmentVariable = regexp.MustCompile(`^(\s+)([^\s:]+):(\s*)(.*)$`)
+
+// redactDescribedEnvironment replaces the values of the environment variables in describe output whose names are
+// sensitive, see IsSecretParamKey. Further lines of multi-line values are left out. References to secrets are kept,
+// they do not contain the value.
+func redactDescribedEnvironment(description string) string {
+	lines := strings.Split(description, "\n")
+	result := make([]string, 0, len(lines))
+
+	// environmentIndent is the indent of the Environment: line while its variables are read, -1 otherwise
+	environmentIndent := -1
+	variableIndent := -1
+	redacting := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if environmentIndent >= 0 && (trimmed == "" || indent <= environmentIndent) {
+			environmentIndent = -1
+		}
+
+		if environmentIndent < 0 {
+			if trimmed == "Environment:" {
+				environmentIndent = indent
+				variableIndent = -1
+				redacting = false
+			}
+			result = append(result, line)
+			continue
+		}
+
+		if variableIndent < 0 {
+			variableIndent = indent
+		}
+		// Further lines of a multi-line value are indented deeper than the variables
+		if indent > variableIndent {
+			if !redacting {
+				result = append(result, line)
+			}
+			continue
+		}
+
+		redacting = false
+		match := describedEnvironmentVariable.FindStringSubmatch(line)
+		if match != nil && IsSecretParamKey(match[2]) && !strings.HasPrefix(match[4], "<set to the key") {
+			redacting = true
+			line = match[1] + match[2] + ":" + match[3] + RedactedValue
+		}
+		result = append(result, line)
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// podsTable lists the pods like kubectl get pods
+func podsTable(pods []corev1.Pod) string {
+	builder := &strings.Builder{}
+	writer := tabwriter.NewWriter(builder, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tREADY\tSTATUS\tRESTARTS\tNODE")
+	for _, pod := range pods {
+		ready := 0
+		restarts := int32(0)
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Ready {
+				ready++
+			}
+			restarts += status.RestartCount
+		}
+
+		fmt.Fprintf(writer, "%v\t%v/%v\t%v\t%v\t%v\n", pod.Name, ready, len(pod.Spec.Containers), pod.Status.Phase, restarts, pod.Spec.NodeName)
+	}
+	writer.Flush()
+
+	return builder.String()
+}
+
+// eventsTable lists the events, oldest first
+func eventsTable(events []corev1.Event) string {
+	lastSeen := func(event corev1.Event) time.Time {
+		if event.LastTimestamp.IsZero() {
+			return event.EventTime.Time
+		}
+		return event.LastTimestamp.Time
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return lastSeen(events[i]).Before(lastSeen(events[j]))
+	})
+
+	builder := &strings.Builder{}
+	writer := tabwriter.NewWriter(builder, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for _, event := range events {
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v %v\t%v\t%v\n", lastSeen(event).UTC().Format(time.RFC3339), event.Type, event.Reason,
+			event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Count, strings.TrimSpace(event.Message))
+	}
+	writer.Flush()
+
+	return builder.String()
+}
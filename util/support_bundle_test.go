@@ -0,0 +1,131 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSupportBundle_CollectNamespace(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "onepanel-core-1"},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "core"}, {Name: "istio-proxy"}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "core", Ready: true, RestartCount: 2},
+				{Name: "istio-proxy", Ready: true},
+			},
+		},
+	}
+	deployment := &appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Namespace: "onepanel", Name: "onepanel-core"}}
+	event := &corev1.Event{
+		ObjectMeta:     v1.ObjectMeta{Namespace: "onepanel", Name: "onepanel-core-1.1"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "onepanel-core-1"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+	}
+
+	client, err := NewFakeClusterClient(pod, deployment, event)
+	assert.Nil(t, err)
+	client.PodLogs = map[string]string{"onepanel/onepanel-core-1/core": "listening on :8888\n"}
+
+	bundle := NewSupportBundle()
+	bundle.CollectNamespace(client, "onepanel", 100)
+
+	assert.Equal(t, []string{
+		"namespaces/onepanel/pods.txt",
+		"namespaces/onepanel/events.txt",
+		"namespaces/onepanel/describe/Pod-onepanel-core-1.txt",
+		"namespaces/onepanel/describe/Deployment-onepanel-core.txt",
+		"namespaces/onepanel/logs/onepanel-core-1-core.log",
+		"namespaces/onepanel/logs/onepanel-core-1-istio-proxy.log.error",
+	}, bundle.Names())
+
+	pods, _ := bundle.Content("namespaces/onepanel/pods.txt")
+	assert.Contains(t, pods, "onepanel-core-1  2/2    Running  2         node-1")
+	events, _ := bundle.Content("namespaces/onepanel/events.txt")
+	assert.Contains(t, events, "BackOff")
+	logs, _ := bundle.Content("namespaces/onepanel/logs/onepanel-core-1-core.log")
+	assert.Equal(t, "listening on :8888\n", logs)
+	assert.Equal(t, []string{"namespaces/onepanel/logs/onepanel-core-1-istio-proxy.log"}, bundle.Errors())
+}
+
+func Test_redactDescribedEnvironment(t *testing.T) {
+	description := `Containers:
+  core:
+    Image:      onepanel/core:v0.17.0
+    Environment:
+      DB_HOST:        postgres
+      DB_PASSWORD:    hunter2
+      API_TOKEN:      first line
+                      second line
+      AWS_SECRET_KEY:  <set to the key 'secretKey' in secret 'onepanel'>  Optional: false
+      LOG_LEVEL:      info
+    Mounts:
+      /etc/onepanel from config (ro)
+  istio-proxy:
+    Environment:  <none>
+`
+
+	assert.Equal(t, `Containers:
+  core:
+    Image:      onepanel/core:v0.17.0
+    Environment:
+      DB_HOST:        postgres
+      DB_PASSWORD:    <redacted>
+      API_TOKEN:      <redacted>
+      AWS_SECRET_KEY:  <set to the key 'secretKey' in secret 'onepanel'>  Optional: false
+      LOG_LEVEL:      info
+    Mounts:
+      /etc/onepanel from config (ro)
+  istio-proxy:
+    Environment:  <none>
+`, redactDescribedEnvironment(description))
+}
+
+func TestSupportBundle_WriteTarball(t *testing.T) {
+	bundle := NewSupportBundle()
+	bundle.Add("params.yaml", "application: {}\n")
+	bundle.AddError("cluster", errors.New("connection refused"))
+	bundle.Add("params.yaml", "database: {}\n")
+
+	buffer := &bytes.Buffer{}
+	assert.Nil(t, bundle.WriteTarball(buffer))
+
+	gzipReader, err := gzip.NewReader(buffer)
+	assert.Nil(t, err)
+	tarReader := tar.NewReader(gzipReader)
+
+	files := make(map[string]string)
+	names := make([]string, 0)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+
+		content, err := ioutil.ReadAll(tarReader)
+		assert.Nil(t, err)
+		names = append(names, header.Name)
+		files[header.Name] = string(content)
+	}
+
+	assert.Equal(t, []string{"support-bundle/params.yaml", "support-bundle/cluster.error"}, names)
+	assert.Equal(t, "database: {}\n", files["support-bundle/params.yaml"])
+	assert.Equal(t, "connection refused\n", files["support-bundle/cluster.error"])
+}
@@ -2,7 +2,6 @@ package util
 
 import (
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 )
@@ -22,7 +21,7 @@ func GetDeployedWebURL(yamlFile *DynamicYaml) (string, error) {
 
 	insecure, err := strconv.ParseBool(yamlFile.GetValue("application.insecure").Value)
 	if err != nil {
-		log.Fatal("insecure is not a bool")
+		return "", fmt.Errorf("application.insecure is not a bool: %v", err.Error())
 	}
 
 	if !insecure {
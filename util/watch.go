@@ -0,0 +1,181 @@
+package util
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// listerWorkloadGetter gets the workloads from the caches of the informers of WatchUntilReady, without requests to
+// the API server. The listers of every namespace are from one informer factory, by namespace.
+type listerWorkloadGetter struct {
+	podListers         map[string]corelisters.PodLister
+	statefulSetListers map[string]appslisters.StatefulSetLister
+	deploymentListers  map[string]appslisters.DeploymentLister
+}
+
+func (l *listerWorkloadGetter) pods(namespace, name string) ([]corev1.Pod, error) {
+	lister := l.podListers[namespace].Pods(namespace)
+	if name != "" {
+		pod, err := lister.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+
+	list, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]corev1.Pod, 0)
+	for _, pod := range list {
+		pods = append(pods, *pod)
+	}
+	return pods, nil
+}
+
+func (l *listerWorkloadGetter) statefulSets(namespace, name string) ([]appsv1.StatefulSet, error) {
+	lister := l.statefulSetListers[namespace].StatefulSets(namespace)
+	if name != "" {
+		statefulSet, err := lister.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return []appsv1.StatefulSet{*statefulSet}, nil
+	}
+
+	list, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	statefulSets := make([]appsv1.StatefulSet, 0)
+	for _, statefulSet := range list {
+		statefulSets = append(statefulSets, *statefulSet)
+	}
+	return statefulSets, nil
+}
+
+func (l *listerWorkloadGetter) deployments(namespace, name string) ([]appsv1.Deployment, error) {
+	lister := l.deploymentListers[namespace].Deployments(namespace)
+	if name != "" {
+		deployment, err := lister.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return []appsv1.Deployment{*deployment}, nil
+	}
+
+	list, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	deployments := make([]appsv1.Deployment, 0)
+	for _, deployment := range list {
+		deployments = append(deployments, *deployment)
+	}
+	return deployments, nil
+}
+
+// WatchUntilReady keeps informers on the pods, StatefulSets and Deployments in the namespaces of the workloads.
+// Whenever one of them changes, the workloads are checked again in the caches of the informers and onChange is called
+// with the result. It returns nil once every workload is ready, or a *NotReadyError if the timeout passes first.
+func (r *ReadinessChecker) WatchUntilReady(timeout time.Duration, onChange func([]WorkloadStatus), workloads ...Workload) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { notify() },
+		UpdateFunc: func(oldObj, newObj interface{}) { notify() },
+		DeleteFunc: func(obj interface{}) { notify() },
+	}
+
+	getter := &listerWorkloadGetter{
+		podListers:         make(map[string]corelisters.PodLister),
+		statefulSetListers: make(map[string]appslisters.StatefulSetLister),
+		deploymentListers:  make(map[string]appslisters.DeploymentLister),
+	}
+	factories := make([]informers.SharedInformerFactory, 0)
+	for _, workload := range workloads {
+		if _, ok := getter.podListers[workload.Namespace]; ok {
+			continue
+		}
+
+		factory := informers.NewSharedInformerFactoryWithOptions(r.client, 0, informers.WithNamespace(workload.Namespace))
+		pods := factory.Core().V1().Pods()
+		pods.Informer().AddEventHandler(handler)
+		getter.podListers[workload.Namespace] = pods.Lister()
+		statefulSets := factory.Apps().V1().StatefulSets()
+		statefulSets.Informer().AddEventHandler(handler)
+		getter.statefulSetListers[workload.Namespace] = statefulSets.Lister()
+		deployments := factory.Apps().V1().Deployments()
+		deployments.Informer().AddEventHandler(handler)
+		getter.deploymentListers[workload.Namespace] = deployments.Lister()
+
+		factory.Start(stop)
+		factories = append(factories, factory)
+	}
+
+	deadline := time.After(timeout)
+
+	// Until the caches are synced they miss workloads that exist
+	synced := make(chan struct{})
+	go func() {
+		for _, factory := range factories {
+			factory.WaitForCacheSync(stop)
+		}
+		close(synced)
+	}()
+	select {
+	case <-synced:
+	case <-deadline:
+		return r.notReadyError(timeout, workloads)
+	}
+	notify()
+
+	for {
+		select {
+		case <-deadline:
+			return r.notReadyError(timeout, workloads)
+		case <-changes:
+			statuses, err := checkWorkloads(getter, workloads)
+			if err != nil {
+				return err
+			}
+
+			onChange(statuses)
+
+			if len(NotReadyWorkloads(statuses)) == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// notReadyError checks the workloads once more with the API server, it returns nil if they are all ready by now
+func (r *ReadinessChecker) notReadyError(timeout time.Duration, workloads []Workload) error {
+	statuses, err := r.Check(workloads...)
+	if err != nil {
+		return err
+	}
+
+	blocking := NotReadyWorkloads(statuses)
+	if len(blocking) == 0 {
+		return nil
+	}
+
+	return &NotReadyError{Timeout: timeout, Blocking: blocking}
+}